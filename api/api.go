@@ -4,12 +4,16 @@ import (
 	"database/sql"
 
 	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
-	"github.com/go-playground/validator/v10"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/exchange"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/health"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/idempotency"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/importer"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/mlog"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/recurring"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/spender"
 	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
 	"github.com/labstack/echo/v4"
@@ -21,9 +25,9 @@ type Server struct {
 	*echo.Echo
 }
 
-func New(db *sql.DB, cfg config.Config, logger *zap.Logger) *Server {
+func New(db *sql.DB, cfg config.Config, logger *zap.Logger, store eslip.BlobStore) *Server {
 	e := echo.New()
-	e.Validator = &cv.CustomValidator{Validator: validator.New()}
+	e.Validator = cv.New()
 
 	e.Use(middleware.Logger())
 	e.Use(mlog.Middleware(logger))
@@ -32,23 +36,90 @@ func New(db *sql.DB, cfg config.Config, logger *zap.Logger) *Server {
 
 	v1.GET("/slow", health.Slow)
 	v1.GET("/health", health.Check(db))
-	v1.POST("/upload", eslip.Upload)
+
+	{
+		h := auth.New(cfg.Auth, db)
+		v1.POST("/auth/login", h.Login)
+	}
+
+	secured := v1.Group("", auth.Middleware(cfg.Auth, db))
+
+	{
+		limits := eslip.Limits{
+			MaxFileSize:    cfg.Upload.MaxFileSize,
+			MaxRequestSize: cfg.Upload.MaxRequestSize,
+			MaxFiles:       cfg.Upload.MaxFiles,
+			MaxScrubs:      cfg.Upload.MaxScrubs,
+		}
+		h := eslip.New(db, store, limits, cfg.Storage.PresignTTL)
+		secured.POST("/upload", h.Upload, auth.RequireScope(auth.ScopeAttachSlips))
+		secured.GET("/slips/duplicates", h.NearDuplicates, auth.RequireRole(auth.RoleAdmin))
+		secured.GET("/slips/jobs/:id", h.GetJob).Name = eslip.RouteJob
+		secured.GET("/slips/:key", h.Get).Name = eslip.RouteGet
+		secured.POST("/slips/purge", h.Purge(cfg.Retention.OrphanSlips), auth.RequireRole(auth.RoleAdmin))
+		secured.POST("/transactions/:id/slips", h.Attach, auth.RequireScope(auth.ScopeAttachSlips))
+		secured.DELETE("/transactions/:id/slips/:key", h.Detach, auth.RequireScope(auth.ScopeAttachSlips))
+	}
+
+	{
+		h := auth.New(cfg.Auth, db)
+		admin := auth.RequireRole(auth.RoleAdmin)
+		secured.GET("/service-keys", h.ListServiceKeys, admin)
+		secured.POST("/service-keys", h.IssueServiceKey, admin)
+		secured.POST("/service-keys/:id/rotate", h.RotateServiceKey, admin)
+		secured.DELETE("/service-keys/:id", h.RevokeServiceKey, admin)
+	}
+
+	{
+		h := exchange.New(db)
+		admin := auth.RequireRole(auth.RoleAdmin)
+		secured.GET("/exchange-rates", h.GetAll, admin)
+		secured.POST("/exchange-rates", h.Load, admin)
+		secured.POST("/exchange-rates/import", h.Import, admin)
+	}
 
 	{
 		h := spender.New(cfg.FeatureFlag, db)
-		v1.GET("/spenders", h.GetAll)
-		v1.GET("/spenders/:id", h.GetByID)
 		v1.POST("/spenders", h.Create)
-		v1.GET("/spenders/:id/transactions/summary", h.GetTransactionsSummary)
-		v1.GET("/spenders/:id", h.GetSpenderByID)
-		v1.GET("/spenders/:id/transactions", h.GetTransactionBySpenderID)
+		secured.GET("/spenders", h.GetAll, auth.RequireRole(auth.RoleAdmin))
+		secured.GET("/spenders/:id", h.GetByID)
+		secured.GET("/spenders/:id/transactions/summary", h.GetTransactionsSummary)
+		secured.GET("/spenders/:id", h.GetSpenderByID)
+		secured.PUT("/spenders/:id", h.Update)
+		secured.GET("/spenders/:id/transactions", h.GetTransactionBySpenderID)
+		secured.GET("/spenders/:id/transactions/export", h.ExportTransactions)
+	}
+
+	{
+		h := importer.New(db, importer.Limits{
+			MaxRequestSize: cfg.Import.MaxRequestSize,
+			MaxRows:        cfg.Import.MaxRows,
+		})
+		secured.POST("/spenders/:id/imports", h.Import)
+		secured.GET("/spenders/:id/import-profiles", h.GetProfiles)
+		secured.POST("/spenders/:id/import-profiles", h.SaveProfile)
+		secured.DELETE("/spenders/:id/import-profiles/:name", h.DeleteProfile)
+	}
+
+	{
+		h := recurring.New(db)
+		secured.POST("/recurring-transactions", h.Create, auth.RequireScope(auth.ScopeCreateTransactions))
+		secured.GET("/recurring-transactions/:id", h.Get)
+		secured.DELETE("/recurring-transactions/:id", h.Delete)
+		secured.GET("/spenders/:id/recurring-transactions", h.GetBySpender)
 	}
 
 	{
 		h := transaction.New(db)
-		v1.PUT("/transactions/:id", h.Update)
-		v1.GET("/transactions", h.GetAll)
-		v1.POST("/transactions", h.Create)
+		secured.GET("/transactions/:id", h.Get)
+		secured.PUT("/transactions/:id", h.Update)
+		secured.PATCH("/transactions/:id", h.Patch)
+		secured.DELETE("/transactions/:id", h.Delete)
+		secured.POST("/transactions/:id/restore", h.Restore)
+		secured.POST("/transactions/purge", h.Purge(cfg.Retention.DeletedTransactions), auth.RequireRole(auth.RoleAdmin))
+		secured.GET("/transactions", h.GetAll, auth.RequireRole(auth.RoleAdmin))
+		secured.POST("/transactions", h.Create, auth.RequireScope(auth.ScopeCreateTransactions), idempotency.Middleware(db, cfg.Idempotency.TTL))
+		secured.POST("/transactions\\:batch", h.CreateBatch, auth.RequireScope(auth.ScopeCreateTransactions), idempotency.Middleware(db, cfg.Idempotency.TTL))
 	}
 
 	return &Server{e}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const (
+	lookupKeyStmt = `SELECT id, key_hash, scopes FROM service_key WHERE key_prefix = $1 AND revoked_at IS NULL`
+
+	testKeyPrefix = "0a1b2c3d"
+	testKey       = "hjk_" + testKeyPrefix + "_c2VjcmV0"
+)
+
+var testCfg = config.Config{Auth: config.Auth{JWTSecret: "secret", TokenTTL: time.Hour}}
+
+// expectServiceKey has the service key testKey authenticate with scopes.
+func expectServiceKey(mock sqlmock.Sqlmock, scopes ...string) {
+	sum := sha256.Sum256([]byte(testKey))
+	mock.ExpectQuery(lookupKeyStmt).WithArgs(testKeyPrefix).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "key_hash", "scopes"}).AddRow(3, hex.EncodeToString(sum[:]), strings.Join(scopes, " ")))
+}
+
+func TestRoutes(t *testing.T) {
+	t.Run("given service key without transactions:create should not create recurring transaction", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		expectServiceKey(mock, auth.ScopeAttachSlips)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/recurring-transactions",
+			strings.NewReader(`{"spender_id": 1, "amount": 100, "category": "gym", "transaction_type": "expense", "frequency": "monthly", "starts_at": "2024-06-01"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(auth.HeaderAPIKey, testKey)
+		rec := httptest.NewRecorder()
+
+		New(db, testCfg, zap.NewNop(), nil).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/api/v1/transactions/7/slips"},
+		{http.MethodDelete, "/api/v1/transactions/7/slips/k.png"},
+	} {
+		t.Run("given service key without slips:attach should forbid "+route.method+" "+route.path, func(t *testing.T) {
+			db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			defer db.Close()
+			expectServiceKey(mock, auth.ScopeCreateTransactions)
+
+			req := httptest.NewRequest(route.method, route.path, strings.NewReader(`{"key": "k.png"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(auth.HeaderAPIKey, testKey)
+			rec := httptest.NewRecorder()
+
+			New(db, testCfg, zap.NewNop(), nil).ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/golang-jwt/jwt"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+type Claims struct {
+	SpenderID int    `json:"spender_id"`
+	Role      string `json:"role"`
+	jwt.StandardClaims
+}
+
+type Credentials struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+type handler struct {
+	cfg config.Auth
+	db  *sql.DB
+}
+
+func New(cfg config.Auth, db *sql.DB) *handler {
+	return &handler{cfg, db}
+}
+
+const (
+	loginStmt = `SELECT id, password_hash, role FROM spender WHERE email = $1`
+)
+
+// HashPassword returns the bcrypt hash stored in spender.password_hash.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Login exchanges a spender's email and password for a signed access token.
+func (h handler) Login(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var cred Credentials
+	if err := c.Bind(&cred); err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	if err := c.Validate(cred); err != nil {
+		logger.Error("validate request body failed", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	var id int
+	var hash, role string
+	err := h.db.QueryRowContext(ctx, loginStmt, cred.Email).Scan(&id, &hash, &role)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("spender not found", zap.String("email", cred.Email))
+		return c.JSON(http.StatusUnauthorized, errs.ParseError(ErrInvalidCredentials))
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(cred.Password)); err != nil {
+		logger.Warn("password mismatch", zap.Int("id", id))
+		return c.JSON(http.StatusUnauthorized, errs.ParseError(ErrInvalidCredentials))
+	}
+
+	token, err := Sign(h.cfg, Principal{SpenderID: id, Role: role}, time.Now())
+	if err != nil {
+		logger.Error("sign token error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	logger.Info("login successfully", zap.Int("id", id))
+	return c.JSON(http.StatusOK, Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(h.cfg.TokenTTL.Seconds()),
+	})
+}
+
+// Sign issues an HS256 token for the principal that expires after cfg.TokenTTL.
+func Sign(cfg config.Auth, p Principal, now time.Time) (string, error) {
+	claims := Claims{
+		SpenderID: p.SpenderID,
+		Role:      p.Role,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   strconv.Itoa(p.SpenderID),
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(cfg.TokenTTL).Unix(),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.JWTSecret))
+}
+
+// Parse verifies the token signature and expiry and returns its claims.
+func Parse(cfg config.Auth, token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method " + t.Method.Alg())
+		}
+		return []byte(cfg.JWTSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
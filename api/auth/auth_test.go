@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCfg = config.Auth{JWTSecret: "secret", TokenTTL: time.Hour}
+
+func TestLogin(t *testing.T) {
+	hash, _ := HashPassword("password")
+
+	t.Run("given valid credentials should return access token", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": "hong@jot.ok", "password": "password"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(loginStmt).WithArgs("hong@jot.ok").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash", "role"}).AddRow(1, hash, RoleAdmin))
+
+		h := New(testCfg, db)
+		err := h.Login(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var token Token
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &token))
+		assert.Equal(t, "Bearer", token.TokenType)
+		assert.Equal(t, int64(3600), token.ExpiresIn)
+
+		claims, err := Parse(testCfg, token.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, claims.SpenderID)
+		assert.Equal(t, RoleAdmin, claims.Role)
+	})
+
+	t.Run("given wrong password should return unauthorized", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": "hong@jot.ok", "password": "wrong"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(loginStmt).WithArgs("hong@jot.ok").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "password_hash", "role"}).AddRow(1, hash, RoleAdmin))
+
+		h := New(testCfg, db)
+		err := h.Login(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.JSONEq(t, `{"messages":["invalid email or password"]}`, rec.Body.String())
+	})
+
+	t.Run("given unknown email should return unauthorized", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": "nobody@jot.ok", "password": "password"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(loginStmt).WithArgs("nobody@jot.ok").WillReturnError(sql.ErrNoRows)
+
+		h := New(testCfg, db)
+		err := h.Login(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("given missing password should return bad request", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": "hong@jot.ok"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(testCfg, nil)
+		err := h.Login(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["field Password is required"]}`, rec.Body.String())
+	})
+}
+
+func TestParse(t *testing.T) {
+	t.Run("given expired token should return error", func(t *testing.T) {
+		token, err := Sign(testCfg, Principal{SpenderID: 1, Role: RoleSpender}, time.Now().Add(-2*time.Hour))
+		assert.NoError(t, err)
+
+		_, err = Parse(testCfg, token)
+
+		assert.Error(t, err)
+	})
+
+	t.Run("given token signed with another secret should return error", func(t *testing.T) {
+		token, err := Sign(config.Auth{JWTSecret: "other", TokenTTL: time.Hour}, Principal{SpenderID: 1, Role: RoleSpender}, time.Now())
+		assert.NoError(t, err)
+
+		_, err = Parse(testCfg, token)
+
+		assert.Error(t, err)
+	})
+}
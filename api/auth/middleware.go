@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	key = "principal"
+
+	HeaderAPIKey = "X-API-Key"
+)
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid or expired token")
+)
+
+// Principal is the authenticated caller of a request. Service principals
+// authenticate with an API key and carry scopes instead of a spender ID.
+type Principal struct {
+	SpenderID    int
+	Role         string
+	ServiceKeyID int
+	Scopes       []string
+}
+
+// Middleware rejects requests without a valid bearer token or API key and
+// stores the authenticated Principal in the echo context.
+func Middleware(cfg config.Auth, db *sql.DB) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			logger := mlog.L(c)
+
+			if raw := c.Request().Header.Get(HeaderAPIKey); raw != "" {
+				p, err := authenticateKey(c.Request().Context(), db, raw)
+				if errors.Is(err, ErrInvalidAPIKey) {
+					logger.Warn("invalid api key")
+					return c.JSON(http.StatusUnauthorized, errs.ParseError(err))
+				}
+				if err != nil {
+					logger.Error("authenticate api key error", zap.Error(err))
+					return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+				}
+
+				SetPrincipal(c, p)
+				return next(c)
+			}
+
+			token, ok := bearerToken(c.Request().Header.Get(echo.HeaderAuthorization))
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, errs.ParseError(ErrMissingToken))
+			}
+
+			claims, err := Parse(cfg, token)
+			if err != nil {
+				logger.Warn("invalid token", zap.Error(err))
+				return c.JSON(http.StatusUnauthorized, errs.ParseError(ErrInvalidToken))
+			}
+
+			SetPrincipal(c, Principal{SpenderID: claims.SpenderID, Role: claims.Role})
+			return next(c)
+		}
+	}
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+func SetPrincipal(c echo.Context, p Principal) {
+	c.Set(key, p)
+}
+
+// PrincipalFrom returns the caller stored by Middleware, if any.
+func PrincipalFrom(c echo.Context) (Principal, bool) {
+	p, ok := c.Get(key).(Principal)
+	return p, ok
+}
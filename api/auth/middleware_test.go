@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	newServer := func() *echo.Echo {
+		e := echo.New()
+		e.GET("/", func(c echo.Context) error {
+			p, _ := PrincipalFrom(c)
+			return c.JSON(http.StatusOK, p.SpenderID)
+		}, Middleware(testCfg, nil))
+		return e
+	}
+
+	t.Run("given valid token should set principal", func(t *testing.T) {
+		e := newServer()
+		defer e.Close()
+
+		token, _ := Sign(testCfg, Principal{SpenderID: 7, Role: RoleSpender}, time.Now())
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "7\n", rec.Body.String())
+	})
+
+	t.Run("given no token should return unauthorized", func(t *testing.T) {
+		e := newServer()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.JSONEq(t, `{"messages":["missing bearer token"]}`, rec.Body.String())
+	})
+
+	t.Run("given invalid token should return unauthorized", func(t *testing.T) {
+		e := newServer()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer not-a-token")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.JSONEq(t, `{"messages":["invalid or expired token"]}`, rec.Body.String())
+	})
+
+	t.Run("given valid api key should set service principal", func(t *testing.T) {
+		raw, prefix, hash, _ := generateKey()
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(lookupKeyStmt).WithArgs(prefix).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "key_hash", "scopes"}).AddRow(3, hash, "transactions:create"))
+
+		e := echo.New()
+		defer e.Close()
+		e.GET("/", func(c echo.Context) error {
+			p, _ := PrincipalFrom(c)
+			return c.JSON(http.StatusOK, p)
+		}, Middleware(testCfg, db))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAPIKey, raw)
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"SpenderID":0,"Role":"service","ServiceKeyID":3,"Scopes":["transactions:create"]}`, rec.Body.String())
+	})
+
+	t.Run("given api key with wrong secret should return unauthorized", func(t *testing.T) {
+		_, prefix, hash, _ := generateKey()
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(lookupKeyStmt).WithArgs(prefix).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "key_hash", "scopes"}).AddRow(3, hash, "transactions:create"))
+
+		e := echo.New()
+		defer e.Close()
+		e.GET("/", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		}, Middleware(testCfg, db))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderAPIKey, "hjk_"+prefix+"_forged")
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.JSONEq(t, `{"messages":["invalid or revoked api key"]}`, rec.Body.String())
+	})
+}
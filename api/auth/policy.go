@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	RoleAdmin   = "admin"
+	RoleSpender = "spender"
+	RoleService = "service"
+)
+
+func (p Principal) IsAdmin() bool {
+	return p.Role == RoleAdmin
+}
+
+func (p Principal) IsService() bool {
+	return p.Role == RoleService
+}
+
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CanAccess reports whether p may read or change rows owned by spenderID.
+// Admins can act on behalf of any spender; spenders only on their own rows.
+// Service callers never read or change existing rows.
+func (p Principal) CanAccess(spenderID int) bool {
+	if p.IsService() {
+		return false
+	}
+
+	return p.IsAdmin() || p.SpenderID == spenderID
+}
+
+// OwnerFor returns the spender a new row should belong to. Admins and service
+// callers may name any spender; spenders always create rows for themselves.
+func (p Principal) OwnerFor(requested int) int {
+	if (p.IsAdmin() || p.IsService()) && requested != 0 {
+		return requested
+	}
+
+	return p.SpenderID
+}
+
+// RequireRole only lets principals holding one of roles through.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := PrincipalFrom(c)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+			}
+
+			for _, role := range roles {
+				if p.Role == role {
+					return next(c)
+				}
+			}
+
+			return c.JSON(http.StatusForbidden, errs.ParseError(errs.ErrForbidden))
+		}
+	}
+}
+
+// RequireScope limits service principals to endpoints their key was scoped
+// for. Human principals are governed by roles and pass through.
+func RequireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := PrincipalFrom(c)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+			}
+
+			if p.IsService() && !p.HasScope(scope) {
+				return c.JSON(http.StatusForbidden, errs.ParseError(errs.ErrForbidden))
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanAccess(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal Principal
+		spenderID int
+		expected  bool
+	}{
+		{"spender accesses own rows", Principal{SpenderID: 1, Role: RoleSpender}, 1, true},
+		{"spender accesses other rows", Principal{SpenderID: 1, Role: RoleSpender}, 2, false},
+		{"admin accesses other rows", Principal{SpenderID: 1, Role: RoleAdmin}, 2, true},
+		{"service accesses existing rows", Principal{Role: RoleService}, 0, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, tt.principal.CanAccess(tt.spenderID), tt.name)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	t.Run("given admin should pass through", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		SetPrincipal(c, Principal{SpenderID: 1, Role: RoleAdmin})
+
+		err := RequireRole(RoleAdmin)(handler)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("given spender should return forbidden", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		SetPrincipal(c, Principal{SpenderID: 1, Role: RoleSpender})
+
+		err := RequireRole(RoleAdmin)(handler)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.JSONEq(t, `{"messages":["forbidden"]}`, rec.Body.String())
+	})
+
+	t.Run("given no principal should return unauthorized", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+		err := RequireRole(RoleAdmin)(handler)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestOwnerFor(t *testing.T) {
+	assert.Equal(t, 1, Principal{SpenderID: 1, Role: RoleSpender}.OwnerFor(2))
+	assert.Equal(t, 2, Principal{SpenderID: 1, Role: RoleAdmin}.OwnerFor(2))
+	assert.Equal(t, 1, Principal{SpenderID: 1, Role: RoleAdmin}.OwnerFor(0))
+	assert.Equal(t, 2, Principal{Role: RoleService}.OwnerFor(2))
+	assert.Equal(t, 0, Principal{Role: RoleService}.OwnerFor(0))
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	tests := []struct {
+		name      string
+		principal Principal
+		expected  int
+	}{
+		{"spender passes through", Principal{SpenderID: 1, Role: RoleSpender}, http.StatusOK},
+		{"service with scope passes through", Principal{Role: RoleService, Scopes: []string{ScopeCreateTransactions}}, http.StatusOK},
+		{"service without scope is forbidden", Principal{Role: RoleService, Scopes: []string{ScopeAttachSlips}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		e := echo.New()
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		SetPrincipal(c, tt.principal)
+
+		err := RequireScope(ScopeCreateTransactions)(handler)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, rec.Code, tt.name)
+		e.Close()
+	}
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	ScopeCreateTransactions = "transactions:create"
+	ScopeAttachSlips        = "slips:attach"
+
+	keyScheme = "hjk"
+)
+
+var (
+	ErrInvalidAPIKey      = errors.New("invalid or revoked api key")
+	ErrServiceKeyNotFound = errors.New("service key not found")
+)
+
+// ServiceKey is a credential for machine callers such as the receipt-ingestion
+// Lambda. Key is only populated in the response that issues or rotates it.
+type ServiceKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name" validate:"required"`
+	Scopes    []string   `json:"scopes" validate:"required,dive,oneof=transactions:create slips:attach"`
+	Key       string     `json:"key,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+const (
+	lookupKeyStmt = `SELECT id, key_hash, scopes FROM service_key WHERE key_prefix = $1 AND revoked_at IS NULL`
+	listKeysStmt  = `SELECT id, name, scopes, created_at, rotated_at, revoked_at FROM service_key ORDER BY id`
+	issueKeyStmt  = `INSERT INTO service_key (name, key_prefix, key_hash, scopes) VALUES ($1, $2, $3, $4) RETURNING id, created_at;`
+	rotateKeyStmt = `UPDATE service_key SET key_prefix = $1, key_hash = $2, rotated_at = now() WHERE id = $3 AND revoked_at IS NULL RETURNING name, scopes, created_at, rotated_at;`
+	revokeKeyStmt = `UPDATE service_key SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL;`
+)
+
+// generateKey returns a new raw key of the form hjk_<prefix>_<secret>
+// together with its lookup prefix and the hash that is persisted.
+func generateKey() (raw, prefix, hash string, err error) {
+	p := make([]byte, 4)
+	if _, err = rand.Read(p); err != nil {
+		return "", "", "", err
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = hex.EncodeToString(p)
+	raw = keyScheme + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return raw, prefix, hashKey(raw), nil
+}
+
+func hashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func keyPrefix(raw string) (string, bool) {
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0] != keyScheme || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+// authenticateKey resolves a raw API key to a service Principal.
+func authenticateKey(ctx context.Context, db *sql.DB, raw string) (Principal, error) {
+	prefix, ok := keyPrefix(raw)
+	if !ok {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	var id int
+	var hash, scopes string
+	err := db.QueryRowContext(ctx, lookupKeyStmt, prefix).Scan(&id, &hash, &scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Principal{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return Principal{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(hashKey(raw))) != 1 {
+		return Principal{}, ErrInvalidAPIKey
+	}
+
+	return Principal{Role: RoleService, ServiceKeyID: id, Scopes: strings.Fields(scopes)}, nil
+}
+
+func (h handler) ListServiceKeys(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	rows, err := h.db.QueryContext(ctx, listKeysStmt)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	defer rows.Close()
+
+	keys := make([]ServiceKey, 0)
+	for rows.Next() {
+		var k ServiceKey
+		var scopes string
+		if err := rows.Scan(&k.ID, &k.Name, &scopes, &k.CreatedAt, &k.RotatedAt, &k.RevokedAt); err != nil {
+			logger.Error("scan error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		k.Scopes = strings.Fields(scopes)
+		keys = append(keys, k)
+	}
+
+	return c.JSON(http.StatusOK, keys)
+}
+
+// IssueServiceKey creates a key with the requested scopes. The raw key is
+// returned once and only its hash is stored.
+func (h handler) IssueServiceKey(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var k ServiceKey
+	if err := c.Bind(&k); err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	if err := c.Validate(k); err != nil {
+		logger.Error("validate request body failed", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	raw, prefix, hash, err := generateKey()
+	if err != nil {
+		logger.Error("generate key error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	err = h.db.QueryRowContext(ctx, issueKeyStmt, k.Name, prefix, hash, strings.Join(k.Scopes, " ")).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	logger.Info("issue service key successfully", zap.Int("id", k.ID))
+	k.Key = raw
+	return c.JSON(http.StatusCreated, k)
+}
+
+// RotateServiceKey replaces the secret of an active key. The previous secret
+// stops working immediately.
+func (h handler) RotateServiceKey(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Error("ID parameter is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	raw, prefix, hash, err := generateKey()
+	if err != nil {
+		logger.Error("generate key error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	k := ServiceKey{ID: id, Key: raw}
+	var scopes string
+	err = h.db.QueryRowContext(ctx, rotateKeyStmt, prefix, hash, id).Scan(&k.Name, &scopes, &k.CreatedAt, &k.RotatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrServiceKeyNotFound))
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	k.Scopes = strings.Fields(scopes)
+
+	logger.Info("rotate service key successfully", zap.Int("id", id))
+	return c.JSON(http.StatusOK, k)
+}
+
+func (h handler) RevokeServiceKey(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Error("ID parameter is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	res, err := h.db.ExecContext(ctx, revokeKeyStmt, id)
+	if err != nil {
+		logger.Error("exec error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrServiceKeyNotFound))
+	}
+
+	logger.Info("revoke service key successfully", zap.Int("id", id))
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
+	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateKey(t *testing.T) {
+	raw, prefix, hash, err := generateKey()
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, "hjk_"+prefix+"_"))
+	assert.Equal(t, hashKey(raw), hash)
+
+	p, ok := keyPrefix(raw)
+	assert.True(t, ok)
+	assert.Equal(t, prefix, p)
+
+	_, ok = keyPrefix("not-a-key")
+	assert.False(t, ok)
+}
+
+func TestIssueServiceKey(t *testing.T) {
+	t.Run("given name and scopes should issue key", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "textract-lambda", "scopes": ["transactions:create", "slips:attach"]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(issueKeyStmt).
+			WithArgs("textract-lambda", sqlmock.AnyArg(), sqlmock.AnyArg(), "transactions:create slips:attach").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC)))
+
+		h := New(testCfg, db)
+		err := h.IssueServiceKey(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+
+		var k ServiceKey
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &k))
+		assert.Equal(t, 1, k.ID)
+		assert.True(t, strings.HasPrefix(k.Key, "hjk_"))
+		assert.Equal(t, []string{"transactions:create", "slips:attach"}, k.Scopes)
+	})
+
+	t.Run("given unknown scope should return bad request", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "textract-lambda", "scopes": ["spenders:delete"]}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(testCfg, nil)
+		err := h.IssueServiceKey(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["the value of Scopes[0] must be one of transactions:create slips:attach"]}`, rec.Body.String())
+	})
+}
+
+func TestRotateServiceKey(t *testing.T) {
+	t.Run("given active key should return new secret", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		now := time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(rotateKeyStmt).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1).
+			WillReturnRows(sqlmock.NewRows([]string{"name", "scopes", "created_at", "rotated_at"}).AddRow("textract-lambda", "transactions:create", now, now))
+
+		h := New(testCfg, db)
+		err := h.RotateServiceKey(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"key":"hjk_`)
+	})
+
+	t.Run("given revoked key should return not found", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(rotateKeyStmt).WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 1).WillReturnError(sql.ErrNoRows)
+
+		h := New(testCfg, db)
+		err := h.RotateServiceKey(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestRevokeServiceKey(t *testing.T) {
+	t.Run("given active key should revoke it", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), rec)
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectExec(revokeKeyStmt).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		h := New(testCfg, db)
+		err := h.RevokeServiceKey(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	})
+
+	t.Run("given unknown key should return not found", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), rec)
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectExec(revokeKeyStmt).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		h := New(testCfg, db)
+		err := h.RevokeServiceKey(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
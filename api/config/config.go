@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/caarlos0/env/v10"
 )
@@ -14,6 +15,16 @@ type Config struct {
 	Database    Database
 	Server      Server
 	FeatureFlag FeatureFlag
+	Auth        Auth
+	Retention   Retention
+	Idempotency Idempotency
+	Recurring   Recurring
+	Storage     Storage
+	Upload      Upload
+	Import      Import
+	Extractor   Extractor
+	SlipJobs    SlipJobs
+	Thumbnails  Thumbnails
 }
 
 func (c Config) PostgresURI() string {
@@ -32,6 +43,93 @@ type FeatureFlag struct {
 	EnableCreateSpender bool `env:"ENABLE_CREATE_SPENDER"`
 }
 
+type Auth struct {
+	JWTSecret string        `env:"AUTH_JWT_SECRET,required"`
+	TokenTTL  time.Duration `env:"AUTH_TOKEN_TTL" envDefault:"24h"`
+}
+
+// Retention bounds how long soft-deleted rows are kept before a purge may
+// remove them for good, and how long an uploaded slip may stay attached to no
+// transaction.
+type Retention struct {
+	DeletedTransactions time.Duration `env:"RETENTION_DELETED_TRANSACTIONS" envDefault:"720h"`
+	OrphanSlips         time.Duration `env:"RETENTION_ORPHAN_SLIPS" envDefault:"168h"`
+}
+
+// Idempotency controls how long a response stored under an Idempotency-Key
+// is replayed before the key may be reused, and how often expired keys are
+// deleted.
+type Idempotency struct {
+	TTL           time.Duration `env:"IDEMPOTENCY_TTL" envDefault:"24h"`
+	SweepInterval time.Duration `env:"IDEMPOTENCY_SWEEP_INTERVAL" envDefault:"1h"`
+}
+
+// Recurring sets how often the scheduler looks for recurring transactions
+// that have come due.
+type Recurring struct {
+	Interval time.Duration `env:"RECURRING_INTERVAL" envDefault:"1m"`
+}
+
+// Storage selects where uploaded slips are kept: Driver "local" stores them
+// under LocalDir, "s3" in an S3 bucket or an S3-compatible service such as
+// MinIO at S3Endpoint. PresignTTL bounds the download links handed out by
+// stores that can sign them.
+type Storage struct {
+	Driver      string        `env:"STORAGE_DRIVER" envDefault:"local"`
+	LocalDir    string        `env:"STORAGE_LOCAL_DIR" envDefault:"data/slips"`
+	S3Endpoint  string        `env:"STORAGE_S3_ENDPOINT"`
+	S3Region    string        `env:"STORAGE_S3_REGION" envDefault:"us-east-1"`
+	S3Bucket    string        `env:"STORAGE_S3_BUCKET"`
+	S3AccessKey string        `env:"STORAGE_S3_ACCESS_KEY"`
+	S3SecretKey string        `env:"STORAGE_S3_SECRET_KEY"`
+	PresignTTL  time.Duration `env:"STORAGE_PRESIGN_TTL" envDefault:"15m"`
+}
+
+// Upload limits slip uploads. Sizes are in bytes. MaxScrubs is how many
+// images may be decoded and encoded again at once, across all requests.
+type Upload struct {
+	MaxFileSize    int64 `env:"UPLOAD_MAX_FILE_SIZE" envDefault:"10485760"`
+	MaxRequestSize int64 `env:"UPLOAD_MAX_REQUEST_SIZE" envDefault:"31457280"`
+	MaxFiles       int   `env:"UPLOAD_MAX_FILES" envDefault:"10"`
+	MaxScrubs      int   `env:"UPLOAD_MAX_SCRUBS" envDefault:"2"`
+}
+
+// Import limits statement imports. MaxRequestSize is in bytes.
+type Import struct {
+	MaxRequestSize int64 `env:"IMPORT_MAX_REQUEST_SIZE" envDefault:"5242880"`
+	MaxRows        int   `env:"IMPORT_MAX_ROWS" envDefault:"5000"`
+}
+
+// Extractor configures reading draft transactions off uploaded slips.
+// Command is an OCR program, with its arguments, that reads an image on its
+// standard input and prints the text; slips are not read when it is empty.
+type Extractor struct {
+	Command string        `env:"EXTRACTOR_COMMAND"`
+	Timeout time.Duration `env:"EXTRACTOR_TIMEOUT" envDefault:"30s"`
+}
+
+// SlipJobs configures the workers that process uploaded slips. A job that
+// fails is retried after Backoff, doubled on every further attempt up to
+// MaxBackoff, and left dead after MaxAttempts. Lease is how long a worker
+// holds a job before another may take it over; it must outlast the extractor
+// timeout.
+type SlipJobs struct {
+	Workers      int           `env:"SLIP_JOBS_WORKERS" envDefault:"2"`
+	PollInterval time.Duration `env:"SLIP_JOBS_POLL_INTERVAL" envDefault:"1s"`
+	MaxAttempts  int           `env:"SLIP_JOBS_MAX_ATTEMPTS" envDefault:"5"`
+	Backoff      time.Duration `env:"SLIP_JOBS_BACKOFF" envDefault:"10s"`
+	MaxBackoff   time.Duration `env:"SLIP_JOBS_MAX_BACKOFF" envDefault:"10m"`
+	Lease        time.Duration `env:"SLIP_JOBS_LEASE" envDefault:"5m"`
+}
+
+// Thumbnails sizes the previews made of image slips: they fit in a square of
+// Size pixels, and the JPEG ones are encoded at JPEGQuality. A Size of 0
+// turns them off.
+type Thumbnails struct {
+	Size        int `env:"THUMBNAIL_SIZE" envDefault:"320"`
+	JPEGQuality int `env:"THUMBNAIL_JPEG_QUALITY" envDefault:"80"`
+}
+
 func Env(key string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -71,6 +169,74 @@ func parse(envPrefix string) (Config, error) {
 		return Config{}, errors.New("failed to parse feature flag config:" + err.Error())
 	}
 
+	authconf := &Auth{}
+	if err := env.ParseWithOptions(authconf, opts); err != nil {
+		return Config{}, errors.New("failed to parse auth config:" + err.Error())
+	}
+
+	retention := &Retention{}
+	if err := env.ParseWithOptions(retention, opts); err != nil {
+		return Config{}, errors.New("failed to parse retention config:" + err.Error())
+	}
+
+	idempotency := &Idempotency{}
+	if err := env.ParseWithOptions(idempotency, opts); err != nil {
+		return Config{}, errors.New("failed to parse idempotency config:" + err.Error())
+	}
+	if err := positive(opts, "IDEMPOTENCY_SWEEP_INTERVAL", idempotency.SweepInterval); err != nil {
+		return Config{}, errors.New("failed to parse idempotency config:" + err.Error())
+	}
+
+	recurring := &Recurring{}
+	if err := env.ParseWithOptions(recurring, opts); err != nil {
+		return Config{}, errors.New("failed to parse recurring config:" + err.Error())
+	}
+	if err := positive(opts, "RECURRING_INTERVAL", recurring.Interval); err != nil {
+		return Config{}, errors.New("failed to parse recurring config:" + err.Error())
+	}
+
+	storage := &Storage{}
+	if err := env.ParseWithOptions(storage, opts); err != nil {
+		return Config{}, errors.New("failed to parse storage config:" + err.Error())
+	}
+
+	upload := &Upload{}
+	if err := env.ParseWithOptions(upload, opts); err != nil {
+		return Config{}, errors.New("failed to parse upload config:" + err.Error())
+	}
+
+	imports := &Import{}
+	if err := env.ParseWithOptions(imports, opts); err != nil {
+		return Config{}, errors.New("failed to parse import config:" + err.Error())
+	}
+
+	extractor := &Extractor{}
+	if err := env.ParseWithOptions(extractor, opts); err != nil {
+		return Config{}, errors.New("failed to parse extractor config:" + err.Error())
+	}
+
+	slipJobs := &SlipJobs{}
+	if err := env.ParseWithOptions(slipJobs, opts); err != nil {
+		return Config{}, errors.New("failed to parse slip jobs config:" + err.Error())
+	}
+	if err := positive(opts, "SLIP_JOBS_POLL_INTERVAL", slipJobs.PollInterval); err != nil {
+		return Config{}, errors.New("failed to parse slip jobs config:" + err.Error())
+	}
+	if err := positive(opts, "SLIP_JOBS_BACKOFF", slipJobs.Backoff); err != nil {
+		return Config{}, errors.New("failed to parse slip jobs config:" + err.Error())
+	}
+	if err := positive(opts, "SLIP_JOBS_MAX_BACKOFF", slipJobs.MaxBackoff); err != nil {
+		return Config{}, errors.New("failed to parse slip jobs config:" + err.Error())
+	}
+	if err := positive(opts, "SLIP_JOBS_LEASE", slipJobs.Lease); err != nil {
+		return Config{}, errors.New("failed to parse slip jobs config:" + err.Error())
+	}
+
+	thumbnails := &Thumbnails{}
+	if err := env.ParseWithOptions(thumbnails, opts); err != nil {
+		return Config{}, errors.New("failed to parse thumbnails config:" + err.Error())
+	}
+
 	port := Env("SERVER_PORT")
 	if port == "" {
 		port = "8080"
@@ -86,9 +252,70 @@ func parse(envPrefix string) (Config, error) {
 		FeatureFlag: FeatureFlag{
 			EnableCreateSpender: feats.EnableCreateSpender,
 		},
+		Auth: Auth{
+			JWTSecret: authconf.JWTSecret,
+			TokenTTL:  authconf.TokenTTL,
+		},
+		Retention: Retention{
+			DeletedTransactions: retention.DeletedTransactions,
+			OrphanSlips:         retention.OrphanSlips,
+		},
+		Idempotency: Idempotency{
+			TTL:           idempotency.TTL,
+			SweepInterval: idempotency.SweepInterval,
+		},
+		Recurring: Recurring{
+			Interval: recurring.Interval,
+		},
+		Storage: Storage{
+			Driver:      storage.Driver,
+			LocalDir:    storage.LocalDir,
+			S3Endpoint:  storage.S3Endpoint,
+			S3Region:    storage.S3Region,
+			S3Bucket:    storage.S3Bucket,
+			S3AccessKey: storage.S3AccessKey,
+			S3SecretKey: storage.S3SecretKey,
+			PresignTTL:  storage.PresignTTL,
+		},
+		Upload: Upload{
+			MaxFileSize:    upload.MaxFileSize,
+			MaxRequestSize: upload.MaxRequestSize,
+			MaxFiles:       upload.MaxFiles,
+			MaxScrubs:      upload.MaxScrubs,
+		},
+		Import: Import{
+			MaxRequestSize: imports.MaxRequestSize,
+			MaxRows:        imports.MaxRows,
+		},
+		Extractor: Extractor{
+			Command: extractor.Command,
+			Timeout: extractor.Timeout,
+		},
+		SlipJobs: SlipJobs{
+			Workers:      slipJobs.Workers,
+			PollInterval: slipJobs.PollInterval,
+			MaxAttempts:  slipJobs.MaxAttempts,
+			Backoff:      slipJobs.Backoff,
+			MaxBackoff:   slipJobs.MaxBackoff,
+			Lease:        slipJobs.Lease,
+		},
+		Thumbnails: Thumbnails{
+			Size:        thumbnails.Size,
+			JPEGQuality: thumbnails.JPEGQuality,
+		},
 	}, nil
 }
 
+// positive refuses a duration of zero or less for the variable key, as the
+// tickers and timers pacing the background workers cannot run on one.
+func positive(opts env.Options, key string, d time.Duration) error {
+	if d <= 0 {
+		return fmt.Errorf("%s%s must be positive, got %s", opts.Prefix, key, d)
+	}
+
+	return nil
+}
+
 func Parse(envPrefix string) Config {
 	once.Do(func() {
 		var err error
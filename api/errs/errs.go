@@ -13,6 +13,8 @@ type ErrorResponse struct {
 
 var (
 	ErrInternalDatabaseError = errors.New("internal database error")
+	ErrUnauthorized          = errors.New("unauthorized")
+	ErrForbidden             = errors.New("forbidden")
 )
 
 const (
@@ -22,6 +24,10 @@ const (
 	gte      = "the value of %s must be greater than or equal %s"
 	lte      = "the value of %s must be less than or equal %s"
 	ltefield = "the value of %s value must be lower than or equal value of field %s"
+	nefield  = "the value of %s must differ from field %s"
+	iso4217  = "the value of %s must be an ISO 4217 currency code"
+	datetime = "the value of %s must be formatted as %s"
+	email    = "the value of %s must be an email address"
 	unknown  = "unknown error"
 )
 
@@ -31,7 +37,7 @@ func getErrMsg(fe validator.FieldError) string {
 		return fmt.Sprintf(required, fe.Field())
 	case "oneof":
 		return fmt.Sprintf(oneof, fe.Field(), fe.Param())
-	case "gt":
+	case "gt", "money_gt":
 		return fmt.Sprintf(gt, fe.Field(), fe.Param())
 	case "gte":
 		return fmt.Sprintf(gte, fe.Field(), fe.Param())
@@ -39,6 +45,14 @@ func getErrMsg(fe validator.FieldError) string {
 		return fmt.Sprintf(lte, fe.Field(), fe.Param())
 	case "ltefield":
 		return fmt.Sprintf(ltefield, fe.Field(), fe.Param())
+	case "nefield":
+		return fmt.Sprintf(nefield, fe.Field(), fe.Param())
+	case "iso4217":
+		return fmt.Sprintf(iso4217, fe.Field())
+	case "datetime":
+		return fmt.Sprintf(datetime, fe.Field(), fe.Param())
+	case "email":
+		return fmt.Sprintf(email, fe.Field())
 	}
 
 	return unknown
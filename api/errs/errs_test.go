@@ -73,9 +73,14 @@ func TestGetErrMsg(t *testing.T) {
 		{"required", "Name", "", "field Name is required"},
 		{"oneof", "State", "NY CA TX", "the value of State must be one of NY CA TX"},
 		{"gt", "Age", "18", "the value of Age must be greater than 18"},
+		{"money_gt", "Amount", "0", "the value of Amount must be greater than 0"},
 		{"gte", "Members", "1", "the value of Members must be greater than or equal 1"},
 		{"ltefield", "StartYear", "EndYear", "the value of StartYear value must be lower than or equal value of field EndYear"},
 		{"lte", "Age", "18", "the value of Age must be less than or equal 18"},
+		{"nefield", "Quote", "Base", "the value of Quote must differ from field Base"},
+		{"iso4217", "Base", "", "the value of Base must be an ISO 4217 currency code"},
+		{"email", "Email", "", "the value of Email must be an email address"},
+		{"datetime", "EffectiveDate", "2006-01-02", "the value of EffectiveDate must be formatted as 2006-01-02"},
 		{"unknown", "Field", "Param", unknown},
 	}
 
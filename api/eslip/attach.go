@@ -0,0 +1,328 @@
+package eslip
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSlipNotFound    = errors.New("slip not found")
+	ErrSlipNotAttached = errors.New("slip is not attached to the transaction")
+)
+
+var (
+	txOwnerStmt   = "SELECT spender_id FROM transaction WHERE id = $1 AND deleted_at IS NULL;"
+	slipOwnerStmt = "SELECT s.spender_id, COALESCE(j.service_key_id, 0) FROM slip s LEFT JOIN slip_job j ON j.key = s.key WHERE $1 IN (s.key, s.thumbnail_jpeg, s.thumbnail_webp)" +
+		" UNION ALL SELECT spender_id, COALESCE(service_key_id, 0) FROM slip_job WHERE key = $1;"
+	ownSlipStmt   = "SELECT id FROM slip WHERE key = $1 AND spender_id = $2;"
+	attachStmt    = "INSERT INTO transaction_slip (transaction_id, slip_id) VALUES ($1, $2) ON CONFLICT DO NOTHING;"
+	detachStmt    = "DELETE FROM transaction_slip WHERE transaction_id = $1 AND slip_id = (SELECT id FROM slip WHERE key = $2);"
+	touchTxStmt   = "UPDATE transaction SET version = version + 1 WHERE id = $1;"
+	purgeSlipStmt = "DELETE FROM slip s WHERE s.created_at < $1 AND NOT EXISTS (SELECT 1 FROM transaction_slip ts WHERE ts.slip_id = s.id) RETURNING s.key, s.thumbnail_jpeg, s.thumbnail_webp;"
+
+	// purgeJobStmt deletes settled jobs, reporting for each whether its file
+	// was left behind: a dead job never recorded a slip for it.
+	purgeJobStmt = "DELETE FROM slip_job j WHERE j.status IN ('succeeded', 'dead') AND j.updated_at < $1" +
+		" RETURNING j.key, j.status = 'dead' AND NOT EXISTS (SELECT 1 FROM slip s WHERE s.key = j.key);"
+)
+
+type AttachRequest struct {
+	Key string `json:"key"`
+}
+
+type AttachmentsResponse struct {
+	Attachments []transaction.Attachment `json:"attachments"`
+}
+
+// Attach attaches the slip named in the body to transaction :id and returns
+// the attachments of the transaction. Only slips of the spender owning the
+// transaction can be attached, and a slip exists only once the job
+// processing its upload has succeeded. The status is 201 when the slip was
+// attached and 200 when it already was.
+func (h handler) Attach(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var req AttachRequest
+	if err := c.Bind(&req); err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+	if err := checkKey(req.Key); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	id, ownerID, status, err := h.authorizeTx(c)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	var slipID int
+	err = h.db.QueryRowContext(ctx, ownSlipStmt, req.Key, ownerID).Scan(&slipID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("slip not found", zap.String("key", req.Key), zap.Int("spender_id", ownerID))
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrSlipNotFound))
+	}
+	if err != nil {
+		logger.Error("query slip error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	attached, err := h.changeAttachment(ctx, id, attachStmt, id, slipID)
+	if err != nil {
+		logger.Error("attach slip error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	tx := transaction.Transaction{ID: uint(id)}
+	if err := transaction.LoadAttachments(c, h.db, &tx); err != nil {
+		logger.Error("query attachments error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	res := AttachmentsResponse{Attachments: tx.Attachments}
+	if res.Attachments == nil {
+		res.Attachments = []transaction.Attachment{}
+	}
+	if !attached {
+		return c.JSON(http.StatusOK, res)
+	}
+
+	logger.Info("slip attached", zap.Int("transaction_id", id), zap.String("key", req.Key))
+	return c.JSON(http.StatusCreated, res)
+}
+
+// Detach detaches slip :key from transaction :id. The slip itself is kept
+// until Purge finds it attached to nothing.
+func (h handler) Detach(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	key := c.Param("key")
+	if err := checkKey(key); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	id, _, status, err := h.authorizeTx(c)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	detached, err := h.changeAttachment(ctx, id, detachStmt, id, key)
+	if err != nil {
+		logger.Error("detach slip error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	if !detached {
+		logger.Warn("slip not attached", zap.Int("transaction_id", id), zap.String("key", key))
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrSlipNotAttached))
+	}
+
+	logger.Info("slip detached", zap.Int("transaction_id", id), zap.String("key", key))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// changeAttachment runs stmt and, when it changed a row, moves the version of
+// transaction id on in the same database transaction, since its attachments
+// are part of what its ETag covers. It reports whether a row changed.
+func (h handler) changeAttachment(ctx context.Context, id int, stmt string, args ...any) (bool, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, touchTxStmt, id); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// authorizeTx reads the :id path parameter and checks the principal may act
+// on that transaction. It returns the transaction id and its owner. Service
+// callers allowed to attach slips may act on any transaction, as they attach
+// slips on behalf of spenders; only slips of the owner can be attached.
+func (h handler) authorizeTx(c echo.Context) (int, int, int, error) {
+	logger := mlog.L(c)
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Error("ID parameter is invalid", zap.Error(err))
+		return 0, 0, http.StatusBadRequest, err
+	}
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return 0, 0, http.StatusUnauthorized, errs.ErrUnauthorized
+	}
+
+	var ownerID sql.NullInt64
+	err = h.db.QueryRowContext(c.Request().Context(), txOwnerStmt, id).Scan(&ownerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("transaction not found", zap.Int("id", id))
+		return 0, 0, http.StatusNotFound, transaction.ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return 0, 0, http.StatusInternalServerError, err
+	}
+
+	if !p.CanAccess(int(ownerID.Int64)) && !(p.IsService() && p.HasScope(auth.ScopeAttachSlips)) {
+		logger.Warn("transaction belongs to another spender", zap.Int("id", id), zap.Int("spender_id", p.SpenderID))
+		return 0, 0, http.StatusForbidden, errs.ErrForbidden
+	}
+
+	return id, int(ownerID.Int64), http.StatusOK, nil
+}
+
+// authorizeSlip checks the principal may read the file stored under key: a
+// slip, one of its thumbnails or a slip still being processed. The spender
+// the slip belongs to, an admin and the service key that uploaded it may.
+// It returns the status to respond with when the principal may not.
+func (h handler) authorizeSlip(c echo.Context, key string) (int, error) {
+	logger := mlog.L(c)
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return http.StatusUnauthorized, errs.ErrUnauthorized
+	}
+
+	rows, err := h.db.QueryContext(c.Request().Context(), slipOwnerStmt, key)
+	if err != nil {
+		logger.Error("query slip owner error", zap.Error(err))
+		return http.StatusInternalServerError, err
+	}
+	defer rows.Close()
+
+	var found, allowed bool
+	for rows.Next() {
+		var spenderID, serviceKeyID int
+		if err := rows.Scan(&spenderID, &serviceKeyID); err != nil {
+			logger.Error("query slip owner error", zap.Error(err))
+			return http.StatusInternalServerError, err
+		}
+		found = true
+		uploader := p.IsService() && serviceKeyID != 0 && p.ServiceKeyID == serviceKeyID
+		allowed = allowed || uploader || p.CanAccess(spenderID)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("query slip owner error", zap.Error(err))
+		return http.StatusInternalServerError, err
+	}
+
+	switch {
+	case !found:
+		logger.Warn("slip not found", zap.String("key", key))
+		return http.StatusNotFound, ErrSlipNotFound
+	case !allowed:
+		logger.Warn("slip belongs to another spender", zap.String("key", key), zap.Int("spender_id", p.SpenderID))
+		return http.StatusForbidden, errs.ErrForbidden
+	}
+	return http.StatusOK, nil
+}
+
+// Purge deletes slips that were uploaded longer than retention ago and are
+// attached to no transaction, along with their files and thumbnails. Slips of soft-deleted
+// transactions stay attached until the transactions are purged. Jobs that
+// settled longer than retention ago are deleted too, with the files of those
+// that died, which no slip holds. A file that cannot be deleted is logged and
+// left behind without a slip. The count returned is of slips.
+func (h handler) Purge(retention time.Duration) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		logger := mlog.L(c)
+		ctx := c.Request().Context()
+
+		before := time.Now().Add(-retention)
+		rows, err := h.db.QueryContext(ctx, purgeSlipStmt, before)
+		if err != nil {
+			logger.Error("purge slips error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		defer rows.Close()
+
+		var keys []string
+		var purged int64
+		for rows.Next() {
+			var key string
+			var thumbJPEG, thumbWebP sql.NullString
+			if err := rows.Scan(&key, &thumbJPEG, &thumbWebP); err != nil {
+				logger.Error("purge slips error", zap.Error(err))
+				return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+			}
+			purged++
+			keys = append(keys, key)
+			for _, thumb := range []sql.NullString{thumbJPEG, thumbWebP} {
+				if thumb.Valid {
+					keys = append(keys, thumb.String)
+				}
+			}
+		}
+		if err := rows.Err(); err != nil {
+			logger.Error("purge slips error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		rows.Close()
+
+		jobKeys, jobs, err := h.purgeJobs(ctx, before)
+		if err != nil {
+			logger.Error("purge slip jobs error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		keys = append(keys, jobKeys...)
+
+		for _, key := range keys {
+			if err := h.store.Delete(ctx, key); err != nil {
+				logger.Warn("delete purged slip failed", zap.String("key", key), zap.Error(err))
+			}
+		}
+
+		logger.Info("purge successfully", zap.Int64("purged", purged), zap.Int64("jobs_purged", jobs), zap.Duration("retention", retention))
+		return c.JSON(http.StatusOK, transaction.PurgeResponse{Purged: purged})
+	}
+}
+
+// purgeJobs deletes the jobs that settled before the given time. It returns
+// the keys of the files of dead jobs and how many jobs it deleted.
+func (h handler) purgeJobs(ctx context.Context, before time.Time) ([]string, int64, error) {
+	rows, err := h.db.QueryContext(ctx, purgeJobStmt, before)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	var purged int64
+	for rows.Next() {
+		var key string
+		var orphan bool
+		if err := rows.Scan(&key, &orphan); err != nil {
+			return nil, 0, err
+		}
+		purged++
+		if orphan {
+			keys = append(keys, key)
+		}
+	}
+	return keys, purged, rows.Err()
+}
@@ -0,0 +1,240 @@
+package eslip
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+const attachmentsStmt = "SELECT ts.transaction_id, s.key, s.content_type, s.size, s.thumbnail_jpeg, s.thumbnail_webp, ts.created_at FROM transaction_slip ts JOIN slip s ON s.id = ts.slip_id WHERE ts.transaction_id = ANY($1) ORDER BY ts.created_at, s.id;"
+
+var attachmentCols = []string{"transaction_id", "key", "content_type", "size", "thumbnail_jpeg", "thumbnail_webp", "attached_at"}
+
+func newAttachRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/transactions/7/slips", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	return req
+}
+
+func expectTxOwner(mock sqlmock.Sqlmock, spenderID int) {
+	mock.ExpectQuery(txOwnerStmt).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(spenderID))
+}
+
+func TestAttach(t *testing.T) {
+	attachedAt := time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC)
+
+	t.Run("given an own slip should attach it and list the attachments", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 1)
+		mock.ExpectQuery(ownSlipStmt).WithArgs("k.png", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectBegin()
+		mock.ExpectExec(attachStmt).WithArgs(7, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(touchTxStmt).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(attachmentsStmt).WithArgs(pq.Array([]int64{7})).
+			WillReturnRows(sqlmock.NewRows(attachmentCols).AddRow(7, "k.png", "image/png", 70, nil, nil, attachedAt))
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newAttachRequest(`{"key": "k.png"}`))
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"attachments": [{"key": "k.png", "location": "/api/v1/slips/k.png", "content_type": "image/png", "size": 70, "attached_at": "2024-07-10T09:00:00Z"}]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a slip already attached should leave the transaction as it is", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 1)
+		mock.ExpectQuery(ownSlipStmt).WithArgs("k.png", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectBegin()
+		mock.ExpectExec(attachStmt).WithArgs(7, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		mock.ExpectQuery(attachmentsStmt).WithArgs(pq.Array([]int64{7})).
+			WillReturnRows(sqlmock.NewRows(attachmentCols).AddRow(7, "k.png", "image/png", 70, nil, nil, attachedAt))
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newAttachRequest(`{"key": "k.png"}`))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a slip of another spender should return not found", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 1)
+		mock.ExpectQuery(ownSlipStmt).WithArgs("theirs.png", 1).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newAttachRequest(`{"key": "theirs.png"}`))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"messages": ["slip not found"]}`, rec.Body.String())
+	})
+
+	t.Run("given a transaction of another spender should return forbidden", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 2)
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newAttachRequest(`{"key": "k.png"}`))
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("given an admin should attach a slip of the transaction owner", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 2)
+		mock.ExpectQuery(ownSlipStmt).WithArgs("k.png", 2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectBegin()
+		mock.ExpectExec(attachStmt).WithArgs(7, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(touchTxStmt).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(attachmentsStmt).WithArgs(pq.Array([]int64{7})).
+			WillReturnRows(sqlmock.NewRows(attachmentCols).AddRow(7, "k.png", "image/png", 70, nil, nil, attachedAt))
+		e := newEchoAs(New(db, nil, limits, time.Minute), auth.Principal{SpenderID: 1, Role: auth.RoleAdmin})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newAttachRequest(`{"key": "k.png"}`))
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a service key allowed to attach slips should attach a slip of the transaction owner", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 2)
+		mock.ExpectQuery(ownSlipStmt).WithArgs("k.png", 2).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+		mock.ExpectBegin()
+		mock.ExpectExec(attachStmt).WithArgs(7, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(touchTxStmt).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectQuery(attachmentsStmt).WithArgs(pq.Array([]int64{7})).
+			WillReturnRows(sqlmock.NewRows(attachmentCols).AddRow(7, "k.png", "image/png", 70, nil, nil, attachedAt))
+		e := newEchoAs(New(db, nil, limits, time.Minute), auth.Principal{Role: auth.RoleService, ServiceKeyID: 4, Scopes: []string{auth.ScopeAttachSlips}})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newAttachRequest(`{"key": "k.png"}`))
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a service key not allowed to attach slips should return forbidden", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 2)
+		e := newEchoAs(New(db, nil, limits, time.Minute), auth.Principal{Role: auth.RoleService, ServiceKeyID: 4, Scopes: []string{auth.ScopeCreateTransactions}})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newAttachRequest(`{"key": "k.png"}`))
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given an invalid key should return bad request", func(t *testing.T) {
+		e := newEcho(New(nil, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newAttachRequest(`{"key": "../k.png"}`))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestDetach(t *testing.T) {
+	t.Run("given an attached slip should detach it", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 1)
+		mock.ExpectBegin()
+		mock.ExpectExec(detachStmt).WithArgs(7, "k.png").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(touchTxStmt).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/transactions/7/slips/k.png", nil))
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a service key allowed to attach slips should detach it", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 2)
+		mock.ExpectBegin()
+		mock.ExpectExec(detachStmt).WithArgs(7, "k.png").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(touchTxStmt).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		e := newEchoAs(New(db, nil, limits, time.Minute), auth.Principal{Role: auth.RoleService, ServiceKeyID: 4, Scopes: []string{auth.ScopeAttachSlips}})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/transactions/7/slips/k.png", nil))
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a slip not attached should return not found", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectTxOwner(mock, 1)
+		mock.ExpectBegin()
+		mock.ExpectExec(detachStmt).WithArgs(7, "k.png").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/transactions/7/slips/k.png", nil))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"messages": ["slip is not attached to the transaction"]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPurge(t *testing.T) {
+	t.Run("given orphan slips and settled jobs past retention should delete them with the files no slip holds", func(t *testing.T) {
+		store, _ := NewLocalStore(t.TempDir())
+		for _, key := range []string{"old.png", "old.thumb.jpg", "old.thumb.webp", "dead.png", "kept.png"} {
+			store.Put(context.Background(), key, bytes.NewReader([]byte("png")), 3, "image/png")
+		}
+		db, mock := newMock(t)
+		mock.ExpectQuery(purgeSlipStmt).WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"key", "thumbnail_jpeg", "thumbnail_webp"}).
+				AddRow("old.png", "old.thumb.jpg", "old.thumb.webp").
+				AddRow("gone.pdf", nil, nil))
+		mock.ExpectQuery(purgeJobStmt).WithArgs(sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"key", "orphan"}).
+				AddRow("dead.png", true).
+				AddRow("kept.png", false))
+		e := newEchoAs(New(db, store, limits, time.Minute), auth.Principal{SpenderID: 1, Role: auth.RoleAdmin})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/slips/purge", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"purged": 2}`, rec.Body.String())
+		for _, key := range []string{"old.png", "old.thumb.jpg", "old.thumb.webp", "dead.png"} {
+			_, err := store.Open(context.Background(), key)
+			assert.ErrorIs(t, err, ErrBlobNotFound, key)
+		}
+		obj, err := store.Open(context.Background(), "kept.png")
+		if assert.NoError(t, err) {
+			obj.Body.Close()
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,70 @@
+package eslip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+)
+
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+var (
+	ErrBlobNotFound   = errors.New("slip not found")
+	ErrInvalidBlobKey = errors.New("slip key must be a non-empty name without slashes or dot segments")
+)
+
+// Object is a stored blob opened for reading. The caller closes Body.
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// BlobStore keeps uploaded slips. Keys are flat names; stores reject keys
+// that could escape their namespace.
+type BlobStore interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Open(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by stores that can hand out a short-lived URL to
+// an object, so downloads go straight to the store instead of through us.
+type Presigner interface {
+	PresignGet(key string, ttl time.Duration) (string, error)
+}
+
+// NewBlobStore builds the store named by cfg.Driver.
+func NewBlobStore(cfg config.Storage) (BlobStore, error) {
+	switch cfg.Driver {
+	case StorageLocal, "":
+		return NewLocalStore(cfg.LocalDir)
+	case StorageS3:
+		return NewS3Store(S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+}
+
+func checkKey(key string) error {
+	if key == "" || key == "." || key == ".." || strings.ContainsAny(key, `/\`) {
+		return ErrInvalidBlobKey
+	}
+
+	return nil
+}
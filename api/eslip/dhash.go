@@ -0,0 +1,57 @@
+package eslip
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+)
+
+// dHash is the difference hash of img: the image shrunk to 9x8 grey cells,
+// with one bit per pair of horizontally adjacent cells set when the left one
+// is brighter. Re-encoding, resizing or recompressing a picture, as chat apps
+// do, leaves the hash the same or a few bits away.
+func dHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	var cells [h][w]float64
+
+	b := img.Bounds()
+	for cy := 0; cy < h; cy++ {
+		y0 := b.Min.Y + cy*b.Dy()/h
+		y1 := max(b.Min.Y+(cy+1)*b.Dy()/h, y0+1)
+		for cx := 0; cx < w; cx++ {
+			x0 := b.Min.X + cx*b.Dx()/w
+			x1 := max(b.Min.X+(cx+1)*b.Dx()/w, x0+1)
+
+			// Large photos are sampled on a grid of at most 32x32 points per
+			// cell; the average barely moves and the cost stays bounded.
+			sx, sy := max((x1-x0)/32, 1), max((y1-y0)/32, 1)
+			var sum, n float64
+			for y := y0; y < y1 && y < b.Max.Y; y += sy {
+				for x := x0; x < x1 && x < b.Max.X; x += sx {
+					sum += float64(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+					n++
+				}
+			}
+			if n > 0 {
+				cells[cy][cx] = sum / n
+			}
+		}
+	}
+
+	var hash uint64
+	for cy := 0; cy < h; cy++ {
+		for cx := 0; cx < w-1; cx++ {
+			hash <<= 1
+			if cells[cy][cx] > cells[cy][cx+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// hammingDistance counts the bits in which two hashes differ.
+func hammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
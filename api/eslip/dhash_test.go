@@ -0,0 +1,43 @@
+package eslip
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDHash(t *testing.T) {
+	slip := openPNG(t, "../../e-slip1.png")
+
+	t.Run("given the slip recompressed and resized should hash within a few bits", func(t *testing.T) {
+		var b bytes.Buffer
+		assert.NoError(t, jpeg.Encode(&b, slip, &jpeg.Options{Quality: 40}))
+		recompressed, err := jpeg.Decode(&b)
+		assert.NoError(t, err)
+
+		half := image.NewRGBA(image.Rect(0, 0, slip.Bounds().Dx()/2, slip.Bounds().Dy()/2))
+		for y := 0; y < half.Bounds().Dy(); y++ {
+			for x := 0; x < half.Bounds().Dx(); x++ {
+				half.Set(x, y, slip.At(2*x, 2*y))
+			}
+		}
+
+		assert.LessOrEqual(t, hammingDistance(dHash(slip), dHash(recompressed)), DefaultMaxDistance)
+		assert.LessOrEqual(t, hammingDistance(dHash(slip), dHash(half)), DefaultMaxDistance)
+	})
+
+	t.Run("given a different picture should hash far apart", func(t *testing.T) {
+		other := image.NewGray(slip.Bounds())
+		for y := 0; y < other.Bounds().Dy(); y++ {
+			for x := 0; x < other.Bounds().Dx(); x++ {
+				other.SetGray(x, y, color.Gray{Y: uint8((x*7 + y*3) % 256)})
+			}
+		}
+
+		assert.Greater(t, hammingDistance(dHash(slip), dHash(other)), DefaultMaxDistance)
+	})
+}
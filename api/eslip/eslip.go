@@ -1,72 +1,401 @@
 package eslip
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/google/uuid"
+	"github.com/kkgo-software-engineering/workshop/mlog"
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
 )
 
-func Upload(c echo.Context) error {
+// RouteGet names the route that serves a stored slip. Job results,
+// near-duplicate reports and transaction attachments reverse it to build the
+// locations they return.
+const RouteGet = transaction.RouteSlip
+
+// maxDecodePixels bounds the images decoded to scrub them, read their QR
+// code and hash their picture, so a small file cannot declare dimensions that would take
+// gigabytes to decode. Scrubbing one that large still takes a few hundred
+// megabytes, which is why Limits.MaxScrubs bounds how many are scrubbed at
+// once.
+const maxDecodePixels = 40_000_000
+
+// Limits bound what one upload request may carry. Sizes are in bytes.
+// MaxScrubs bounds how many images all requests decode and encode again at
+// once; a request waits for its turn, and gives up when it is cancelled.
+type Limits struct {
+	MaxFileSize    int64
+	MaxRequestSize int64
+	MaxFiles       int
+	MaxScrubs      int
+}
+
+// accepted lists the slip formats Upload stores, by the MIME type sniffed
+// from their content, with the extension their key gets.
+var accepted = []struct{ mime, ext string }{
+	{"image/jpeg", ".jpg"},
+	{"image/png", ".png"},
+	{"application/pdf", ".pdf"},
+}
+
+var (
+	ErrNoImages        = errors.New("field images must contain at least one file")
+	ErrEmptyFile       = errors.New("file is empty")
+	ErrUnsupportedType = errors.New("only JPEG, PNG and PDF files are accepted")
+	ErrUnsupportedHEIC = fmt.Errorf("HEIC images cannot be rid of their metadata yet; %w", ErrUnsupportedType)
+	ErrUseCaptureTime  = errors.New("field use_capture_time must be true or false")
+)
+
+// UploadResult is what processing one uploaded slip found. QR is set when
+// the slip is an image carrying a bank's verification QR code, and Draft is
+// the transaction read off a new image slip when an extractor is configured.
+// Duplicate is set when the spender had already uploaded the same file: the
+// slip described is the one stored then, with the transaction it belongs to,
+// and the new copy is dropped.
+type UploadResult struct {
+	Filename    string                   `json:"filename"`
+	Key         string                   `json:"key,omitempty"`
+	Location    string                   `json:"location,omitempty"`
+	ContentType string                   `json:"content_type,omitempty"`
+	Size        int64                    `json:"size,omitempty"`
+	QR          *SlipQR                  `json:"qr,omitempty"`
+	Draft       *Draft                   `json:"draft,omitempty"`
+	Duplicate   bool                     `json:"duplicate,omitempty"`
+	Transaction *transaction.Transaction `json:"transaction,omitempty"`
+}
+
+// QueuedFile reports one file of an upload: either the job that processes it,
+// with the location reporting the job, or why the file was rejected.
+type QueuedFile struct {
+	Filename string `json:"filename"`
+	JobID    int    `json:"job_id,omitempty"`
+	Location string `json:"location,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type UploadResponse struct {
+	Message   string       `json:"message"`
+	Locations string       `json:"locations"`
+	Files     []QueuedFile `json:"files"`
+}
+
+type handler struct {
+	db         *sql.DB
+	store      BlobStore
+	limits     Limits
+	presignTTL time.Duration
+	scrubs     chan struct{}
+}
+
+func New(db *sql.DB, store BlobStore, limits Limits, presignTTL time.Duration) *handler {
+	scrubs := make(chan struct{}, max(limits.MaxScrubs, 1))
+	return &handler{db: db, store: store, limits: limits, presignTTL: presignTTL, scrubs: scrubs}
+}
+
+// Upload accepts the files of the multipart field "images" for a spender;
+// admins and service callers name the spender in the field "spender_id".
+// Each file is checked on its own: its type is sniffed from its content,
+// never taken from the client, its metadata is scrubbed, and it is stored
+// under a fresh UUID key and queued for a Processor, so the request does not
+// wait on hashing or OCR. When the field "use_capture_time" is true, the time
+// each picture was taken dates its draft transaction; nothing else of its
+// metadata is kept.
+// Rejected files are reported next to the queued ones, whose jobs report the
+// result; the status is 202 when every file was queued, 207 when only some
+// were, 415 when none were and every file was of a type not accepted, and
+// 400 when none were otherwise.
+func (h handler) Upload(c echo.Context) error {
+	logger := mlog.L(c)
+
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, h.limits.MaxRequestSize)
+
 	form, err := c.MultipartForm()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+			"message": "Request too large",
+			"error":   fmt.Sprintf("request must be at most %d bytes", h.limits.MaxRequestSize),
+		})
+	}
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{
 			"message": "Failed to parse form",
 			"error":   err.Error(),
 		})
 	}
+	defer form.RemoveAll()
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+	}
+	var requested int
+	if v := c.FormValue("spender_id"); v != "" {
+		if requested, err = strconv.Atoi(v); err != nil {
+			logger.Error("spender_id is invalid", zap.String("spender_id", v))
+			return c.JSON(http.StatusBadRequest, errs.ParseError(transaction.ErrSpenderRequired))
+		}
+	}
+	spenderID := p.OwnerFor(requested)
+	if spenderID == 0 {
+		logger.Error("spender_id is required")
+		return c.JSON(http.StatusBadRequest, errs.ParseError(transaction.ErrSpenderRequired))
+	}
+
+	var useCaptureTime bool
+	if v := c.FormValue("use_capture_time"); v != "" {
+		if useCaptureTime, err = strconv.ParseBool(v); err != nil {
+			logger.Error("use_capture_time is invalid", zap.String("use_capture_time", v))
+			return c.JSON(http.StatusBadRequest, errs.ParseError(ErrUseCaptureTime))
+		}
+	}
+
 	images := form.File["images"]
+	if len(images) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "No image to upload",
+			"error":   ErrNoImages.Error(),
+		})
+	}
+	if len(images) > h.limits.MaxFiles {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"message": "Too many files",
+			"error":   fmt.Sprintf("at most %d files may be uploaded at once", h.limits.MaxFiles),
+		})
+	}
+
+	res := UploadResponse{Files: make([]QueuedFile, len(images))}
 	var locations []string
-	for _, image := range images {
-		fmt.Printf("Uploading file: %+v\n", image.Filename)
-		src, err := image.Open()
+	unsupported := 0
+	for i, image := range images {
+		queued, err := h.queueFile(c, spenderID, p, useCaptureTime, image)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, map[string]string{
-				"message": "Failed to parse form",
-				"error":   err.Error(),
-			})
+			logger.Warn("slip rejected", zap.String("filename", image.Filename), zap.Error(err))
+			queued.Error = err.Error()
+			if errors.Is(err, ErrUnsupportedType) {
+				unsupported++
+			}
+		} else {
+			locations = append(locations, queued.Location)
 		}
-		defer src.Close()
+		res.Files[i] = queued
+	}
+	res.Locations = strings.Join(locations, ",")
 
-		// upload to AWS S3 bucket
-		loc, err := UploadToS3(c, image.Filename, src)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"message": "Failed to upload image",
-				"error":   err.Error(),
-			})
+	switch len(locations) {
+	case len(images):
+		res.Message = "Image uploaded successfully"
+		return c.JSON(http.StatusAccepted, res)
+	case 0:
+		res.Message = "No image was uploaded"
+		if unsupported == len(images) {
+			return c.JSON(http.StatusUnsupportedMediaType, res)
 		}
-		locations = append(locations, loc)
+		return c.JSON(http.StatusBadRequest, res)
+	default:
+		res.Message = "Some images were not uploaded"
+		return c.JSON(http.StatusMultiStatus, res)
 	}
+}
+
+// queueFile checks one uploaded file, scrubs it, stores it for spenderID and
+// queues the job that processes it on behalf of p, the spender or service
+// key uploading it. useCaptureTime keeps the time the picture was taken
+// for the job.
+func (h handler) queueFile(c echo.Context, spenderID int, p auth.Principal, useCaptureTime bool, image *multipart.FileHeader) (QueuedFile, error) {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+	queued := QueuedFile{Filename: image.Filename}
 
-	return c.JSON(http.StatusOK, map[string]string{
-		"message":   "Image uploaded successfully",
-		"locations": strings.Join(locations, ","),
-	})
+	if image.Size == 0 {
+		return queued, ErrEmptyFile
+	}
+	if image.Size > h.limits.MaxFileSize {
+		return queued, fmt.Errorf("file is %d bytes, larger than the %d byte limit", image.Size, h.limits.MaxFileSize)
+	}
+
+	src, err := image.Open()
+	if err != nil {
+		return queued, err
+	}
+	defer src.Close()
+
+	mtype, ext, err := sniff(src)
+	if err != nil {
+		return queued, err
+	}
+
+	select {
+	case h.scrubs <- struct{}{}:
+	case <-ctx.Done():
+		return queued, fmt.Errorf("waiting to scrub file: %w", ctx.Err())
+	}
+	clean, err := scrub(src, mtype)
+	<-h.scrubs
+	if err != nil {
+		return queued, err
+	}
+	size := int64(len(clean.Body))
+
+	key := uuid.NewString() + ext
+	if err := h.store.Put(ctx, key, bytes.NewReader(clean.Body), size, mtype); err != nil {
+		logger.Error("store slip failed", zap.String("key", key), zap.Error(err))
+		return queued, errors.New("failed to store file")
+	}
+
+	j := job{SpenderID: spenderID, Key: key, Filename: image.Filename, ContentType: mtype, Size: size, UploadedBy: p.SpenderID, ServiceKeyID: p.ServiceKeyID}
+	if useCaptureTime && !clean.CapturedAt.IsZero() {
+		j.CapturedAt = sql.NullTime{Time: clean.CapturedAt, Valid: true}
+	}
+	id, err := enqueue(ctx, h.db, j)
+	if err != nil {
+		logger.Error("queue slip job failed", zap.String("key", key), zap.Error(err))
+		h.deleteBlob(c, key)
+		return queued, errors.New("failed to store file")
+	}
+	logger.Info("slip queued", zap.Int("job_id", id), zap.String("key", key), zap.String("content_type", mtype), zap.Int64("size", size))
+
+	queued.JobID = id
+	queued.Location = c.Echo().Reverse(RouteJob, id)
+	return queued, nil
+}
+
+// deleteBlob removes a blob that was stored but not queued. A failure only
+// leaves an unreferenced blob behind, so it is logged and not returned.
+func (h handler) deleteBlob(c echo.Context, key string) {
+	if err := h.store.Delete(c.Request().Context(), key); err != nil {
+		mlog.L(c).Warn("delete unqueued slip failed", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// decodeImage decodes the image in f. f is left at an arbitrary offset.
+func decodeImage(f io.ReadSeeker) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > maxDecodePixels {
+		return nil, fmt.Errorf("image is %dx%d, too large to decode", cfg.Width, cfg.Height)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// hashFile returns the hex SHA-256 of f from its start and rewinds it.
+func hashFile(f io.ReadSeeker) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sniff detects the type of f from its content and rewinds it. Types other
+// than the accepted ones are refused. HEIC is among them until it can be
+// encoded again like JPEG and PNG are, as blanking its metadata in place
+// leaves too much behind.
+func sniff(f io.ReadSeeker) (string, string, error) {
+	m, err := mimetype.DetectReader(f)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+
+	for _, a := range accepted {
+		if m.Is(a.mime) {
+			return a.mime, a.ext, nil
+		}
+	}
+
+	if m.Is("image/heic") || m.Is("image/heif") {
+		return "", "", ErrUnsupportedHEIC
+	}
+	return "", "", fmt.Errorf("file content is %s; %w", m.String(), ErrUnsupportedType)
 }
 
-func UploadToS3(c echo.Context, filename string, src multipart.File) (string, error) {
-	// Assume that the file is uploaded to S3 bucket successfully
-	return "location/on/s3/bucket/" + filename, nil
-	// Create an AWS session
-	// sess, err := session.NewSession(&aws.Config{
-	// 	Region: aws.String(os.Getenv("AWS_REGION")),
-	// })
-	// if err != nil {
-	// 	return "", err
-	// }
-
-	// Upload the file to S3
-	// result, err = s3.New(sess).PutObject(&s3.PutObjectInput{
-	// 	Bucket: aws.String(os.Getenv("AWS_BUCKET")),
-	// 	Key:    aws.String(filename),
-	// 	Body:   src,
-	// })
-	// if err != nil {
-	// 	return "", err
-	// }
-
-	// return result.Location, nil
+// Get serves the slip or thumbnail stored under :key to those who may see
+// the slip. Stores that can presign a URL get a redirect there instead, so
+// the bytes do not pass through this service.
+func (h handler) Get(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	key := c.Param("key")
+	if err := checkKey(key); err != nil {
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+	if status, err := h.authorizeSlip(c, key); err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	if p, ok := h.store.(Presigner); ok {
+		url, err := p.PresignGet(key, h.presignTTL)
+		if err != nil {
+			logger.Error("presign slip failed", zap.String("key", key), zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		return c.Redirect(http.StatusTemporaryRedirect, url)
+	}
+
+	obj, err := h.store.Open(ctx, key)
+	if errors.Is(err, ErrBlobNotFound) {
+		logger.Warn("slip not found", zap.String("key", key))
+		return c.JSON(http.StatusNotFound, errs.ParseError(err))
+	}
+	if err != nil {
+		logger.Error("open slip failed", zap.String("key", key), zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	defer obj.Body.Close()
+
+	res := c.Response()
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	if obj.ContentType != "" {
+		res.Header().Set(echo.HeaderContentType, obj.ContentType)
+	}
+
+	if rs, ok := obj.Body.(io.ReadSeeker); ok {
+		http.ServeContent(res, c.Request(), key, obj.ModTime, rs)
+		return nil
+	}
+
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = echo.MIMEOctetStream
+	}
+	return c.Stream(http.StatusOK, contentType, obj.Body)
 }
@@ -1,32 +1,514 @@
 package eslip
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestUploadToS3(t *testing.T) {
-	t.Run("should able to upload image to S3 bucket", func(t *testing.T) {
-		f, _ := os.CreateTemp("", "eslip1.jpg")
-		defer f.Close()
-		defer os.Remove(f.Name())
+type upload struct{ name, content string }
 
-		e := echo.New()
-		defer e.Close()
+func newUploadRequest(t *testing.T, files ...upload) *http.Request {
+	return newUploadForm(t, nil, files...)
+}
+
+func newUploadForm(t *testing.T, fields map[string]string, files ...upload) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, value := range fields {
+		w.WriteField(name, value)
+	}
+	for _, f := range files {
+		part, err := w.CreateFormFile("images", f.name)
+		assert.NoError(t, err)
+		part.Write([]byte(f.content))
+	}
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/upload", &body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+var limits = Limits{MaxFileSize: 1 << 20, MaxRequestSize: 4 << 20, MaxFiles: 3}
+
+var spender = auth.Principal{SpenderID: 1, Role: auth.RoleSpender}
+
+func newEcho(h *handler) *echo.Echo {
+	return newEchoAs(h, spender)
+}
+
+func newEchoAs(h *handler, p auth.Principal) *echo.Echo {
+	as := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth.SetPrincipal(c, p)
+			return next(c)
+		}
+	}
+
+	e := echo.New()
+	e.POST("/api/v1/upload", h.Upload, as)
+	e.GET("/api/v1/slips/duplicates", h.NearDuplicates, as)
+	e.GET("/api/v1/slips/jobs/:id", h.GetJob, as).Name = RouteJob
+	e.GET("/api/v1/slips/:key", h.Get, as).Name = RouteGet
+	e.POST("/api/v1/slips/purge", h.Purge(time.Hour), as)
+	e.POST("/api/v1/transactions/:id/slips", h.Attach, as)
+	e.DELETE("/api/v1/transactions/:id/slips/:key", h.Detach, as)
+	return e
+}
+
+func newMock(t *testing.T) (*sql.DB, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	assert.NoError(t, err)
+	return db, mock
+}
+
+var (
+	slipCols = []string{"key", "content_type", "size", "transaction_id"}
+	txCols   = []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+)
+
+// expectEnqueue expects a file of spenderID uploaded by spender 1 to be
+// queued as job id, with no service key and no capture time.
+func expectEnqueue(mock sqlmock.Sqlmock, spenderID int, filename, contentType string, id int) {
+	mock.ExpectQuery(enqueueStmt).
+		WithArgs(spenderID, sqlmock.AnyArg(), filename, contentType, sqlmock.AnyArg(), 1, 0, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+}
+
+func pngImage() string {
+	var b bytes.Buffer
+	png.Encode(&b, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	return b.String()
+}
+
+func jpegImage() string {
+	var b bytes.Buffer
+	jpeg.Encode(&b, image.NewRGBA(image.Rect(0, 0, 2, 2)), nil)
+	return b.String()
+}
+
+const pdfDocument = "%PDF-1.4\n1 0 obj << >> endobj\ntrailer << >>\n%%EOF\n"
+
+func decodeUpload(t *testing.T, rec *httptest.ResponseRecorder) UploadResponse {
+	var res UploadResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	return res
+}
+
+func TestUpload(t *testing.T) {
+	t.Run("given supported files should store them and queue a job for each", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectEnqueue(mock, 1, "eslip1.png", "image/png", 11)
+		expectEnqueue(mock, 1, "receipt.jpeg", "image/jpeg", 12)
+		expectEnqueue(mock, 1, "statement", "application/pdf", 13)
+		dir := t.TempDir()
+		store, _ := NewLocalStore(dir)
+		e := newEcho(New(db, store, limits, time.Minute))
 
-		req := httptest.NewRequest(http.MethodPost, "/", nil)
 		rec := httptest.NewRecorder()
-		c := e.NewContext(req, rec)
+		e.ServeHTTP(rec, newUploadRequest(t,
+			upload{"eslip1.png", pngImage()},
+			upload{"../../receipt.jpeg", jpegImage()},
+			upload{"statement", pdfDocument},
+		))
 
-		loc, err := UploadToS3(c, "eslip1.jpg", f)
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		res := decodeUpload(t, rec)
+		assert.Equal(t, "Image uploaded successfully", res.Message)
+		assert.Equal(t, []QueuedFile{
+			{Filename: "eslip1.png", JobID: 11, Location: "/api/v1/slips/jobs/11"},
+			{Filename: "receipt.jpeg", JobID: 12, Location: "/api/v1/slips/jobs/12"},
+			{Filename: "statement", JobID: 13, Location: "/api/v1/slips/jobs/13"},
+		}, res.Files)
+		assert.Equal(t, "/api/v1/slips/jobs/11,/api/v1/slips/jobs/12,/api/v1/slips/jobs/13", res.Locations)
 
-		assert.NoError(t, err)
-		assert.Equal(t, "location/on/s3/bucket/eslip1.jpg", loc)
+		entries, _ := os.ReadDir(dir)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		assert.Len(t, names, 3)
+		for _, ext := range []string{".png", ".jpg", ".pdf"} {
+			assert.Condition(t, func() bool {
+				for _, n := range names {
+					if strings.HasSuffix(n, ext) && len(n) == 36+len(ext) {
+						return true
+					}
+				}
+				return false
+			}, "a key ending in %s", ext)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given the job cannot be queued should delete the stored file", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(enqueueStmt).WillReturnError(errors.New("connection reset"))
+		dir := t.TempDir()
+		store, _ := NewLocalStore(dir)
+		e := newEcho(New(db, store, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t, upload{"eslip1.png", pngImage()}))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "failed to store file", decodeUpload(t, rec).Files[0].Error)
+		entries, _ := os.ReadDir(dir)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("given an admin naming a spender should queue the slip for that spender", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectEnqueue(mock, 5, "eslip1.png", "image/png", 11)
+		store, _ := NewLocalStore(t.TempDir())
+		e := newEchoAs(New(db, store, limits, time.Minute), auth.Principal{SpenderID: 1, Role: auth.RoleAdmin})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadForm(t, map[string]string{"spender_id": "5"}, upload{"eslip1.png", pngImage()}))
+
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a service key naming a spender should queue the slip with the key that uploaded it", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(enqueueStmt).
+			WithArgs(5, sqlmock.AnyArg(), "eslip1.png", "image/png", sqlmock.AnyArg(), 0, 4, nil).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+		store, _ := NewLocalStore(t.TempDir())
+		e := newEchoAs(New(db, store, limits, time.Minute), auth.Principal{Role: auth.RoleService, ServiceKeyID: 4, Scopes: []string{auth.ScopeAttachSlips}})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadForm(t, map[string]string{"spender_id": "5"}, upload{"eslip1.png", pngImage()}))
+
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a photo with EXIF should store it without and keep its capture time when asked", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(enqueueStmt).
+			WithArgs(1, sqlmock.AnyArg(), "receipt.jpg", "image/jpeg", sqlmock.AnyArg(), 1, 0, time.Date(2024, 7, 10, 9, 30, 0, 0, time.UTC)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+		dir := t.TempDir()
+		store, _ := NewLocalStore(dir)
+		e := newEcho(New(db, store, limits, time.Minute))
+		photo := withJPEGExif(jpegImage(), exifTIFF(binary.LittleEndian, 1, "2024:07:10 09:30:00"))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadForm(t, map[string]string{"use_capture_time": "true"}, upload{"receipt.jpg", photo}))
+
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		entries, _ := os.ReadDir(dir)
+		if assert.Len(t, entries, 1) {
+			stored, _ := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+			assert.Nil(t, jpegExif(stored))
+			assert.NotContains(t, string(stored), "2024:07:10")
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a photo with EXIF and no use_capture_time should not keep its capture time", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectEnqueue(mock, 1, "receipt.jpg", "image/jpeg", 11)
+		store, _ := NewLocalStore(t.TempDir())
+		e := newEcho(New(db, store, limits, time.Minute))
+		photo := withJPEGExif(jpegImage(), exifTIFF(binary.LittleEndian, 1, "2024:07:10 09:30:00"))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t, upload{"receipt.jpg", photo}))
+
+		assert.Equal(t, http.StatusAccepted, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given every scrub taken until the request is cancelled should reject the files", func(t *testing.T) {
+		h := New(nil, failingStore{}, limits, time.Minute)
+		h.scrubs <- struct{}{}
+		e := newEcho(h)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t, upload{"eslip1.png", pngImage()}).WithContext(ctx))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "waiting to scrub file: context canceled", decodeUpload(t, rec).Files[0].Error)
+	})
+
+	t.Run("given an invalid use_capture_time should return bad request", func(t *testing.T) {
+		e := newEcho(New(nil, failingStore{}, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadForm(t, map[string]string{"use_capture_time": "sometimes"}, upload{"eslip1.png", pngImage()}))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages": ["field use_capture_time must be true or false"]}`, rec.Body.String())
+	})
+
+	t.Run("given a service caller without spender_id should return bad request", func(t *testing.T) {
+		e := newEchoAs(New(nil, failingStore{}, limits, time.Minute), auth.Principal{Role: auth.RoleService})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t, upload{"eslip1.png", pngImage()}))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages": ["field spender_id is required"]}`, rec.Body.String())
+	})
+
+	t.Run("given some rejected files should queue the rest and explain each rejection", func(t *testing.T) {
+		store, _ := NewLocalStore(t.TempDir())
+		db, mock := newMock(t)
+		expectEnqueue(mock, 1, "eslip1.png", "image/png", 11)
+		e := newEcho(New(db, store, Limits{MaxFileSize: 200, MaxRequestSize: 4 << 20, MaxFiles: 5}, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t,
+			upload{"eslip1.png", pngImage()},
+			upload{"eslip2.png", "<html>not an image</html>"},
+			upload{"empty.png", ""},
+			upload{"huge.pdf", pdfDocument + strings.Repeat(" ", 200)},
+			upload{"broken.jpg", jpegImage()[:40]},
+		))
+
+		assert.Equal(t, http.StatusMultiStatus, rec.Code)
+		res := decodeUpload(t, rec)
+		assert.Equal(t, "Some images were not uploaded", res.Message)
+		assert.Equal(t, 11, res.Files[0].JobID)
+		assert.Equal(t, res.Files[0].Location, res.Locations)
+		assert.Equal(t, "file content is text/html; charset=utf-8; only JPEG, PNG and PDF files are accepted", res.Files[1].Error)
+		assert.Equal(t, "file is empty", res.Files[2].Error)
+		assert.Equal(t, "file is 250 bytes, larger than the 200 byte limit", res.Files[3].Error)
+		assert.ErrorContains(t, errors.New(res.Files[4].Error), ErrUnreadableImage.Error())
+		for _, f := range res.Files[1:] {
+			assert.Zero(t, f.JobID)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given only rejected files should return bad request", func(t *testing.T) {
+		store, _ := NewLocalStore(t.TempDir())
+		e := newEcho(New(nil, store, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t, upload{"eslip1.gif", "GIF89a"}, upload{"empty.png", ""}))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		res := decodeUpload(t, rec)
+		assert.Equal(t, "No image was uploaded", res.Message)
+		assert.ErrorContains(t, errors.New(res.Files[0].Error), ErrUnsupportedType.Error())
+	})
+
+	t.Run("given only files of types not accepted should return unsupported media type", func(t *testing.T) {
+		store, _ := NewLocalStore(t.TempDir())
+		e := newEcho(New(nil, store, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t,
+			upload{"IMG_0001.HEIC", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"},
+			upload{"eslip1.gif", "GIF89a"},
+		))
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		res := decodeUpload(t, rec)
+		assert.Equal(t, "No image was uploaded", res.Message)
+		assert.Equal(t, "HEIC images cannot be rid of their metadata yet; only JPEG, PNG and PDF files are accepted", res.Files[0].Error)
+		assert.ErrorContains(t, errors.New(res.Files[1].Error), ErrUnsupportedType.Error())
+	})
+
+	t.Run("given more files than allowed should reject the request", func(t *testing.T) {
+		e := newEcho(New(nil, failingStore{}, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t,
+			upload{"1.png", pngImage()}, upload{"2.png", pngImage()},
+			upload{"3.png", pngImage()}, upload{"4.png", pngImage()},
+		))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"message": "Too many files", "error": "at most 3 files may be uploaded at once"}`, rec.Body.String())
+	})
+
+	t.Run("given no files should return bad request", func(t *testing.T) {
+		e := newEcho(New(nil, failingStore{}, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("given a request over the size limit should return request entity too large", func(t *testing.T) {
+		e := newEcho(New(nil, failingStore{}, Limits{MaxFileSize: 1 << 20, MaxRequestSize: 1024, MaxFiles: 3}, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t, upload{"big.pdf", pdfDocument + strings.Repeat(" ", 4096)}))
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.JSONEq(t, `{"message": "Request too large", "error": "request must be at most 1024 bytes"}`, rec.Body.String())
+	})
+
+	t.Run("given the store fails should report the file as not stored", func(t *testing.T) {
+		e := newEcho(New(nil, failingStore{}, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, newUploadRequest(t, upload{"eslip1.png", pngImage()}))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		res := decodeUpload(t, rec)
+		assert.Equal(t, "failed to store file", res.Files[0].Error)
+	})
+}
+
+// expectSlipOwner expects the owner of the file stored under key to be
+// looked up, finding the given spender and service key pairs.
+func expectSlipOwner(mock sqlmock.Sqlmock, key string, owners ...[2]int) {
+	rows := sqlmock.NewRows([]string{"spender_id", "service_key_id"})
+	for _, o := range owners {
+		rows.AddRow(o[0], o[1])
+	}
+	mock.ExpectQuery(slipOwnerStmt).WithArgs(key).WillReturnRows(rows)
+}
+
+func TestGet(t *testing.T) {
+	t.Run("given a stored slip should serve it", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectSlipOwner(mock, "eslip1.png", [2]int{1, 0})
+		store, _ := NewLocalStore(t.TempDir())
+		store.Put(context.Background(), "eslip1.png", strings.NewReader("png bytes"), 9, "image/png")
+		e := newEcho(New(db, store, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/eslip1.png", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+		assert.Equal(t, "png bytes", rec.Body.String())
+	})
+
+	t.Run("given a slip of another spender should return forbidden", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectSlipOwner(mock, "eslip1.png", [2]int{2, 0})
+		store, _ := NewLocalStore(t.TempDir())
+		store.Put(context.Background(), "eslip1.png", strings.NewReader("png bytes"), 9, "image/png")
+		e := newEcho(New(db, store, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/eslip1.png", nil))
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.NotContains(t, rec.Body.String(), "png bytes")
+	})
+
+	t.Run("given a thumbnail of another spender's slip should return forbidden", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectSlipOwner(mock, "eslip1.thumb.webp", [2]int{2, 0})
+		e := newEchoAs(New(db, presigningStore{}, limits, time.Minute), auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/eslip1.thumb.webp", nil))
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Empty(t, rec.Header().Get(echo.HeaderLocation))
 	})
 
+	t.Run("given an admin should serve a slip of any spender", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectSlipOwner(mock, "eslip1.png", [2]int{2, 0})
+		e := newEchoAs(New(db, presigningStore{}, limits, time.Minute), auth.Principal{SpenderID: 1, Role: auth.RoleAdmin})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/eslip1.png", nil))
+
+		assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	})
+
+	for _, tt := range []struct {
+		name  string
+		keyID int
+		want  int
+	}{
+		{"the service key that uploaded a slip still being processed should serve it", 4, http.StatusTemporaryRedirect},
+		{"another service key should return forbidden", 5, http.StatusForbidden},
+	} {
+		t.Run("given "+tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			expectSlipOwner(mock, "eslip1.png", [2]int{2, 4})
+			e := newEchoAs(New(db, presigningStore{}, limits, time.Minute), auth.Principal{Role: auth.RoleService, ServiceKeyID: tt.keyID, Scopes: []string{auth.ScopeAttachSlips}})
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/eslip1.png", nil))
+
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+
+	t.Run("given an unknown key should return not found", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectSlipOwner(mock, "missing.png")
+		store, _ := NewLocalStore(t.TempDir())
+		e := newEcho(New(db, store, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/missing.png", nil))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"messages": ["slip not found"]}`, rec.Body.String())
+	})
+
+	t.Run("given a store that presigns should redirect", func(t *testing.T) {
+		db, mock := newMock(t)
+		expectSlipOwner(mock, "eslip1.png", [2]int{1, 0})
+		e := newEcho(New(db, presigningStore{}, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/eslip1.png", nil))
+
+		assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+		assert.Equal(t, "https://bucket.example/eslip1.png?ttl=1m0s", rec.Header().Get(echo.HeaderLocation))
+	})
+}
+
+type failingStore struct{}
+
+func (failingStore) Put(context.Context, string, io.Reader, int64, string) error {
+	return errors.New("disk full")
+}
+
+func (failingStore) Open(context.Context, string) (Object, error) {
+	return Object{}, errors.New("disk full")
+}
+
+func (failingStore) Delete(context.Context, string) error {
+	return errors.New("disk full")
+}
+
+type presigningStore struct {
+	failingStore
+}
+
+func (presigningStore) PresignGet(key string, ttl time.Duration) (string, error) {
+	return "https://bucket.example/" + key + "?ttl=" + ttl.String(), nil
 }
@@ -0,0 +1,188 @@
+package eslip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// EXIF tags read before a slip's metadata is dropped.
+const (
+	tagOrientation       = 0x0112
+	tagExifIFD           = 0x8769
+	tagDateTimeOriginal  = 0x9003
+	tagDateTimeDigitized = 0x9004
+)
+
+// exifTimeLayout is how EXIF writes times: local to the camera, with no zone.
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+var errBadExif = errors.New("malformed EXIF data")
+
+// exifMeta is what is kept of a slip's EXIF. Orientation is 0 and CapturedAt
+// is zero when the EXIF does not have them.
+type exifMeta struct {
+	Orientation int
+	CapturedAt  time.Time
+}
+
+// parseExif reads the orientation and capture time off b, EXIF data in TIFF
+// layout. The capture time is when the picture was taken, or else when it
+// was digitized; the time a file was last modified is not a capture time.
+func parseExif(b []byte) (exifMeta, error) {
+	if len(b) < 8 {
+		return exifMeta{}, errBadExif
+	}
+	var bo binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return exifMeta{}, errBadExif
+	}
+	if bo.Uint16(b[2:]) != 42 {
+		return exifMeta{}, errBadExif
+	}
+
+	var m exifMeta
+	var exifIFD uint32
+	err := walkIFD(b, bo, bo.Uint32(b[4:]), func(tag, typ uint16, val []byte) {
+		switch {
+		case tag == tagOrientation && typ == 3:
+			m.Orientation = int(bo.Uint16(val))
+		case tag == tagExifIFD && typ == 4:
+			exifIFD = bo.Uint32(val)
+		}
+	})
+	if err != nil || exifIFD == 0 {
+		return m, err
+	}
+
+	var original, digitized time.Time
+	err = walkIFD(b, bo, exifIFD, func(tag, typ uint16, val []byte) {
+		if typ != 2 {
+			return
+		}
+		switch tag {
+		case tagDateTimeOriginal:
+			original = exifTime(val)
+		case tagDateTimeDigitized:
+			digitized = exifTime(val)
+		}
+	})
+	m.CapturedAt = original
+	if m.CapturedAt.IsZero() {
+		m.CapturedAt = digitized
+	}
+	return m, err
+}
+
+// walkIFD calls fn with each entry of the IFD at off in b and the bytes of
+// its value. Entries of unknown types or whose value lies outside b are
+// skipped.
+func walkIFD(b []byte, bo binary.ByteOrder, off uint32, fn func(tag, typ uint16, val []byte)) error {
+	if uint64(off)+2 > uint64(len(b)) {
+		return errBadExif
+	}
+	n := int(bo.Uint16(b[off:]))
+	start := int(off) + 2
+	if start+12*n > len(b) {
+		return errBadExif
+	}
+
+	for i := 0; i < n; i++ {
+		e := b[start+12*i : start+12*i+12]
+		typ := bo.Uint16(e[2:])
+		size := uint64(exifTypeSize(typ)) * uint64(bo.Uint32(e[4:]))
+		if size == 0 {
+			continue
+		}
+		val := e[8:12]
+		if size > 4 {
+			at := uint64(bo.Uint32(e[8:]))
+			if at+size > uint64(len(b)) {
+				continue
+			}
+			val = b[at : at+size]
+		}
+		fn(bo.Uint16(e), typ, val[:size])
+	}
+	return nil
+}
+
+// exifTypeSize is the size in bytes of one value of the TIFF type typ, 0 for
+// types it does not know.
+func exifTypeSize(typ uint16) int {
+	switch typ {
+	case 1, 2, 6, 7: // BYTE, ASCII, SBYTE, UNDEFINED
+		return 1
+	case 3, 8: // SHORT, SSHORT
+		return 2
+	case 4, 9, 11: // LONG, SLONG, FLOAT
+		return 4
+	case 5, 10, 12: // RATIONAL, SRATIONAL, DOUBLE
+		return 8
+	}
+	return 0
+}
+
+// exifTime parses an EXIF time, zero when it is blank or malformed, as
+// cameras write "0000:00:00 00:00:00" or spaces when they have no clock.
+func exifTime(val []byte) time.Time {
+	t, err := time.Parse(exifTimeLayout, strings.TrimRight(string(val), "\x00 "))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// jpegExif returns the EXIF of the JPEG in data, nil when it has none.
+func jpegExif(data []byte) []byte {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil
+	}
+
+	for off := 2; off+4 <= len(data); {
+		if data[off] != 0xff {
+			return nil
+		}
+		marker := data[off+1]
+		if marker == 0xda || marker == 0xd9 { // start of scan, end of image
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(data[off+2:]))
+		if n < 2 || off+2+n > len(data) {
+			return nil
+		}
+		seg := data[off+4 : off+2+n]
+		if marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+		off += 2 + n
+	}
+	return nil
+}
+
+// pngExif returns the EXIF of the PNG in data, nil when it has none.
+func pngExif(data []byte) []byte {
+	const signature = "\x89PNG\r\n\x1a\n"
+	if !bytes.HasPrefix(data, []byte(signature)) {
+		return nil
+	}
+
+	for off := len(signature); off+8 <= len(data); {
+		n := uint64(binary.BigEndian.Uint32(data[off:]))
+		if uint64(off)+12+n > uint64(len(data)) {
+			return nil
+		}
+		if string(data[off+4:off+8]) == "eXIf" {
+			return data[off+8 : off+8+int(n)]
+		}
+		off += 12 + int(n)
+	}
+	return nil
+}
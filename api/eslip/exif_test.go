@@ -0,0 +1,130 @@
+package eslip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exifTIFF builds EXIF in TIFF layout, in byte order bo, with an orientation
+// and, unless taken is empty, the time the picture was taken. A GPS IFD
+// pointer stands in for the location a phone records.
+func exifTIFF(bo binary.ByteOrder, orientation uint16, taken string) []byte {
+	b := make([]byte, 8, 96)
+	if bo == binary.LittleEndian {
+		copy(b, "II")
+	} else {
+		copy(b, "MM")
+	}
+	bo.PutUint16(b[2:], 42)
+	bo.PutUint32(b[4:], 8)
+
+	u16 := func(v uint16) {
+		b = append(b, 0, 0)
+		bo.PutUint16(b[len(b)-2:], v)
+	}
+	u32 := func(v uint32) {
+		b = append(b, 0, 0, 0, 0)
+		bo.PutUint32(b[len(b)-4:], v)
+	}
+	entry := func(tag, typ uint16, count, value uint32) {
+		e := make([]byte, 12)
+		bo.PutUint16(e, tag)
+		bo.PutUint16(e[2:], typ)
+		bo.PutUint32(e[4:], count)
+		if typ == 3 {
+			bo.PutUint16(e[8:], uint16(value))
+		} else {
+			bo.PutUint32(e[8:], value)
+		}
+		b = append(b, e...)
+	}
+
+	// IFD0 at 8 has 3 entries and ends at 50; the Exif IFD has 1 and ends at
+	// 68, where the time is.
+	u16(3)
+	entry(tagOrientation, 3, 1, uint32(orientation))
+	entry(tagExifIFD, 4, 1, 50)
+	entry(0x8825, 4, 1, 0)
+	u32(0)
+	u16(1)
+	entry(tagDateTimeOriginal, 2, 20, 68)
+	u32(0)
+	if taken == "" {
+		taken = "    :  :     :  :  "
+	}
+	return append(b, taken+"\x00"...)
+}
+
+// withJPEGExif puts exif in an APP1 segment right after the start of the
+// JPEG img.
+func withJPEGExif(img string, exif []byte) string {
+	seg := append([]byte("\xff\xe1\x00\x00Exif\x00\x00"), exif...)
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(seg)-2))
+	return img[:2] + string(seg) + img[2:]
+}
+
+// withPNGExif puts exif in an eXIf chunk right after the header of the PNG
+// img.
+func withPNGExif(img string, exif []byte) string {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(exif)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, exif...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	const header = 8 + 25 // signature and IHDR chunk
+	return img[:header] + string(chunk) + img[header:]
+}
+
+func TestParseExif(t *testing.T) {
+	taken := time.Date(2024, 7, 10, 9, 30, 0, 0, time.UTC)
+
+	for name, bo := range map[string]binary.ByteOrder{"little-endian": binary.LittleEndian, "big-endian": binary.BigEndian} {
+		t.Run("given "+name+" EXIF should read the orientation and the time the picture was taken", func(t *testing.T) {
+			got, err := parseExif(exifTIFF(bo, 6, "2024:07:10 09:30:00"))
+
+			assert.NoError(t, err)
+			assert.Equal(t, exifMeta{Orientation: 6, CapturedAt: taken}, got)
+		})
+	}
+
+	t.Run("given EXIF from a camera without a clock should leave the capture time zero", func(t *testing.T) {
+		got, err := parseExif(exifTIFF(binary.LittleEndian, 1, ""))
+
+		assert.NoError(t, err)
+		assert.Equal(t, exifMeta{Orientation: 1}, got)
+	})
+
+	t.Run("given EXIF whose IFD lies past its end should return error", func(t *testing.T) {
+		_, err := parseExif(exifTIFF(binary.LittleEndian, 1, "2024:07:10 09:30:00")[:40])
+
+		assert.ErrorIs(t, err, errBadExif)
+	})
+
+	t.Run("given data that is not EXIF should return error", func(t *testing.T) {
+		_, err := parseExif([]byte("not a TIFF header"))
+
+		assert.ErrorIs(t, err, errBadExif)
+	})
+}
+
+func TestImageExif(t *testing.T) {
+	exif := exifTIFF(binary.LittleEndian, 3, "2024:07:10 09:30:00")
+
+	t.Run("given a JPEG with EXIF should return it", func(t *testing.T) {
+		assert.Equal(t, exif, jpegExif([]byte(withJPEGExif(jpegImage(), exif))))
+	})
+
+	t.Run("given a PNG with EXIF should return it", func(t *testing.T) {
+		assert.Equal(t, exif, pngExif([]byte(withPNGExif(pngImage(), exif))))
+	})
+
+	t.Run("given images without EXIF should return nil", func(t *testing.T) {
+		assert.Nil(t, jpegExif([]byte(jpegImage())))
+		assert.Nil(t, pngExif([]byte(pngImage())))
+		assert.Nil(t, jpegExif(bytes.Repeat([]byte{0xff}, 8)))
+	})
+}
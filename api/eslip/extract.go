@@ -0,0 +1,109 @@
+package eslip
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+)
+
+// maxOCROutput bounds how much text is read back from an OCR command.
+const maxOCROutput = 1 << 20
+
+// Draft is a transaction read off a slip, for the spender to confirm. Fields
+// the extractor could not read are left empty. Date uses the layout of
+// transaction dates.
+type Draft struct {
+	Date      string       `json:"date,omitempty"`
+	Amount    *money.Money `json:"amount,omitempty"`
+	Currency  string       `json:"currency,omitempty"`
+	Merchant  string       `json:"merchant,omitempty"`
+	Reference string       `json:"reference,omitempty"`
+}
+
+// Extractor reads a draft transaction off a slip image.
+type Extractor interface {
+	Extract(ctx context.Context, image io.Reader, contentType string) (Draft, error)
+}
+
+// NewExtractor builds the extractor cfg configures, or returns nil when slips
+// are not to be read.
+func NewExtractor(cfg config.Extractor) (Extractor, error) {
+	args := strings.Fields(cfg.Command)
+	if len(args) == 0 {
+		return nil, nil
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("extractor command: %w", err)
+	}
+
+	return &CommandExtractor{Path: path, Args: args[1:], Timeout: cfg.Timeout}, nil
+}
+
+// FakeExtractor returns the same draft, or error, for every image.
+type FakeExtractor struct {
+	Draft Draft
+	Err   error
+}
+
+func (f FakeExtractor) Extract(context.Context, io.Reader, string) (Draft, error) {
+	return f.Draft, f.Err
+}
+
+// CommandExtractor runs a local OCR program, such as
+// "tesseract stdin stdout -l tha+eng", with the image on its standard input,
+// and parses the text it prints with ParseReceipt.
+type CommandExtractor struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+}
+
+func (e *CommandExtractor) Extract(ctx context.Context, image io.Reader, _ string) (Draft, error) {
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Path, e.Args...)
+	cmd.Stdin = image
+	cmd.Stdout = &limitedWriter{w: &stdout, n: maxOCROutput}
+	cmd.Stderr = &limitedWriter{w: &stderr, n: 4096}
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Draft{}, fmt.Errorf("%w: %s", err, msg)
+		}
+		return Draft{}, err
+	}
+
+	return ParseReceipt(stdout.String()), nil
+}
+
+var errOutputTooLarge = errors.New("OCR output too large")
+
+// limitedWriter fails once more than n bytes have been written, which makes
+// the command fail rather than fill memory.
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, errOutputTooLarge
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
@@ -0,0 +1,57 @@
+package eslip
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandExtractor(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("given a command printing the slip text should parse it", func(t *testing.T) {
+		e, err := NewExtractor(config.Extractor{Command: "cat"})
+		assert.NoError(t, err)
+
+		draft, err := e.Extract(ctx, strings.NewReader(kplusText), "image/png")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "123456789012345678", draft.Reference)
+		assert.Equal(t, "2022-09-01 16:30:00", draft.Date)
+	})
+
+	t.Run("given a failing command should return its error output", func(t *testing.T) {
+		e := &CommandExtractor{Path: "sh", Args: []string{"-c", "echo unsupported image >&2; exit 1"}}
+
+		_, err := e.Extract(ctx, strings.NewReader(""), "image/png")
+
+		assert.ErrorContains(t, err, "unsupported image")
+	})
+
+	t.Run("given a command that does not finish in time should stop it", func(t *testing.T) {
+		e := &CommandExtractor{Path: "sleep", Args: []string{"5"}, Timeout: 50 * time.Millisecond}
+
+		start := time.Now()
+		_, err := e.Extract(ctx, strings.NewReader(""), "image/png")
+
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+
+	t.Run("given no command should not build an extractor", func(t *testing.T) {
+		e, err := NewExtractor(config.Extractor{})
+
+		assert.NoError(t, err)
+		assert.Nil(t, e)
+	})
+
+	t.Run("given a command that is not installed should refuse to build", func(t *testing.T) {
+		_, err := NewExtractor(config.Extractor{Command: "no-such-ocr-binary stdin stdout"})
+
+		assert.ErrorContains(t, err, "no-such-ocr-binary")
+	})
+}
@@ -0,0 +1,146 @@
+package eslip
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// RouteJob names the route that reports a slip job. Upload reverses it to
+// build the locations it returns.
+const RouteJob = "eslip.job"
+
+// Job statuses. A queued job with attempts behind it failed and waits for
+// its next attempt; a dead one failed for good.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+var ErrJobNotFound = errors.New("slip job not found")
+
+const (
+	enqueueStmt = "INSERT INTO slip_job (spender_id, key, filename, content_type, size, uploaded_by, service_key_id, captured_at) VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, 0), $8) RETURNING id;"
+
+	// claimStmt takes the job that has waited longest, or one whose worker
+	// let its lease run out, and leases it until $1. SKIP LOCKED lets
+	// workers claiming at the same time each take a different job.
+	claimStmt = `UPDATE slip_job SET status = 'running', attempts = attempts + 1, locked_until = $1, updated_at = now()` +
+		` WHERE id = (SELECT id FROM slip_job WHERE (status = 'queued' AND run_at <= $2) OR (status = 'running' AND locked_until <= $2)` +
+		` ORDER BY run_at, id LIMIT 1 FOR UPDATE SKIP LOCKED)` +
+		` RETURNING id, spender_id, key, filename, content_type, size, COALESCE(uploaded_by, 0), captured_at, attempts;`
+
+	// The statements that settle a job match its attempt too, so a worker
+	// whose lease ran out cannot overwrite the attempt that took over.
+	completeStmt = "UPDATE slip_job SET status = 'succeeded', result = $3, last_error = NULL, locked_until = NULL, updated_at = now() WHERE id = $1 AND attempts = $2;"
+	retryStmt    = "UPDATE slip_job SET status = 'queued', run_at = $3, last_error = $4, locked_until = NULL, updated_at = now() WHERE id = $1 AND attempts = $2;"
+	buryStmt     = "UPDATE slip_job SET status = 'dead', last_error = $3, locked_until = NULL, updated_at = now() WHERE id = $1 AND attempts = $2;"
+
+	jobStmt = "SELECT id, spender_id, COALESCE(service_key_id, 0), filename, status, attempts, run_at, last_error, result, created_at, updated_at FROM slip_job WHERE id = $1;"
+)
+
+// job is a claimed slip job: the stored file to process, for whom and who
+// uploaded it. UploadedBy is 0 for service callers; ServiceKeyID, which is
+// only recorded when the job is queued, is 0 for everyone else. CapturedAt is set when
+// the uploader asked for the time the picture was taken to date the draft.
+type job struct {
+	ID           int
+	SpenderID    int
+	Key          string
+	Filename     string
+	ContentType  string
+	Size         int64
+	UploadedBy   int
+	ServiceKeyID int
+	CapturedAt   sql.NullTime
+	Attempts     int
+}
+
+// enqueue queues the processing of the slip stored under key.
+func enqueue(ctx context.Context, db *sql.DB, j job) (int, error) {
+	var id int
+	err := db.QueryRowContext(ctx, enqueueStmt, j.SpenderID, j.Key, j.Filename, j.ContentType, j.Size, j.UploadedBy, j.ServiceKeyID, j.CapturedAt).Scan(&id)
+	return id, err
+}
+
+// Job reports a slip job. NextAttemptAt is set while a failed job waits to
+// be retried, and Error says why its last attempt failed. Result is what
+// processing the slip found, once it has succeeded.
+type Job struct {
+	ID            int           `json:"id"`
+	Status        string        `json:"status"`
+	Filename      string        `json:"filename"`
+	Attempts      int           `json:"attempts"`
+	NextAttemptAt *time.Time    `json:"next_attempt_at,omitempty"`
+	Error         string        `json:"error,omitempty"`
+	Result        *UploadResult `json:"result,omitempty"`
+	CreatedAt     time.Time     `json:"created_at"`
+	UpdatedAt     time.Time     `json:"updated_at"`
+}
+
+// GetJob reports slip job :id to the spender the slip belongs to, to the
+// service key that uploaded it, or to an admin.
+func (h handler) GetJob(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Error("ID parameter is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	var j Job
+	var spenderID, serviceKeyID int
+	var runAt time.Time
+	var lastError sql.NullString
+	var result []byte
+	err = h.db.QueryRowContext(ctx, jobStmt, id).
+		Scan(&j.ID, &spenderID, &serviceKeyID, &j.Filename, &j.Status, &j.Attempts, &runAt, &lastError, &result, &j.CreatedAt, &j.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("slip job not found", zap.Int("id", id))
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrJobNotFound))
+	}
+	if err != nil {
+		logger.Error("query slip job error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	uploader := p.IsService() && serviceKeyID != 0 && p.ServiceKeyID == serviceKeyID
+	if !uploader && !p.CanAccess(spenderID) {
+		logger.Warn("slip job belongs to another spender", zap.Int("id", id), zap.Int("spender_id", p.SpenderID))
+		return c.JSON(http.StatusForbidden, errs.ParseError(errs.ErrForbidden))
+	}
+
+	j.Error = lastError.String
+	if j.Status == JobQueued && j.Attempts > 0 {
+		j.NextAttemptAt = &runAt
+	}
+	if result != nil {
+		j.Result = &UploadResult{}
+		if err := json.Unmarshal(result, j.Result); err != nil {
+			logger.Error("decode slip job result error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		j.Result.Location = c.Echo().Reverse(RouteGet, j.Result.Key)
+	}
+
+	return c.JSON(http.StatusOK, j)
+}
@@ -0,0 +1,121 @@
+package eslip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+var jobStatusCols = []string{"id", "spender_id", "service_key_id", "filename", "status", "attempts", "run_at", "last_error", "result", "created_at", "updated_at"}
+
+func TestGetJob(t *testing.T) {
+	created := time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC)
+	updated := created.Add(3 * time.Second)
+
+	t.Run("given a succeeded job should report its result with the slip location", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(jobStmt).WithArgs(9).WillReturnRows(sqlmock.NewRows(jobStatusCols).
+			AddRow(9, 1, 0, "eslip.png", JobSucceeded, 1, created, nil, []byte(`{"filename":"eslip.png","key":"k.png","content_type":"image/png","size":70}`), created, updated))
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/jobs/9", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"id": 9,
+			"status": "succeeded",
+			"filename": "eslip.png",
+			"attempts": 1,
+			"result": {"filename": "eslip.png", "key": "k.png", "location": "/api/v1/slips/k.png", "content_type": "image/png", "size": 70},
+			"created_at": "2024-07-10T09:00:00Z",
+			"updated_at": "2024-07-10T09:00:03Z"
+		}`, rec.Body.String())
+	})
+
+	t.Run("given a job waiting to be retried should report its next attempt and last error", func(t *testing.T) {
+		db, mock := newMock(t)
+		next := created.Add(20 * time.Second)
+		mock.ExpectQuery(jobStmt).WithArgs(9).WillReturnRows(sqlmock.NewRows(jobStatusCols).
+			AddRow(9, 1, 0, "eslip.png", JobQueued, 2, next, "open slip: disk full", nil, created, updated))
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/jobs/9", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"id": 9,
+			"status": "queued",
+			"filename": "eslip.png",
+			"attempts": 2,
+			"next_attempt_at": "2024-07-10T09:00:20Z",
+			"error": "open slip: disk full",
+			"created_at": "2024-07-10T09:00:00Z",
+			"updated_at": "2024-07-10T09:00:03Z"
+		}`, rec.Body.String())
+	})
+
+	t.Run("given a job of another spender should return forbidden", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(jobStmt).WithArgs(9).WillReturnRows(sqlmock.NewRows(jobStatusCols).
+			AddRow(9, 2, 0, "eslip.png", JobRunning, 1, created, nil, nil, created, updated))
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/jobs/9", nil))
+
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("given an admin should report a job of any spender", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(jobStmt).WithArgs(9).WillReturnRows(sqlmock.NewRows(jobStatusCols).
+			AddRow(9, 2, 0, "eslip.png", JobDead, 3, created, "open slip: disk full", nil, created, updated))
+		e := newEchoAs(New(db, nil, limits, time.Minute), auth.Principal{SpenderID: 1, Role: auth.RoleAdmin})
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/jobs/9", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"status":"dead"`)
+	})
+
+	for _, tt := range []struct {
+		name  string
+		keyID int
+		want  int
+	}{
+		{"the service key that uploaded the slip should report its job", 4, http.StatusOK},
+		{"another service key should return forbidden", 5, http.StatusForbidden},
+	} {
+		t.Run("given "+tt.name, func(t *testing.T) {
+			db, mock := newMock(t)
+			mock.ExpectQuery(jobStmt).WithArgs(9).WillReturnRows(sqlmock.NewRows(jobStatusCols).
+				AddRow(9, 2, 4, "eslip.png", JobRunning, 1, created, nil, nil, created, updated))
+			e := newEchoAs(New(db, nil, limits, time.Minute), auth.Principal{Role: auth.RoleService, ServiceKeyID: tt.keyID, Scopes: []string{auth.ScopeAttachSlips}})
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/jobs/9", nil))
+
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+
+	t.Run("given an unknown job should return not found", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(jobStmt).WithArgs(9).WillReturnRows(sqlmock.NewRows(jobStatusCols))
+		e := newEcho(New(db, nil, limits, time.Minute))
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/jobs/9", nil))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"messages": ["slip job not found"]}`, rec.Body.String())
+	})
+}
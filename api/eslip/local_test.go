@@ -0,0 +1,53 @@
+package eslip
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("given a stored blob should open and delete it", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewLocalStore(dir)
+		assert.NoError(t, err)
+
+		assert.NoError(t, store.Put(ctx, "slip.jpg", strings.NewReader("jpeg"), 4, "image/jpeg"))
+
+		obj, err := store.Open(ctx, "slip.jpg")
+		assert.NoError(t, err)
+		b, _ := io.ReadAll(obj.Body)
+		obj.Body.Close()
+		assert.Equal(t, "jpeg", string(b))
+		assert.Equal(t, "image/jpeg", obj.ContentType)
+		assert.Equal(t, int64(4), obj.Size)
+
+		entries, _ := os.ReadDir(dir)
+		assert.Len(t, entries, 1, "no temporary file should be left behind")
+
+		assert.NoError(t, store.Delete(ctx, "slip.jpg"))
+		_, err = store.Open(ctx, "slip.jpg")
+		assert.ErrorIs(t, err, ErrBlobNotFound)
+		assert.NoError(t, store.Delete(ctx, "slip.jpg"), "deleting twice is not an error")
+	})
+
+	t.Run("given a key that leaves the directory should refuse it", func(t *testing.T) {
+		dir := t.TempDir()
+		store, _ := NewLocalStore(filepath.Join(dir, "slips"))
+
+		for _, key := range []string{"", ".", "..", "../escape", `..\escape`, "a/b"} {
+			err := store.Put(ctx, key, strings.NewReader("x"), 1, "")
+			assert.ErrorIs(t, err, ErrInvalidBlobKey, key)
+		}
+
+		_, err := os.Stat(filepath.Join(dir, "escape"))
+		assert.True(t, os.IsNotExist(err))
+	})
+}
@@ -0,0 +1,125 @@
+package eslip
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tags of the slip verification payload Thai banks print on e-slips. It is
+// EMVCo TLV: a two digit ID, a two digit length and the value.
+const (
+	tagSlip    = "00"
+	tagCountry = "51"
+	tagCRC     = "91"
+
+	// Sub-tags of tagSlip.
+	tagAPIID          = "00"
+	tagSendingBank    = "01"
+	tagTransactionRef = "02"
+)
+
+var (
+	ErrInvalidSlipQR  = errors.New("QR code is not a bank slip verification code")
+	ErrSlipQRChecksum = errors.New("slip QR checksum does not match")
+)
+
+// bankNames maps Bank of Thailand bank codes to bank names.
+var bankNames = map[string]string{
+	"002": "Bangkok Bank",
+	"004": "Kasikornbank",
+	"006": "Krungthai Bank",
+	"011": "TMBThanachart Bank",
+	"014": "Siam Commercial Bank",
+	"022": "CIMB Thai Bank",
+	"024": "United Overseas Bank (Thai)",
+	"025": "Bank of Ayudhya",
+	"030": "Government Savings Bank",
+	"033": "Government Housing Bank",
+	"034": "Bank for Agriculture and Agricultural Cooperatives",
+	"066": "Islamic Bank of Thailand",
+	"067": "TISCO Bank",
+	"069": "Kiatnakin Phatra Bank",
+	"073": "Land and Houses Bank",
+}
+
+// SlipQR is what the verification QR of a bank e-slip says about the
+// transfer. The transaction reference, together with the sending bank, is
+// what the bank's slip verification service looks the transfer up by.
+type SlipQR struct {
+	APIID           string `json:"api_id"`
+	SendingBank     string `json:"sending_bank"`
+	SendingBankName string `json:"sending_bank_name,omitempty"`
+	TransactionRef  string `json:"transaction_ref"`
+	Country         string `json:"country,omitempty"`
+	Payload         string `json:"payload"`
+}
+
+// ParseSlipQR parses and checks the payload of a slip verification QR.
+func ParseSlipQR(payload string) (SlipQR, error) {
+	fields, err := parseTLV(payload)
+	if err != nil {
+		return SlipQR{}, err
+	}
+
+	crc, ok := fields[tagCRC]
+	if !ok || !strings.HasSuffix(payload, tagCRC+"04"+crc) {
+		return SlipQR{}, fmt.Errorf("%w: checksum must be the last field", ErrInvalidSlipQR)
+	}
+	if want := fmt.Sprintf("%04X", crc16(payload[:len(payload)-len(crc)])); !strings.EqualFold(crc, want) {
+		return SlipQR{}, fmt.Errorf("%w: got %s, want %s", ErrSlipQRChecksum, crc, want)
+	}
+
+	slip, err := parseTLV(fields[tagSlip])
+	if err != nil {
+		return SlipQR{}, err
+	}
+	if slip[tagSendingBank] == "" || slip[tagTransactionRef] == "" {
+		return SlipQR{}, fmt.Errorf("%w: sending bank and transaction reference are required", ErrInvalidSlipQR)
+	}
+
+	return SlipQR{
+		APIID:           slip[tagAPIID],
+		SendingBank:     slip[tagSendingBank],
+		SendingBankName: bankNames[slip[tagSendingBank]],
+		TransactionRef:  slip[tagTransactionRef],
+		Country:         fields[tagCountry],
+		Payload:         payload,
+	}, nil
+}
+
+// parseTLV splits s into its fields by ID. Later duplicates win.
+func parseTLV(s string) (map[string]string, error) {
+	fields := map[string]string{}
+	for len(s) > 0 {
+		if len(s) < 4 {
+			return nil, fmt.Errorf("%w: truncated field %q", ErrInvalidSlipQR, s)
+		}
+		n, err := strconv.Atoi(s[2:4])
+		if err != nil || n < 0 || len(s) < 4+n {
+			return nil, fmt.Errorf("%w: bad length for field %s", ErrInvalidSlipQR, s[:2])
+		}
+		fields[s[:2]] = s[4 : 4+n]
+		s = s[4+n:]
+	}
+
+	return fields, nil
+}
+
+// crc16 is CRC-16/CCITT-FALSE, the checksum EMVCo QR payloads carry.
+func crc16(s string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
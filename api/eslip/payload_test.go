@@ -0,0 +1,58 @@
+package eslip
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slipPayload is the verification QR printed on e-slip1.png.
+const slipPayload = "00390006000001010300402180120481045493010215102TH91047C66"
+
+func TestParseSlipQR(t *testing.T) {
+	t.Run("given a slip verification payload should return the sending bank and reference", func(t *testing.T) {
+		qr, err := ParseSlipQR(slipPayload)
+
+		assert.NoError(t, err)
+		assert.Equal(t, SlipQR{
+			APIID:           "000001",
+			SendingBank:     "004",
+			SendingBankName: "Kasikornbank",
+			TransactionRef:  "012048104549301021",
+			Country:         "TH",
+			Payload:         slipPayload,
+		}, qr)
+	})
+
+	t.Run("given a lower case checksum should accept it", func(t *testing.T) {
+		_, err := ParseSlipQR(slipPayload[:len(slipPayload)-4] + "7c66")
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("given an altered payload should reject the checksum", func(t *testing.T) {
+		_, err := ParseSlipQR("00390006000001010300402180120481045493010225102TH91047C66")
+
+		assert.ErrorIs(t, err, ErrSlipQRChecksum)
+	})
+
+	t.Run("given payloads that are not slip verification codes should reject them", func(t *testing.T) {
+		for _, payload := range []string{
+			"",
+			"https://example.com/receipt",
+			"0039000600000101030040218012048104549301021",
+			withCRC("5102TH9104"),
+			"00390006000001010300402180120481045493010215102TH",
+			withCRC("0016000600000101030045102TH9104"),
+		} {
+			_, err := ParseSlipQR(payload)
+
+			assert.ErrorIs(t, err, ErrInvalidSlipQR, payload)
+		}
+	})
+}
+
+func withCRC(s string) string {
+	return fmt.Sprintf("%s%04X", s, crc16(s))
+}
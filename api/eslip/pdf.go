@@ -0,0 +1,222 @@
+package eslip
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+)
+
+var (
+	errBadPDF  = errors.New("malformed PDF file")
+	errPDFInfo = errors.New("document information not found where it can be blanked")
+)
+
+var (
+	pdfObjRe      = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfRefRe      = regexp.MustCompile(`(\d+)\s+(\d+)\s+R\b`)
+	pdfInfoRe     = regexp.MustCompile(`/Info\s*(\d+)\s+(\d+)\s+R\b`)
+	pdfMetadataRe = regexp.MustCompile(`/Type\s*/Metadata\b`)
+	pdfDCTRe      = regexp.MustCompile(`/Filter\s*\[?\s*/DCTDecode\s*\]?\s*[/>]`)
+)
+
+// pdfRef names an object of a PDF file: its number and generation.
+type pdfRef struct{ num, gen string }
+
+// scrubPDF blanks the metadata of the PDF file in data, in place, so that the
+// offsets its cross-reference tables give stay right: the document
+// information dictionaries and the strings they refer to, the XMP metadata
+// streams, and the EXIF and IPTC segments of the JPEG images it carries. It
+// refuses a file whose document information it cannot find, such as one kept
+// in a compressed object stream, as it could not be blanked in place.
+func scrubPDF(data []byte) error {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return errBadPDF
+	}
+
+	// Every revision of the file may name its own document information.
+	info := map[pdfRef]bool{}
+	for _, m := range pdfInfoRe.FindAllSubmatch(data, -1) {
+		info[pdfRef{string(m[1]), string(m[2])}] = false
+	}
+	values := map[pdfRef]bool{}
+
+	end := 0
+	for _, m := range pdfObjRe.FindAllSubmatchIndex(data, -1) {
+		if m[0] < end {
+			continue // within the stream of the object before
+		}
+		ref := pdfRef{string(data[m[2]:m[3]]), string(data[m[4]:m[5]])}
+		start := skipPDFSpace(data, m[1])
+		if !bytes.HasPrefix(data[start:], []byte("<<")) {
+			continue
+		}
+		dictEnd, ok := pdfDictEnd(data, start)
+		if !ok {
+			return errBadPDF
+		}
+		dict := data[start:dictEnd]
+		end = dictEnd
+
+		if _, ok := info[ref]; ok {
+			for _, v := range pdfRefRe.FindAllSubmatch(dict, -1) {
+				values[pdfRef{string(v[1]), string(v[2])}] = true
+			}
+			blank(data[start+2 : dictEnd-2])
+			info[ref] = true
+			continue
+		}
+
+		body, bodyEnd, ok := pdfStream(data, dictEnd)
+		if !ok {
+			continue
+		}
+		end = bodyEnd
+		switch {
+		case pdfMetadataRe.Match(dict):
+			// The stream is left as the same number of blanks, no longer
+			// compressed, so its length still holds.
+			if i := bytes.Index(dict, []byte("/Filter")); i >= 0 {
+				copy(dict[i:], "/Ignore")
+			}
+			blank(data[body:bodyEnd])
+		case pdfDCTRe.Match(dict):
+			scrubJPEGSegments(data[body:bodyEnd])
+		}
+	}
+
+	for _, found := range info {
+		if !found {
+			return errPDFInfo
+		}
+	}
+	if len(values) > 0 {
+		for _, m := range pdfObjRe.FindAllSubmatchIndex(data, -1) {
+			if !values[pdfRef{string(data[m[2]:m[3]]), string(data[m[4]:m[5]])}] {
+				continue
+			}
+			n := bytes.Index(data[m[1]:], []byte("endobj"))
+			if n < 0 {
+				return errBadPDF
+			}
+			blank(data[m[1] : m[1]+n])
+			copy(data[m[1]:], " null")
+		}
+	}
+	return nil
+}
+
+// pdfStream finds the data of the stream that follows the dictionary ending
+// at off, if one does. It returns where the data starts and ends.
+func pdfStream(data []byte, off int) (int, int, bool) {
+	off = skipPDFSpace(data, off)
+	if !bytes.HasPrefix(data[off:], []byte("stream")) {
+		return 0, 0, false
+	}
+	off += len("stream")
+	if bytes.HasPrefix(data[off:], []byte("\r\n")) {
+		off += 2
+	} else if bytes.HasPrefix(data[off:], []byte("\n")) {
+		off++
+	}
+	n := bytes.Index(data[off:], []byte("endstream"))
+	if n < 0 {
+		return 0, 0, false
+	}
+	return off, off + n, true
+}
+
+// pdfDictEnd finds the end of the dictionary starting at off, past its
+// closing >>, skipping the strings and comments within it.
+func pdfDictEnd(data []byte, off int) (int, bool) {
+	depth := 0
+	for i := off; i < len(data); i++ {
+		switch c := data[i]; {
+		case c == '<' && i+1 < len(data) && data[i+1] == '<':
+			depth++
+			i++
+		case c == '>' && i+1 < len(data) && data[i+1] == '>':
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1, true
+			}
+		case c == '<': // a hex string
+			n := bytes.IndexByte(data[i:], '>')
+			if n < 0 {
+				return 0, false
+			}
+			i += n
+		case c == '(':
+			n, ok := pdfStringEnd(data, i)
+			if !ok {
+				return 0, false
+			}
+			i = n - 1
+		case c == '%':
+			for i < len(data) && data[i] != '\r' && data[i] != '\n' {
+				i++
+			}
+		}
+	}
+	return 0, false
+}
+
+// pdfStringEnd finds the end of the literal string starting at off, past its
+// closing parenthesis. Parentheses nest within it unless escaped.
+func pdfStringEnd(data []byte, off int) (int, bool) {
+	depth := 0
+	for i := off; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i + 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func skipPDFSpace(data []byte, off int) int {
+	for off < len(data) && bytes.IndexByte([]byte("\x00\t\n\f\r "), data[off]) >= 0 {
+		off++
+	}
+	return off
+}
+
+// scrubJPEGSegments zeroes the APP1 and APP13 segments of the JPEG in data,
+// in place: its EXIF, XMP and IPTC. A JPEG decoder skips application segments
+// it does not recognise, so the picture still reads.
+func scrubJPEGSegments(data []byte) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return
+	}
+	for off := 2; off+4 <= len(data); {
+		if data[off] != 0xff {
+			return
+		}
+		marker := data[off+1]
+		if marker == 0xda || marker == 0xd9 { // start of scan, end of image
+			return
+		}
+		n := int(data[off+2])<<8 | int(data[off+3])
+		if n < 2 || off+2+n > len(data) {
+			return
+		}
+		if marker == 0xe1 || marker == 0xed {
+			clear(data[off+4 : off+2+n])
+		}
+		off += 2 + n
+	}
+}
+
+// blank overwrites b with spaces.
+func blank(b []byte) {
+	for i := range b {
+		b[i] = ' '
+	}
+}
@@ -0,0 +1,80 @@
+package eslip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/jpeg"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const pdfXMP = "<x:xmpmeta><exif:GPSLatitude>13,44.5N</exif:GPSLatitude></x:xmpmeta>"
+
+// pdfWithMetadata builds a one-page PDF with document information, some of
+// it in an object of its own, an XMP metadata stream and a JPEG image
+// carrying EXIF.
+func pdfWithMetadata(photo string) string {
+	return "%PDF-1.7\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R /Metadata 4 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+		"3 0 obj << /Type /Page /Parent 2 0 R /Resources << /XObject << /Im1 5 0 R >> >> >> endobj\n" +
+		"4 0 obj << /Type /Metadata /Subtype /XML /Filter /FlateDecode /Length 70 >> stream\n" + pdfXMP + "\nendstream endobj\n" +
+		"5 0 obj << /Type /XObject /Subtype /Image /Filter /DCTDecode /Length 9 >> stream\n" + photo + "\nendstream endobj\n" +
+		"6 0 obj << /Author (Somchai \\(work phone\\)) /Producer <695068 6F6E65> /Creator 7 0 R >> endobj\n" +
+		"7 0 obj (Scanner on a phone) endobj\n" +
+		"trailer << /Root 1 0 R /Info 6 0 R >>\n%%EOF\n"
+}
+
+func TestScrubPDF(t *testing.T) {
+	t.Run("given a PDF with metadata should blank it in place and keep the document", func(t *testing.T) {
+		photo := withJPEGExif(jpegImage(), exifTIFF(binary.LittleEndian, 1, "2024:07:10 09:30:00"))
+		file := []byte(pdfWithMetadata(photo))
+		size := len(file)
+
+		err := scrubPDF(file)
+
+		assert.NoError(t, err)
+		assert.Len(t, file, size)
+		got := string(file)
+		for _, metadata := range []string{"Somchai", "695068 6F6E65", "Scanner on a phone", "GPSLatitude", "2024:07:10"} {
+			assert.NotContains(t, got, metadata)
+		}
+		assert.Contains(t, got, "6 0 obj <<")
+		assert.Contains(t, got, "7 0 obj null")
+		assert.Contains(t, got, "/Ignore /FlateDecode")
+		assert.Contains(t, got, "/Resources << /XObject << /Im1 5 0 R >> >> >> endobj\n")
+
+		start := strings.Index(got, "stream\n\xff\xd8") + len("stream\n")
+		image := file[start : start+len(photo)]
+		assert.Nil(t, jpegExif(image))
+		_, err = jpeg.Decode(bytes.NewReader(image))
+		assert.NoError(t, err)
+	})
+
+	t.Run("given a PDF without metadata should leave it as it is", func(t *testing.T) {
+		file := []byte(pdfDocument)
+
+		err := scrubPDF(file)
+
+		assert.NoError(t, err)
+		assert.Equal(t, pdfDocument, string(file))
+	})
+
+	t.Run("given a PDF keeping its document information in an object stream should return error", func(t *testing.T) {
+		file := []byte("%PDF-1.7\n" +
+			"1 0 obj << /Type /ObjStm /N 1 /First 4 /Filter /FlateDecode /Length 2 >> stream\nxx\nendstream endobj\n" +
+			"2 0 obj << /Type /XRef /Root 3 0 R /Info 9 0 R /Length 2 >> stream\nxx\nendstream endobj\n%%EOF\n")
+
+		err := scrubPDF(file)
+
+		assert.ErrorIs(t, err, errPDFInfo)
+	})
+
+	t.Run("given a PDF with a dictionary left open should return error", func(t *testing.T) {
+		err := scrubPDF([]byte("%PDF-1.7\n1 0 obj << /Author (Somchai) endobj\n"))
+
+		assert.ErrorIs(t, err, errBadPDF)
+	})
+}
@@ -0,0 +1,148 @@
+package eslip
+
+import (
+	"errors"
+	"image"
+	"math"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/makiuchi-d/gozxing/qrcode/decoder"
+	"github.com/makiuchi-d/gozxing/qrcode/detector"
+)
+
+var ErrNoQRCode = errors.New("no QR code found in slip")
+
+var qrHints = map[gozxing.DecodeHintType]interface{}{
+	gozxing.DecodeHintType_TRY_HARDER: true,
+}
+
+// readSlipQR reads the slip verification QR on img.
+func readSlipQR(img image.Image) (*SlipQR, error) {
+	text, err := DecodeQR(img)
+	if err != nil {
+		return nil, err
+	}
+
+	qr, err := ParseSlipQR(text)
+	if err != nil {
+		return nil, err
+	}
+
+	return &qr, nil
+}
+
+// DecodeQR returns the text of the QR code on a slip image.
+//
+// Banks print their logo or a coloured band across the slip QR, which often
+// hides one of its three finder patterns and defeats a standard reader. When
+// that happens the hidden corner is reconstructed from the two patterns that
+// are still visible and the grid is sampled from there; the code's error
+// correction absorbs whatever the overlay covers.
+func DecodeQR(img image.Image) (string, error) {
+	bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", err
+	}
+
+	if res, err := qrcode.NewQRCodeReader().Decode(bmp, qrHints); err == nil {
+		return res.GetText(), nil
+	}
+
+	bits, err := bmp.GetBlackMatrix()
+	if err != nil {
+		return "", err
+	}
+
+	return decodeObscured(bits)
+}
+
+// decodeObscured decodes a QR code of which only two finder patterns were
+// found. Every placement of the third pattern that completes a square is
+// tried in turn.
+func decodeObscured(bits *gozxing.BitMatrix) (string, error) {
+	finder := detector.NewFinderPatternFinder(bits, nil)
+	finder.Find(qrHints)
+
+	var found []*detector.FinderPattern
+	for _, p := range finder.GetPossibleCenters() {
+		if p.GetCount() >= 2 {
+			found = append(found, p)
+		}
+	}
+
+	for i := 0; i < len(found); i++ {
+		for j := i + 1; j < len(found); j++ {
+			a, b := found[i], found[j]
+			moduleSize := (a.GetEstimatedModuleSize() + b.GetEstimatedModuleSize()) / 2
+			if math.Abs(a.GetEstimatedModuleSize()-b.GetEstimatedModuleSize()) > moduleSize/2 {
+				continue
+			}
+
+			for _, corners := range completeSquare(a, b, moduleSize) {
+				if text, err := sampleAndDecode(bits, corners, moduleSize); err == nil {
+					return text, nil
+				}
+			}
+		}
+	}
+
+	return "", ErrNoQRCode
+}
+
+// completeSquare lists the ways a and b can be two corners of the finder
+// square, each as the top-left, top-right and bottom-left centres.
+func completeSquare(a, b *detector.FinderPattern, moduleSize float64) [][3]gozxing.ResultPoint {
+	ax, ay, bx, by := a.GetX(), a.GetY(), b.GetX(), b.GetY()
+	dx, dy := bx-ax, by-ay
+	mx, my := (ax+bx)/2, (ay+by)/2
+
+	point := func(x, y float64) gozxing.ResultPoint {
+		return detector.NewFinderPattern1(x, y, moduleSize)
+	}
+
+	var out [][3]gozxing.ResultPoint
+	for _, sign := range []float64{1, -1} {
+		// a and b on a diagonal: the third corner sits off its midpoint.
+		c := point(mx-sign*dy/2, my+sign*dx/2)
+		// a and b along a side: the third corner sits beside either one.
+		d := point(ax-sign*dy, ay+sign*dx)
+		e := point(bx-sign*dy, by+sign*dx)
+
+		for _, tri := range [][3]gozxing.ResultPoint{{a, b, c}, {a, b, d}, {a, b, e}} {
+			bl, tl, tr := gozxing.ResultPoint_OrderBestPatterns(tri[0], tri[1], tri[2])
+			out = append(out, [3]gozxing.ResultPoint{tl, tr, bl})
+		}
+	}
+
+	return out
+}
+
+func sampleAndDecode(bits *gozxing.BitMatrix, corners [3]gozxing.ResultPoint, moduleSize float64) (string, error) {
+	tl, tr, bl := corners[0], corners[1], corners[2]
+	if tl.GetX() < 0 || tl.GetY() < 0 || tr.GetX() < 0 || bl.GetY() < 0 {
+		return "", ErrNoQRCode
+	}
+
+	across := gozxing.ResultPoint_Distance(tl, tr) / moduleSize
+	down := gozxing.ResultPoint_Distance(tl, bl) / moduleSize
+	// Dimensions of QR codes are 4v+17; snap the estimate to the nearest.
+	version := int(math.Round(((across+down)/2 + 7 - 17) / 4))
+	if version < 1 || version > 40 {
+		return "", ErrNoQRCode
+	}
+	dimension := 4*version + 17
+
+	transform := detector.Detector_createTransform(tl, tr, bl, nil, dimension)
+	grid, err := detector.Detector_sampleGrid(bits, transform, dimension)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := decoder.NewDecoder().Decode(grid, qrHints)
+	if err != nil {
+		return "", err
+	}
+
+	return res.GetText(), nil
+}
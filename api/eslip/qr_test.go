@@ -0,0 +1,79 @@
+package eslip
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func qrImage(t *testing.T, text string) *image.Gray {
+	bits, err := qrcode.NewQRCodeWriter().Encode(text, gozxing.BarcodeFormat_QR_CODE, 300, 300, nil)
+	assert.NoError(t, err)
+
+	img := image.NewGray(image.Rect(0, 0, bits.GetWidth(), bits.GetHeight()))
+	for y := 0; y < bits.GetHeight(); y++ {
+		for x := 0; x < bits.GetWidth(); x++ {
+			if !bits.Get(x, y) {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
+
+func openPNG(t *testing.T, name string) image.Image {
+	f, err := os.Open(name)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	assert.NoError(t, err)
+	return img
+}
+
+func TestDecodeQR(t *testing.T) {
+	t.Run("given the sample e-slips should decode their verification QR", func(t *testing.T) {
+		for _, name := range []string{"../../e-slip1.png", "../../e-slip2.png"} {
+			text, err := DecodeQR(openPNG(t, name))
+
+			assert.NoError(t, err, name)
+			assert.Equal(t, slipPayload, text, name)
+		}
+	})
+
+	t.Run("given a clean QR code should decode it", func(t *testing.T) {
+		text, err := DecodeQR(qrImage(t, slipPayload))
+
+		assert.NoError(t, err)
+		assert.Equal(t, slipPayload, text)
+	})
+
+	t.Run("given a QR code with a finder pattern painted over should still decode it", func(t *testing.T) {
+		img := qrImage(t, slipPayload)
+		bounds := img.Bounds()
+		for y := 0; y < bounds.Dy()/3; y++ {
+			for x := 0; x < bounds.Dx()/3; x++ {
+				if (x+y)%9 < 4 {
+					img.SetGray(x, y, color.Gray{Y: 255})
+				}
+			}
+		}
+
+		text, err := DecodeQR(img)
+
+		assert.NoError(t, err)
+		assert.Equal(t, slipPayload, text)
+	})
+
+	t.Run("given an image without a QR code should return not found", func(t *testing.T) {
+		_, err := DecodeQR(image.NewGray(image.Rect(0, 0, 100, 100)))
+
+		assert.ErrorIs(t, err, ErrNoQRCode)
+	})
+}
@@ -0,0 +1,235 @@
+package eslip
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+)
+
+// draftDateLayout is the layout of transaction dates.
+const draftDateLayout = "2006-01-02 15:04:05"
+
+// Labels that precede a field on Thai and English slips. The value follows
+// the label on the same line or on the next one. Amount labels are matched
+// in order, so the amount transferred wins over fees and converted amounts.
+var (
+	referenceLabels = []string{"เลขที่รายการ", "รหัสอ้างอิง", "หมายเลขอ้างอิง", "เลขที่อ้างอิง", "transaction id", "transaction no", "reference", "ref"}
+	amountLabels    = []string{"จำนวนเงิน", "จำนวน", "amount", "total", "ยอดเงิน", "ยอดชำระ"}
+	merchantLabels  = []string{"ชื่อร้านค้า", "ร้านค้า", "ผู้รับเงิน", "ผู้รับ", "ไปยัง", "merchant", "payee", "to"}
+)
+
+var (
+	referenceRe = regexp.MustCompile(`[A-Za-z0-9]{6,}`)
+	amountRe    = regexp.MustCompile(`\d{1,3}(?:,\d{3})+(?:\.\d{2})?|\d+\.\d{2}`)
+	currencyRe  = regexp.MustCompile(`(?i)บาท|\bTHB\b|฿`)
+
+	// dayMonthYearRe matches "1 Sep 22 4:30 PM", "01 ก.ย. 2565 16:30" and
+	// the like: day, month name, year and an optional time.
+	dayMonthYearRe = regexp.MustCompile(`(\d{1,2})\s*([A-Za-z]{3,9}\.?|[ก-๙]{1,3}\.\s?[ก-๙]{1,2}\.?)\s*(\d{4}|\d{2})(?:,?\s+(\d{1,2})[:.](\d{2})(?::(\d{2}))?\s*([AaPp][Mm])?)?`)
+	// numericDateRe matches "2022-09-01 16:30" and "01/09/2022 16:30".
+	numericDateRe = regexp.MustCompile(`(\d{4})-(\d{2})-(\d{2})|(\d{1,2})/(\d{1,2})/(\d{4})`)
+	timeRe        = regexp.MustCompile(`(\d{1,2}):(\d{2})(?::(\d{2}))?\s*([AaPp][Mm])?`)
+)
+
+var monthNames = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+
+	"ม.ค.": time.January, "ก.พ.": time.February, "มี.ค.": time.March, "เม.ย.": time.April,
+	"พ.ค.": time.May, "มิ.ย.": time.June, "ก.ค.": time.July, "ส.ค.": time.August,
+	"ก.ย.": time.September, "ต.ค.": time.October, "พ.ย.": time.November, "ธ.ค.": time.December,
+}
+
+// ParseReceipt reads a draft transaction out of the text of a slip, as an
+// OCR program prints it. Thai slips date transfers in the Buddhist era,
+// often with a two digit year; those are converted.
+func ParseReceipt(text string) Draft {
+	lines := strings.Split(strings.ReplaceAll(text, "\r", ""), "\n")
+	for i := range lines {
+		lines[i] = strings.Join(strings.Fields(lines[i]), " ")
+	}
+
+	var d Draft
+	if v, ok := labelled(lines, referenceLabels, referenceRe); ok {
+		d.Reference = v
+	}
+	if v, ok := labelled(lines, amountLabels, amountRe); ok {
+		if m, err := money.Parse(strings.ReplaceAll(v, ",", "")); err == nil {
+			d.Amount = &m
+		}
+	}
+	if v, ok := labelled(lines, merchantLabels, nil); ok {
+		d.Merchant = v
+	}
+	if currencyRe.MatchString(text) {
+		d.Currency = "THB"
+	}
+	if t, ok := receiptDate(lines); ok {
+		d.Date = t.Format(draftDateLayout)
+	}
+
+	return d
+}
+
+// labelled finds the value of the first label present in lines. With re the
+// value is the first match of re after the label; without it, the rest of the
+// line, or the next non-empty line when the label ends its line.
+func labelled(lines []string, labels []string, re *regexp.Regexp) (string, bool) {
+	for _, label := range labels {
+		for i, line := range lines {
+			rest, ok := afterLabel(line, label)
+			if !ok {
+				continue
+			}
+
+			candidates := []string{rest}
+			for j := i + 1; j < len(lines) && j <= i+2; j++ {
+				if lines[j] != "" {
+					candidates = append(candidates, lines[j])
+					break
+				}
+			}
+
+			for _, c := range candidates {
+				if re != nil {
+					if v := re.FindString(c); v != "" {
+						return v, true
+					}
+				} else if c != "" {
+					return c, true
+				}
+			}
+		}
+	}
+
+	return "", false
+}
+
+// afterLabel reports whether line starts with label, ignoring case, and
+// returns what follows it with any colon trimmed. An English label must be a
+// whole word so "to" does not match "total".
+func afterLabel(line, label string) (string, bool) {
+	if len(line) < len(label) || !strings.EqualFold(line[:len(label)], label) {
+		return "", false
+	}
+
+	rest := line[len(label):]
+	if rest != "" && label[0] < 0x80 {
+		if c := rest[0]; c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			return "", false
+		}
+	}
+
+	return strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(rest), ":.")), true
+}
+
+// receiptDate finds the first date on the slip, with the time that follows
+// it when there is one.
+func receiptDate(lines []string) (time.Time, bool) {
+	for _, line := range lines {
+		if m := dayMonthYearRe.FindStringSubmatch(line); m != nil {
+			thai := m[2][0] >= 0x80
+			month, ok := monthNames[monthKey(m[2], thai)]
+			if !ok {
+				continue
+			}
+
+			day, _ := strconv.Atoi(m[1])
+			year := fullYear(m[3], thai)
+			hour, minute, second := clock(m[4], m[5], m[6], m[7])
+			if t, ok := date(year, month, day, hour, minute, second); ok {
+				return t, true
+			}
+		}
+
+		if m := numericDateRe.FindStringSubmatch(line); m != nil {
+			var year, day int
+			var month time.Month
+			if m[1] != "" {
+				year, _ = strconv.Atoi(m[1])
+				mo, _ := strconv.Atoi(m[2])
+				month = time.Month(mo)
+				day, _ = strconv.Atoi(m[3])
+			} else {
+				day, _ = strconv.Atoi(m[4])
+				mo, _ := strconv.Atoi(m[5])
+				month = time.Month(mo)
+				year, _ = strconv.Atoi(m[6])
+			}
+			year = fullYear(strconv.Itoa(year), false)
+
+			var hour, minute, second int
+			if tm := timeRe.FindStringSubmatch(line[strings.Index(line, m[0])+len(m[0]):]); tm != nil {
+				hour, minute, second = clock(tm[1], tm[2], tm[3], tm[4])
+			}
+			if t, ok := date(year, month, day, hour, minute, second); ok {
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// monthKey normalises a month name to its key in monthNames: English names
+// to their first three letters, Thai abbreviations to "ก.ย." form.
+func monthKey(name string, thai bool) string {
+	if thai {
+		return strings.TrimSuffix(strings.ReplaceAll(name, " ", ""), ".") + "."
+	}
+
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	return name[:min(3, len(name))]
+}
+
+// fullYear turns a slip year into a Gregorian one. Buddhist era years are
+// 543 ahead; two digit years are taken as Buddhist on Thai slips.
+func fullYear(s string, thai bool) int {
+	year, _ := strconv.Atoi(s)
+	if len(s) == 2 {
+		if thai {
+			year += 2500
+		} else {
+			year += 2000
+		}
+	}
+	if year > 2400 {
+		year -= 543
+	}
+
+	return year
+}
+
+func clock(h, m, s, ampm string) (hour, minute, second int) {
+	hour, _ = strconv.Atoi(h)
+	minute, _ = strconv.Atoi(m)
+	second, _ = strconv.Atoi(s)
+
+	switch strings.ToLower(ampm) {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	}
+
+	return hour, minute, second
+}
+
+// date builds a time from parts, refusing ones that do not name a real
+// moment rather than letting time.Date normalise them.
+func date(year int, month time.Month, day, hour, minute, second int) (time.Time, bool) {
+	t := time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+	if t.Year() != year || t.Month() != month || t.Day() != day || t.Hour() != hour || t.Minute() != minute {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
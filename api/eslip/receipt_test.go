@@ -0,0 +1,86 @@
+package eslip
+
+import (
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/stretchr/testify/assert"
+)
+
+// kplusText is e-slip1.png as an OCR program reads it.
+const kplusText = `Transfer Completed
+1 Sep 22 4:30 PM
+
+Kasikorn Rakthai
+KBank
+xxx-x-x8888-x
+
+นายกสิกร รักไทย
+KBank
+888-8-8888-8
+
+เลขที่รายการ:
+123456789012345678
+จำนวน:
+888.88 บาท
+เทียบเท่าจำนวน:
+888.88 บาท
+ค่าธรรมเนียม:
+0.00 บาท
+verified by K+
+`
+
+func amount(s string) *money.Money {
+	m := money.MustParse(s)
+	return &m
+}
+
+func TestParseReceipt(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want Draft
+	}{
+		{
+			name: "given a K+ transfer slip should read the transfer and not the fee",
+			text: kplusText,
+			want: Draft{Date: "2022-09-01 16:30:00", Amount: amount("888.88"), Currency: "THB", Reference: "123456789012345678"},
+		},
+		{
+			name: "given a Thai slip dated in the Buddhist era should convert the year",
+			text: "โอนเงินสำเร็จ\n01 ก.ย. 2565 16:30 น.\nไปยัง: ร้านกาแฟดี\nจำนวนเงิน 1,250.00 บาท\nรหัสอ้างอิง: 2022090116300012\n",
+			want: Draft{Date: "2022-09-01 16:30:00", Amount: amount("1250.00"), Currency: "THB", Merchant: "ร้านกาแฟดี", Reference: "2022090116300012"},
+		},
+		{
+			name: "given a two digit Buddhist year should convert it",
+			text: "12 พ.ค. 67 09:05\nจำนวน: 45.50 บาท",
+			want: Draft{Date: "2024-05-12 09:05:00", Amount: amount("45.50"), Currency: "THB"},
+		},
+		{
+			name: "given an English receipt with a numeric date should read it",
+			text: "Merchant: Coffee Corner\nDate 2024-05-11 15:04\nTotal: 3,000.25 THB\nRef No. AB12CD34EF\n",
+			want: Draft{Date: "2024-05-11 15:04:00", Amount: amount("3000.25"), Currency: "THB", Merchant: "Coffee Corner", Reference: "AB12CD34EF"},
+		},
+		{
+			name: "given a day first numeric date should read it",
+			text: "Paid on 31/12/2023 23:59\nAmount 10.00",
+			want: Draft{Date: "2023-12-31 23:59:00", Amount: amount("10.00")},
+		},
+		{
+			name: "given an impossible date should leave it out",
+			text: "31/02/2024\nAmount: 10.00",
+			want: Draft{Amount: amount("10.00")},
+		},
+		{
+			name: "given text with nothing recognisable should return an empty draft",
+			text: "hello world",
+			want: Draft{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ParseReceipt(tt.text))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package eslip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// scrubJPEGQuality is the quality JPEG slips are encoded again at, high
+// enough that their QR code and printed text read as they did.
+const scrubJPEGQuality = 90
+
+var (
+	ErrUnreadableImage = errors.New("file could not be read as an image")
+	ErrUnscrubbablePDF = errors.New("metadata could not be removed from the PDF file")
+)
+
+// scrubbed is a slip rid of its metadata. CapturedAt is when the picture was
+// taken, read off its EXIF before it was dropped, and zero when unknown.
+type scrubbed struct {
+	Body       []byte
+	CapturedAt time.Time
+}
+
+// scrub rids the slip in f, of type mtype, of the metadata a phone records
+// with a picture, such as where it was taken and on what device, before it
+// is stored. JPEG and PNG images are decoded and encoded again, upright,
+// which keeps nothing but their pixels. PDF documents have their metadata
+// blanked in place, and are refused when it cannot be; docs/slip-metadata.md
+// lists what that leaves.
+func scrub(f io.Reader, mtype string) (scrubbed, error) {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return scrubbed{}, err
+	}
+
+	switch mtype {
+	case "image/jpeg":
+		return reencode(data, jpegExif(data), func(w io.Writer, img image.Image) error {
+			return jpeg.Encode(w, img, &jpeg.Options{Quality: scrubJPEGQuality})
+		})
+	case "image/png":
+		return reencode(data, pngExif(data), png.Encode)
+	case "application/pdf":
+		if err := scrubPDF(data); err != nil {
+			return scrubbed{}, fmt.Errorf("%w: %v", ErrUnscrubbablePDF, err)
+		}
+		return scrubbed{Body: data}, nil
+	default:
+		return scrubbed{Body: data}, nil
+	}
+}
+
+// reencode decodes the image in data and encodes it again, turned upright as
+// exif says. EXIF that cannot be read is dropped all the same.
+func reencode(data, exif []byte, encode func(io.Writer, image.Image) error) (scrubbed, error) {
+	var meta exifMeta
+	if exif != nil {
+		meta, _ = parseExif(exif)
+	}
+
+	img, err := decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return scrubbed{}, fmt.Errorf("%w: %v", ErrUnreadableImage, err)
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, orient(img, meta.Orientation)); err != nil {
+		return scrubbed{}, err
+	}
+	return scrubbed{Body: buf.Bytes(), CapturedAt: meta.CapturedAt}, nil
+}
+
+// orient turns img upright from the EXIF orientation o, 1 to 8: how the
+// camera held the picture it stored. The orientation goes with the rest of
+// the EXIF, so the pixels have to be turned instead.
+func orient(img image.Image, o int) image.Image {
+	if o < 2 || o > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if o >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				dx, dy = x, h-1-y
+			case 5: // mirrored, turned a quarter left
+				dx, dy = y, x
+			case 6: // turned a quarter left
+				dx, dy = h-1-y, x
+			case 7: // mirrored, turned a quarter right
+				dx, dy = h-1-y, w-1-x
+			case 8: // turned a quarter right
+				dx, dy = y, w-1-x
+			}
+			i, j := dst.PixOffset(dx, dy), src.PixOffset(x, y)
+			copy(dst.Pix[i:i+4], src.Pix[j:j+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,143 @@
+package eslip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stripe is a w by 1 image going from black on the left to white.
+func stripe(w int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, 1))
+	for x := 0; x < w; x++ {
+		img.SetGray(x, 0, color.Gray{Y: uint8(x * 255 / (w - 1))})
+	}
+	return img
+}
+
+func TestScrub(t *testing.T) {
+	taken := time.Date(2024, 7, 10, 9, 30, 0, 0, time.UTC)
+	exif := exifTIFF(binary.LittleEndian, 6, "2024:07:10 09:30:00")
+
+	t.Run("given a JPEG with EXIF should encode it again upright without it", func(t *testing.T) {
+		var b bytes.Buffer
+		jpeg.Encode(&b, stripe(64), &jpeg.Options{Quality: 100})
+
+		got, err := scrub(strings.NewReader(withJPEGExif(b.String(), exif)), "image/jpeg")
+
+		assert.NoError(t, err)
+		assert.Equal(t, taken, got.CapturedAt)
+		assert.Nil(t, jpegExif(got.Body))
+		assert.NotContains(t, string(got.Body), "2024:07:10")
+		img, err := jpeg.Decode(bytes.NewReader(got.Body))
+		if assert.NoError(t, err) {
+			assert.Equal(t, image.Pt(1, 64), img.Bounds().Size(), "turned a quarter right")
+			top, _, _, _ := img.At(0, 0).RGBA()
+			bottom, _, _, _ := img.At(0, 63).RGBA()
+			assert.Less(t, top, bottom, "the left of the stored picture is its top")
+		}
+	})
+
+	t.Run("given a PNG with EXIF should encode it again without it", func(t *testing.T) {
+		var b bytes.Buffer
+		png.Encode(&b, stripe(4))
+
+		got, err := scrub(strings.NewReader(withPNGExif(b.String(), exifTIFF(binary.BigEndian, 1, "2024:07:10 09:30:00"))), "image/png")
+
+		assert.NoError(t, err)
+		assert.Equal(t, taken, got.CapturedAt)
+		assert.Nil(t, pngExif(got.Body))
+		img, err := png.Decode(bytes.NewReader(got.Body))
+		if assert.NoError(t, err) {
+			assertSamePixels(t, stripe(4), img)
+		}
+	})
+
+	t.Run("given an image without EXIF should encode it again", func(t *testing.T) {
+		got, err := scrub(strings.NewReader(pngImage()), "image/png")
+
+		assert.NoError(t, err)
+		assert.True(t, got.CapturedAt.IsZero())
+		img, err := png.Decode(bytes.NewReader(got.Body))
+		if assert.NoError(t, err) {
+			assert.Equal(t, image.Pt(2, 2), img.Bounds().Size())
+		}
+	})
+
+	t.Run("given the same image twice should encode it the same", func(t *testing.T) {
+		first, _ := scrub(strings.NewReader(withJPEGExif(jpegImage(), exif)), "image/jpeg")
+		second, _ := scrub(strings.NewReader(withJPEGExif(jpegImage(), exif)), "image/jpeg")
+
+		assert.Equal(t, first.Body, second.Body, "duplicates are found by the hash of the stored file")
+	})
+
+	t.Run("given a PDF with metadata should blank it", func(t *testing.T) {
+		file := pdfWithMetadata(jpegImage())
+
+		got, err := scrub(strings.NewReader(file), "application/pdf")
+
+		assert.NoError(t, err)
+		assert.Len(t, got.Body, len(file))
+		assert.NotContains(t, string(got.Body), "Somchai")
+	})
+
+	for _, tt := range []struct{ name, content, mtype string }{
+		{"a truncated JPEG", jpegImage()[:40], "image/jpeg"},
+	} {
+		t.Run("given "+tt.name+" should return error", func(t *testing.T) {
+			_, err := scrub(strings.NewReader(tt.content), tt.mtype)
+
+			assert.ErrorIs(t, err, ErrUnreadableImage)
+		})
+	}
+
+	t.Run("given a PDF whose metadata cannot be blanked should return error", func(t *testing.T) {
+		_, err := scrub(strings.NewReader("%PDF-1.7\ntrailer << /Info 9 0 R >>\n%%EOF\n"), "application/pdf")
+
+		assert.ErrorIs(t, err, ErrUnscrubbablePDF)
+	})
+}
+
+func TestOrient(t *testing.T) {
+	// A 3 by 2 image numbered across its rows: 0 1 2 over 3 4 5.
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(i)
+	}
+
+	tests := []struct {
+		orientation int
+		want        [][]uint8
+	}{
+		{1, [][]uint8{{0, 1, 2}, {3, 4, 5}}},
+		{2, [][]uint8{{2, 1, 0}, {5, 4, 3}}},
+		{3, [][]uint8{{5, 4, 3}, {2, 1, 0}}},
+		{4, [][]uint8{{3, 4, 5}, {0, 1, 2}}},
+		{5, [][]uint8{{0, 3}, {1, 4}, {2, 5}}},
+		{6, [][]uint8{{3, 0}, {4, 1}, {5, 2}}},
+		{7, [][]uint8{{5, 2}, {4, 1}, {3, 0}}},
+		{8, [][]uint8{{2, 5}, {1, 4}, {0, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run("given orientation "+strconv.Itoa(tt.orientation)+" should turn the image upright", func(t *testing.T) {
+			got := orient(src, tt.orientation)
+
+			rows := make([][]uint8, got.Bounds().Dy())
+			for y := range rows {
+				for x := 0; x < got.Bounds().Dx(); x++ {
+					rows[y] = append(rows[y], color.GrayModel.Convert(got.At(x, y)).(color.Gray).Y)
+				}
+			}
+			assert.Equal(t, tt.want, rows)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package eslip
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// DefaultMaxDistance is how many of the 64 dHash bits two slips may differ in
+// and still be reported as near-duplicates.
+const DefaultMaxDistance = 6
+
+var ErrInvalidMaxDistance = errors.New("the value of max_distance must be between 0 and 64")
+
+// nearWindow is how far apart two slips may have been uploaded and still be
+// compared, so the report looks at the slips uploaded around each slip rather
+// than at every pair ever stored.
+const nearWindow = "30 days"
+
+// distanceSQL is the number of bits in which the dHashes of a and b differ.
+const distanceSQL = "bit_count((a.dhash # b.dhash)::bit(64))"
+
+// txOf selects the transaction of the slip aliased alias: the oldest live
+// transaction it is attached to.
+func txOf(alias string) string {
+	return "(SELECT t.id FROM transaction_slip ts JOIN transaction t ON t.id = ts.transaction_id WHERE ts.slip_id = " + alias + ".id" +
+		" AND t.deleted_at IS NULL ORDER BY t.id LIMIT 1)"
+}
+
+var (
+	findSlipStmt   = "SELECT s.key, s.content_type, s.size, " + txOf("s") + " FROM slip s WHERE s.spender_id = $1 AND s.sha256 = $2;"
+	slipTxStmt     = "SELECT " + transaction.Columns + " FROM transaction t" + transaction.Join + " WHERE t.id = $1;"
+	insertSlipStmt = "INSERT INTO slip (key, spender_id, sha256, dhash, content_type, size, uploaded_by, thumbnail_jpeg, thumbnail_webp)" +
+		" VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, ''), NULLIF($9, '')) ON CONFLICT (spender_id, sha256) DO NOTHING;"
+
+	nearPairsSQL = " FROM slip a JOIN slip b ON (b.created_at, b.id) > (a.created_at, a.id) AND b.created_at <= a.created_at + interval '" + nearWindow + "'" +
+		" WHERE a.dhash IS NOT NULL AND b.dhash IS NOT NULL AND " + distanceSQL + " <= $1"
+	nearStmt = "SELECT " + distanceSQL + ", a.key, a.spender_id, a.created_at, " + txOf("a") + ", b.key, b.spender_id, b.created_at, " + txOf("b") +
+		nearPairsSQL + " ORDER BY 1, a.id, b.id LIMIT $2 OFFSET $3;"
+	countNearStmt = "SELECT COUNT(*)" + nearPairsSQL + ";"
+)
+
+// storedSlip is a slip already recorded for a spender.
+type storedSlip struct {
+	Key           string
+	ContentType   string
+	Size          int64
+	TransactionID sql.NullInt64
+}
+
+// findSlip looks up the slip spenderID already stored with content hash sum.
+func findSlip(ctx context.Context, db *sql.DB, spenderID int, sum string) (storedSlip, bool, error) {
+	var s storedSlip
+	err := db.QueryRowContext(ctx, findSlipStmt, spenderID, sum).Scan(&s.Key, &s.ContentType, &s.Size, &s.TransactionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storedSlip{}, false, nil
+	}
+	if err != nil {
+		return storedSlip{}, false, err
+	}
+
+	return s, true, nil
+}
+
+// recordSlip records a stored slip. It reports false, and records nothing,
+// when the spender already has a slip with the same content.
+func recordSlip(ctx context.Context, db *sql.DB, key string, spenderID int, sum string, dhash sql.NullInt64, contentType string, size int64, uploadedBy int, thumbs thumbnails) (bool, error) {
+	res, err := db.ExecContext(ctx, insertSlipStmt, key, spenderID, sum, dhash, contentType, size, uploadedBy, thumbs.JPEG, thumbs.WebP)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// slipTransaction loads the transaction a slip belongs to, if it has one.
+func slipTransaction(ctx context.Context, db *sql.DB, id sql.NullInt64) (*transaction.Transaction, error) {
+	if !id.Valid {
+		return nil, nil
+	}
+
+	var tx transaction.Transaction
+	if err := transaction.Scan(db.QueryRowContext(ctx, slipTxStmt, id.Int64), &tx); err != nil {
+		return nil, err
+	}
+
+	return &tx, nil
+}
+
+// SlipRef is one side of a near-duplicate pair.
+type SlipRef struct {
+	Key           string    `json:"key"`
+	Location      string    `json:"location"`
+	SpenderID     int       `json:"spender_id"`
+	TransactionID *int64    `json:"transaction_id,omitempty"`
+	UploadedAt    time.Time `json:"uploaded_at"`
+}
+
+// NearDuplicate pairs two slips whose pictures differ in Distance bits of
+// their perceptual hash; 0 means the pictures look identical.
+type NearDuplicate struct {
+	Distance int        `json:"distance"`
+	Slips    [2]SlipRef `json:"slips"`
+}
+
+type NearDuplicateResponse struct {
+	Duplicates []NearDuplicate  `json:"duplicates"`
+	Pagination utils.Pagination `json:"pagination"`
+}
+
+// NearDuplicates lists pairs of slips that look alike, closest first, across
+// all spenders, among slips uploaded within nearWindow of each other. Exact re-uploads by the same spender never get this far, so
+// the pairs are the same slip saved again by another app, the same transfer
+// claimed by two spenders, or merely slips of one bank's template; telling
+// them apart is left to the reviewer.
+func (h handler) NearDuplicates(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	page, perPage, err := utils.ParsePage(c)
+	if err != nil {
+		logger.Error("page query is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	maxDistance := DefaultMaxDistance
+	if v := c.QueryParam("max_distance"); v != "" {
+		maxDistance, err = strconv.Atoi(v)
+		if err != nil || maxDistance < 0 || maxDistance > 64 {
+			logger.Error("max_distance query is invalid", zap.String("max_distance", v))
+			return c.JSON(http.StatusBadRequest, errs.ParseError(ErrInvalidMaxDistance))
+		}
+	}
+
+	rows, err := h.db.QueryContext(ctx, nearStmt, maxDistance, perPage, (page-1)*perPage)
+	if err != nil {
+		logger.Error("query near-duplicate slips error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	defer rows.Close()
+
+	duplicates := []NearDuplicate{}
+	for rows.Next() {
+		var d NearDuplicate
+		var txA, txB sql.NullInt64
+		a, b := &d.Slips[0], &d.Slips[1]
+		err := rows.Scan(&d.Distance, &a.Key, &a.SpenderID, &a.UploadedAt, &txA, &b.Key, &b.SpenderID, &b.UploadedAt, &txB)
+		if err != nil {
+			logger.Error("scan near-duplicate slips error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+
+		for i, tx := range []sql.NullInt64{txA, txB} {
+			d.Slips[i].Location = c.Echo().Reverse(RouteGet, d.Slips[i].Key)
+			if tx.Valid {
+				id := tx.Int64
+				d.Slips[i].TransactionID = &id
+			}
+		}
+		duplicates = append(duplicates, d)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("iterate near-duplicate slips error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	var total int64
+	if err := h.db.QueryRowContext(ctx, countNearStmt, maxDistance).Scan(&total); err != nil {
+		logger.Error("count near-duplicate slips error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	return c.JSON(http.StatusOK, NearDuplicateResponse{
+		Duplicates: duplicates,
+		Pagination: utils.NewPagination(page, perPage, total),
+	})
+}
@@ -0,0 +1,66 @@
+package eslip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNearDuplicates(t *testing.T) {
+	admin := auth.Principal{SpenderID: 1, Role: auth.RoleAdmin}
+	uploaded := time.Date(2024, 5, 11, 8, 0, 0, 0, time.UTC)
+	cols := []string{"distance", "a_key", "a_spender_id", "a_created_at", "a_transaction_id", "b_key", "b_spender_id", "b_created_at", "b_transaction_id"}
+
+	t.Run("given similar slips should list the pairs with their transactions", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(nearStmt).WithArgs(DefaultMaxDistance, 10, 0).WillReturnRows(sqlmock.NewRows(cols).
+			AddRow(0, "a.png", 1, uploaded, 7, "b.jpg", 2, uploaded.Add(time.Hour), nil))
+		mock.ExpectQuery(countNearStmt).WithArgs(DefaultMaxDistance).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		e := newEchoAs(New(db, nil, limits, time.Minute), admin)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/duplicates", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"duplicates": [{
+				"distance": 0,
+				"slips": [
+					{"key": "a.png", "location": "/api/v1/slips/a.png", "spender_id": 1, "transaction_id": 7, "uploaded_at": "2024-05-11T08:00:00Z"},
+					{"key": "b.jpg", "location": "/api/v1/slips/b.jpg", "spender_id": 2, "uploaded_at": "2024-05-11T09:00:00Z"}
+				]
+			}],
+			"pagination": {"current_page": 1, "total_pages": 1, "per_page": 10, "total_count": 1}
+		}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given max_distance and a page should query with them", func(t *testing.T) {
+		db, mock := newMock(t)
+		mock.ExpectQuery(nearStmt).WithArgs(12, 5, 5).WillReturnRows(sqlmock.NewRows(cols))
+		mock.ExpectQuery(countNearStmt).WithArgs(12).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		e := newEchoAs(New(db, nil, limits, time.Minute), admin)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/duplicates?max_distance=12&page=2&per_page=5", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"duplicates":[]`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given an out of range max_distance should return bad request", func(t *testing.T) {
+		e := newEchoAs(New(nil, nil, limits, time.Minute), admin)
+
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/slips/duplicates?max_distance=65", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages": ["the value of max_distance must be between 0 and 64"]}`, rec.Body.String())
+	})
+}
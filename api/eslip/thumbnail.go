@@ -0,0 +1,85 @@
+package eslip
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/image/draw"
+)
+
+// thumbnails are the keys of the thumbnails stored next to a slip. Both are
+// empty for slips that have none.
+type thumbnails struct {
+	JPEG string
+	WebP string
+}
+
+// thumbnailKey names a thumbnail of the slip stored under key: the key with
+// its extension replaced by suffix, so it sorts and lists next to the slip.
+func thumbnailKey(key, suffix string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + suffix
+}
+
+// storeThumbnails stores JPEG and WebP thumbnails of img, the picture of the
+// slip stored under key. Storing them again overwrites them, so an attempt
+// that is run again does no harm.
+func (p *Processor) storeThumbnails(ctx context.Context, key string, img image.Image) (thumbnails, error) {
+	thumb := thumbnail(img, p.thumbs.Size)
+	keys := thumbnails{JPEG: thumbnailKey(key, ".thumb.jpg"), WebP: thumbnailKey(key, ".thumb.webp")}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: p.thumbs.JPEGQuality}); err != nil {
+		return thumbnails{}, err
+	}
+	if err := p.store.Put(ctx, keys.JPEG, bytes.NewReader(buf.Bytes()), int64(buf.Len()), "image/jpeg"); err != nil {
+		return thumbnails{}, err
+	}
+
+	buf.Reset()
+	if err := encodeWebP(&buf, thumb); err != nil {
+		return thumbnails{}, err
+	}
+	if err := p.store.Put(ctx, keys.WebP, bytes.NewReader(buf.Bytes()), int64(buf.Len()), "image/webp"); err != nil {
+		return thumbnails{}, err
+	}
+
+	return keys, nil
+}
+
+// deleteThumbnails removes thumbnails that ended up with no slip. A failure
+// only leaves them behind, so it is logged and not returned.
+func (p *Processor) deleteThumbnails(ctx context.Context, logger *zap.Logger, thumbs thumbnails) {
+	for _, key := range []string{thumbs.JPEG, thumbs.WebP} {
+		if key == "" {
+			continue
+		}
+		if err := p.store.Delete(ctx, key); err != nil {
+			logger.Warn("delete thumbnail failed", zap.String("thumbnail", key), zap.Error(err))
+		}
+	}
+}
+
+// thumbnail shrinks img to fit in a square of size pixels, keeping its aspect
+// ratio, and lays it on white, since JPEG has no transparency. Images that
+// already fit keep their size.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(h*size/w, 1)
+		} else {
+			w, h = max(w*size/h, 1), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,42 @@
+package eslip
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name string
+		size image.Point
+		want image.Point
+	}{
+		{"a tall slip", image.Pt(349, 420), image.Pt(265, 320)},
+		{"a wide slip", image.Pt(1000, 200), image.Pt(320, 64)},
+		{"a slip smaller than the thumbnail", image.Pt(100, 80), image.Pt(100, 80)},
+		{"a slip one pixel high", image.Pt(2000, 1), image.Pt(320, 1)},
+	}
+	for _, tt := range tests {
+		t.Run("given "+tt.name+" should fit it in the square keeping its shape", func(t *testing.T) {
+			got := thumbnail(image.NewRGBA(image.Rectangle{Max: tt.size}), 320)
+
+			assert.Equal(t, tt.want, got.Bounds().Size())
+		})
+	}
+
+	t.Run("given a transparent image should lay it on white", func(t *testing.T) {
+		got := thumbnail(image.NewNRGBA(image.Rect(0, 0, 10, 10)), 320)
+
+		assert.Equal(t, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, got.At(5, 5))
+	})
+}
+
+func TestThumbnailKey(t *testing.T) {
+	t.Run("given a slip key should replace its extension", func(t *testing.T) {
+		assert.Equal(t, "5f0c.thumb.jpg", thumbnailKey("5f0c.png", ".thumb.jpg"))
+		assert.Equal(t, "5f0c.thumb.webp", thumbnailKey("5f0c", ".thumb.webp"))
+	})
+}
@@ -0,0 +1,601 @@
+package eslip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// The encoder below writes lossless WebP (VP8L), the only WebP flavour that
+// can be written in pure Go with what the standard library and x/image
+// offer. Slips are mostly screenshots of banking apps, flat colour and text,
+// which lossless coding compresses well. The bitstream is specified in
+// RFC 9649.
+
+const (
+	vp8lSignature  = 0x2f
+	vp8lMaxSize    = 1 << 14
+	predictorBits  = 4 // predictor tiles are 16x16 pixels
+	colorCacheBits = 10
+	minMatch       = 3
+	maxMatch       = 4096
+	matchHashBits  = 16
+
+	transformPredictor     = 0
+	transformSubtractGreen = 2
+
+	nLiteralCodes  = 256
+	nLengthCodes   = 24
+	nDistanceCodes = 40
+)
+
+// codeLengthCodeOrder is the order in which the lengths of the code that
+// codes code lengths are written.
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// predictorModes are the predictors tried on each tile: left, top, their
+// average and the select predictor.
+var predictorModes = []uint32{1, 2, 7, 11}
+
+// encodeWebP writes img to w as a lossless WebP. Transparency is kept.
+func encodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxSize || height > vp8lMaxSize {
+		return fmt.Errorf("webp: cannot encode a %dx%d image", width, height)
+	}
+
+	px := make([]uint32, 0, width*height)
+	opaque := true
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			px = append(px, uint32(c.A)<<24|uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B))
+			opaque = opaque && c.A == 0xff
+		}
+	}
+
+	var bw bitWriter
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if opaque {
+		bw.write(0, 1)
+	} else {
+		bw.write(1, 1)
+	}
+	bw.write(0, 3) // version
+
+	subtractGreen(px)
+	bw.write(1, 1)
+	bw.write(transformSubtractGreen, 2)
+
+	modes := predict(px, width, height)
+	bw.write(1, 1)
+	bw.write(transformPredictor, 2)
+	bw.write(predictorBits-2, 3)
+	writeEntropyImage(&bw, modes, tiles(width), false)
+
+	bw.write(0, 1) // no more transforms
+	writeEntropyImage(&bw, px, width, true)
+
+	data := bw.bytes()
+	pad := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(12+len(data)+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if pad == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+
+	return nil
+}
+
+// bitWriter packs values into bytes least significant bit first.
+type bitWriter struct {
+	buf []byte
+	acc uint64
+	n   uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.n -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.n > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.n = 0, 0
+	}
+	return w.buf
+}
+
+func tiles(size int) int {
+	return (size + 1<<predictorBits - 1) >> predictorBits
+}
+
+// subtractGreen subtracts the green channel from red and blue, which makes
+// greys and most text colours zero in both.
+func subtractGreen(px []uint32) {
+	for i, p := range px {
+		g := (p >> 8) & 0xff
+		r := ((p >> 16) - g) & 0xff
+		bl := (p - g) & 0xff
+		px[i] = p&0xff00ff00 | r<<16 | bl
+	}
+}
+
+// predict replaces px by what is left of each pixel after predicting it from
+// its neighbours, with the predictor that leaves least in each tile, and
+// returns the image of the chosen modes.
+func predict(px []uint32, width, height int) []uint32 {
+	tw, th := tiles(width), tiles(height)
+	modes := make([]uint32, tw*th)
+	residuals := make([]uint32, len(px))
+
+	for ty := 0; ty < th; ty++ {
+		for tx := 0; tx < tw; tx++ {
+			best, bestCost := predictorModes[0], -1
+			for _, mode := range predictorModes {
+				cost := 0
+				for y := ty << predictorBits; y < min((ty+1)<<predictorBits, height); y++ {
+					for x := tx << predictorBits; x < min((tx+1)<<predictorBits, width); x++ {
+						cost += residualCost(subPixels(px[y*width+x], predictPixel(px, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tw+tx] = best << 8
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mode := modes[(y>>predictorBits)*tw+x>>predictorBits] >> 8
+			residuals[y*width+x] = subPixels(px[y*width+x], predictPixel(px, width, x, y, mode))
+		}
+	}
+	copy(px, residuals)
+
+	return modes
+}
+
+// predictPixel predicts the pixel at x, y with mode. The first row is always
+// predicted from the left and the first column from the top.
+func predictPixel(px []uint32, width, x, y int, mode uint32) uint32 {
+	i := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return px[i-1]
+	case x == 0:
+		return px[i-width]
+	}
+
+	l, t, tl := px[i-1], px[i-width], px[i-width-1]
+	switch mode {
+	case 1:
+		return l
+	case 2:
+		return t
+	case 7:
+		var p uint32
+		for s := 0; s < 32; s += 8 {
+			p |= ((l>>s&0xff + t>>s&0xff) / 2) << s
+		}
+		return p
+	default: // 11, select
+		var pl, pt int
+		for s := 0; s < 32; s += 8 {
+			pl += absDiff(tl>>s&0xff, t>>s&0xff)
+			pt += absDiff(tl>>s&0xff, l>>s&0xff)
+		}
+		if pl < pt {
+			return l
+		}
+		return t
+	}
+}
+
+func absDiff(a, b uint32) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+// subPixels subtracts b from a channel by channel, modulo 256.
+func subPixels(a, b uint32) uint32 {
+	var p uint32
+	for s := 0; s < 32; s += 8 {
+		p |= ((a>>s - b>>s) & 0xff) << s
+	}
+	return p
+}
+
+// residualCost estimates how costly a residual is to code: how far its
+// channels are from zero.
+func residualCost(p uint32) int {
+	cost := 0
+	for s := 0; s < 32; s += 8 {
+		v := int(int8(p >> s))
+		if v < 0 {
+			v = -v
+		}
+		cost += v
+	}
+	return cost
+}
+
+// symbol is one coded element of an entropy-coded image: a literal pixel, a
+// colour cache hit or a backward reference of length pixels at distance
+// code dist.
+type symbol struct {
+	argb   uint32
+	cache  int
+	length int
+	dist   int
+}
+
+// tokenize turns px into symbols, copying runs seen before and looking
+// colours up in a cache of cacheBits bits, none when it is 0.
+func tokenize(px []uint32, width int, cacheBits uint) []symbol {
+	var cache []uint32
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+	cacheIndex := func(p uint32) int {
+		return int((p * 0x1e35a7bd) >> (32 - cacheBits))
+	}
+
+	var head [1 << matchHashBits]int32
+	hashAt := func(i int) int {
+		h := px[i]*0x1e35a7bd ^ px[i+1]*0x9e3779b1 ^ px[i+2]*0x85ebca6b
+		return int(h >> (32 - matchHashBits))
+	}
+
+	var syms []symbol
+	for i := 0; i < len(px); {
+		// Candidates: the pixel on the left and the one above, which have
+		// short distance codes, and the last place the next three pixels
+		// were seen.
+		length, dist := 0, 0
+		try := func(d, code int) {
+			if d < 1 || d > i {
+				return
+			}
+			n := 0
+			for n < maxMatch && i+n < len(px) && px[i+n] == px[i+n-d] {
+				n++
+			}
+			if n > length {
+				length, dist = n, code
+			}
+		}
+		try(1, 2)
+		try(width, 1)
+		if i+2 < len(px) {
+			if j := int(head[hashAt(i)]) - 1; j >= 0 {
+				try(i-j, i-j+120)
+			}
+		}
+
+		n := 1
+		switch {
+		case length >= minMatch:
+			syms = append(syms, symbol{length: length, dist: dist})
+			n = length
+		case cache != nil && cache[cacheIndex(px[i])] == px[i]:
+			syms = append(syms, symbol{cache: cacheIndex(px[i])})
+		default:
+			syms = append(syms, symbol{argb: px[i], cache: -1})
+		}
+
+		for end := i + n; i < end; i++ {
+			if cache != nil {
+				cache[cacheIndex(px[i])] = px[i]
+			}
+			if i+2 < len(px) {
+				head[hashAt(i)] = int32(i + 1)
+			}
+		}
+	}
+
+	return syms
+}
+
+// prefixEncode splits v, a length or distance code of at least 1, into its
+// prefix symbol and extra bits.
+func prefixEncode(v int) (sym uint32, nExtra uint, extra uint32) {
+	v--
+	if v < 4 {
+		return uint32(v), 0, 0
+	}
+	h := bits.Len32(uint32(v)) - 1
+	second := (v >> (h - 1)) & 1
+	return uint32(2*h + second), uint(h - 1), uint32(v) & (1<<(h-1) - 1)
+}
+
+// writeEntropyImage writes px, width pixels wide, as an entropy-coded image.
+// The main image uses a colour cache and says it uses a single group of
+// prefix codes; sub-images such as the predictor modes have neither.
+func writeEntropyImage(bw *bitWriter, px []uint32, width int, main bool) {
+	var cacheBits uint
+	if main {
+		cacheBits = colorCacheBits
+		bw.write(1, 1)
+		bw.write(uint32(cacheBits), 4)
+		bw.write(0, 1) // no meta prefix codes
+	} else {
+		bw.write(0, 1)
+	}
+
+	syms := tokenize(px, width, cacheBits)
+
+	greens := nLiteralCodes + nLengthCodes
+	if cacheBits > 0 {
+		greens += 1 << cacheBits
+	}
+	hist := [5][]uint32{
+		make([]uint32, greens),
+		make([]uint32, nLiteralCodes),
+		make([]uint32, nLiteralCodes),
+		make([]uint32, nLiteralCodes),
+		make([]uint32, nDistanceCodes),
+	}
+	for _, s := range syms {
+		switch {
+		case s.length > 0:
+			ls, _, _ := prefixEncode(s.length)
+			ds, _, _ := prefixEncode(s.dist)
+			hist[0][nLiteralCodes+ls]++
+			hist[4][ds]++
+		case s.cache >= 0:
+			hist[0][nLiteralCodes+nLengthCodes+s.cache]++
+		default:
+			hist[0][s.argb>>8&0xff]++
+			hist[1][s.argb>>16&0xff]++
+			hist[2][s.argb&0xff]++
+			hist[3][s.argb>>24]++
+		}
+	}
+
+	var codes [5]prefixCode
+	for i := range codes {
+		codes[i] = newPrefixCode(hist[i], 15)
+		codes[i].writeTo(bw)
+	}
+
+	for _, s := range syms {
+		switch {
+		case s.length > 0:
+			ls, ln, lx := prefixEncode(s.length)
+			codes[0].put(bw, nLiteralCodes+int(ls))
+			bw.write(lx, ln)
+			ds, dn, dx := prefixEncode(s.dist)
+			codes[4].put(bw, int(ds))
+			bw.write(dx, dn)
+		case s.cache >= 0:
+			codes[0].put(bw, nLiteralCodes+nLengthCodes+s.cache)
+		default:
+			codes[0].put(bw, int(s.argb>>8&0xff))
+			codes[1].put(bw, int(s.argb>>16&0xff))
+			codes[2].put(bw, int(s.argb&0xff))
+			codes[3].put(bw, int(s.argb>>24))
+		}
+	}
+}
+
+// prefixCode is a canonical Huffman code. A code of a single symbol takes no
+// bits to write that symbol.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32 // bit-reversed, as they are written
+	single  bool
+}
+
+// newPrefixCode builds the prefix code of the symbols counted in hist, with
+// codes at most limit bits long.
+func newPrefixCode(hist []uint32, limit int) prefixCode {
+	pc := prefixCode{lengths: make([]uint8, len(hist)), codes: make([]uint32, len(hist))}
+
+	used := 0
+	last := 0
+	for s, n := range hist {
+		if n > 0 {
+			used++
+			last = s
+		}
+	}
+	if used <= 1 {
+		pc.lengths[last] = 1
+		pc.single = true
+		return pc
+	}
+
+	weights := append([]uint32(nil), hist...)
+	for !huffmanLengths(weights, pc.lengths, limit) {
+		// Flatten the histogram until the deepest code fits.
+		for s, n := range weights {
+			if n > 0 {
+				weights[s] = max(n/2, 1)
+			}
+		}
+	}
+
+	var count [16]uint32
+	for _, l := range pc.lengths {
+		count[l]++
+	}
+	count[0] = 0
+	var next [16]uint32
+	code := uint32(0)
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range pc.lengths {
+		if l > 0 {
+			pc.codes[s] = bits.Reverse32(next[l]) >> (32 - l)
+			next[l]++
+		}
+	}
+
+	return pc
+}
+
+// huffmanLengths sets lengths to the Huffman code lengths of the symbols
+// weighted in weights, and reports whether none is longer than limit.
+func huffmanLengths(weights []uint32, lengths []uint8, limit int) bool {
+	type node struct {
+		weight      uint64
+		sym         int
+		left, right int
+	}
+
+	var nodes []node
+	for s, w := range weights {
+		if w > 0 {
+			nodes = append(nodes, node{weight: uint64(w), sym: s, left: -1, right: -1})
+		}
+	}
+	sort.Slice(nodes, func(a, b int) bool {
+		if nodes[a].weight != nodes[b].weight {
+			return nodes[a].weight < nodes[b].weight
+		}
+		return nodes[a].sym < nodes[b].sym
+	})
+
+	// Merged nodes come out in order of weight, so the two lightest nodes
+	// are always at the front of the leaves or of the merged nodes.
+	leaves := len(nodes)
+	nextLeaf, nextMerged := 0, leaves
+	lightest := func() int {
+		if nextLeaf < leaves && (nextMerged >= len(nodes) || nodes[nextLeaf].weight <= nodes[nextMerged].weight) {
+			nextLeaf++
+			return nextLeaf - 1
+		}
+		nextMerged++
+		return nextMerged - 1
+	}
+	for k := 1; k < leaves; k++ {
+		a := lightest()
+		b := lightest()
+		nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, sym: -1, left: a, right: b})
+	}
+
+	depth := make([]int, len(nodes))
+	for k := len(nodes) - 1; k >= leaves; k-- {
+		depth[nodes[k].left] = depth[k] + 1
+		depth[nodes[k].right] = depth[k] + 1
+	}
+
+	ok := true
+	for k := 0; k < leaves; k++ {
+		if depth[k] > limit {
+			ok = false
+		}
+		lengths[nodes[k].sym] = uint8(depth[k])
+	}
+	return ok
+}
+
+func (pc prefixCode) put(bw *bitWriter, sym int) {
+	if !pc.single {
+		bw.write(pc.codes[sym], uint(pc.lengths[sym]))
+	}
+}
+
+// writeTo writes the code lengths of pc, run-length coded and themselves
+// prefix coded.
+func (pc prefixCode) writeTo(bw *bitWriter) {
+	type token struct {
+		sym    int
+		nExtra uint
+		extra  uint32
+	}
+
+	var tokens []token
+	for i := 0; i < len(pc.lengths); {
+		l := pc.lengths[i]
+		run := 1
+		for i+run < len(pc.lengths) && pc.lengths[i+run] == l {
+			run++
+		}
+		i += run
+
+		if l == 0 {
+			for run > 0 {
+				switch {
+				case run >= 11:
+					n := min(run, 138)
+					tokens = append(tokens, token{18, 7, uint32(n - 11)})
+					run -= n
+				case run >= 3:
+					tokens = append(tokens, token{17, 3, uint32(run - 3)})
+					run = 0
+				default:
+					tokens = append(tokens, token{sym: 0})
+					run--
+				}
+			}
+			continue
+		}
+
+		tokens = append(tokens, token{sym: int(l)})
+		for run--; run > 0; {
+			if run >= 3 {
+				n := min(run, 6)
+				tokens = append(tokens, token{16, 2, uint32(n - 3)})
+				run -= n
+			} else {
+				tokens = append(tokens, token{sym: int(l)})
+				run--
+			}
+		}
+	}
+
+	hist := make([]uint32, len(codeLengthCodeOrder))
+	for _, t := range tokens {
+		hist[t.sym]++
+	}
+	clc := newPrefixCode(hist, 7)
+
+	n := len(codeLengthCodeOrder)
+	for n > 4 && clc.lengths[codeLengthCodeOrder[n-1]] == 0 {
+		n--
+	}
+	bw.write(0, 1) // not a simple code
+	bw.write(uint32(n-4), 4)
+	for _, s := range codeLengthCodeOrder[:n] {
+		bw.write(uint32(clc.lengths[s]), 3)
+	}
+	bw.write(0, 1) // lengths for the whole alphabet follow
+
+	for _, t := range tokens {
+		clc.put(bw, t.sym)
+		bw.write(t.extra, t.nExtra)
+	}
+}
@@ -0,0 +1,90 @@
+package eslip
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebP(t *testing.T) {
+	flat := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	gradient := image.NewNRGBA(image.Rect(0, 0, 67, 45))
+	noise := image.NewNRGBA(image.Rect(0, 0, 33, 17))
+	translucent := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	rnd := rand.New(rand.NewSource(1))
+	for y := 0; y < 45; y++ {
+		for x := 0; x < 67; x++ {
+			flat.Set(x%40, y%30, color.NRGBA{R: 0x0f, G: 0x9d, B: 0x58, A: 0xff})
+			gradient.Set(x, y, color.NRGBA{R: uint8(x * 3), G: uint8(y * 5), B: uint8(x + y), A: 0xff})
+			noise.Set(x%33, y%17, color.NRGBA{R: uint8(rnd.Intn(256)), G: uint8(rnd.Intn(256)), B: uint8(rnd.Intn(256)), A: 0xff})
+			translucent.Set(x%20, y%20, color.NRGBA{R: 0xff, G: uint8(x * 12), A: uint8(y * 12)})
+		}
+	}
+
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"a single pixel", image.NewNRGBA(image.Rect(0, 0, 1, 1))},
+		{"a flat image", flat},
+		{"a gradient", gradient},
+		{"noise", noise},
+		{"a translucent image", translucent},
+		{"an image not at the origin", gradient.SubImage(image.Rect(5, 7, 50, 40))},
+	}
+	for _, tt := range tests {
+		t.Run("given "+tt.name+" should decode to the same pixels", func(t *testing.T) {
+			var buf bytes.Buffer
+			err := encodeWebP(&buf, tt.img)
+			assert.NoError(t, err)
+
+			got, err := webp.Decode(&buf)
+
+			if assert.NoError(t, err) {
+				assertSamePixels(t, tt.img, got)
+			}
+		})
+	}
+
+	t.Run("given an e-slip should decode to the same pixels", func(t *testing.T) {
+		img := openPNG(t, "../../e-slip1.png")
+		var buf bytes.Buffer
+		err := encodeWebP(&buf, img)
+		assert.NoError(t, err)
+
+		got, err := webp.Decode(&buf)
+
+		if assert.NoError(t, err) {
+			assertSamePixels(t, img, got)
+		}
+	})
+
+	t.Run("given an image too wide should return error", func(t *testing.T) {
+		err := encodeWebP(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, vp8lMaxSize+1, 1)))
+
+		assert.Error(t, err)
+	})
+}
+
+func assertSamePixels(t *testing.T, want, got image.Image) {
+	t.Helper()
+	wb := want.Bounds()
+	gb := got.Bounds()
+	if !assert.Equal(t, wb.Size(), gb.Size()) {
+		return
+	}
+	for y := 0; y < wb.Dy(); y++ {
+		for x := 0; x < wb.Dx(); x++ {
+			w := color.NRGBAModel.Convert(want.At(wb.Min.X+x, wb.Min.Y+y))
+			g := color.NRGBAModel.Convert(got.At(gb.Min.X+x, gb.Min.Y+y))
+			if w != g {
+				t.Fatalf("pixel %d,%d is %v, want %v", x, y, g, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package eslip
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"go.uber.org/zap"
+)
+
+var errLeaseExpired = errors.New("the job was abandoned by its workers too many times")
+
+// Processor works through queued slip jobs: it hashes each stored slip,
+// drops it when the spender had already uploaded the same file, reads its
+// verification QR code and picture hash, stores thumbnails of it, records it
+// and reads a draft transaction off it. Jobs are claimed with SKIP LOCKED, so
+// any number of Processors, in this replica or others, can share the queue.
+type Processor struct {
+	db        *sql.DB
+	store     BlobStore
+	extractor Extractor
+	cfg       config.SlipJobs
+	thumbs    config.Thumbnails
+	logger    *zap.Logger
+	now       func() time.Time
+}
+
+// NewProcessor builds a Processor. extractor may be nil, in which case slips
+// get no draft transaction.
+func NewProcessor(db *sql.DB, store BlobStore, extractor Extractor, cfg config.SlipJobs, thumbs config.Thumbnails, logger *zap.Logger) *Processor {
+	return &Processor{db: db, store: store, extractor: extractor, cfg: cfg, thumbs: thumbs, logger: logger, now: time.Now}
+}
+
+// Run processes jobs with cfg.Workers workers until ctx is done. Each worker
+// finishes the job it holds when ctx is cancelled before it stops, and Run
+// returns once they all have, so shutdown never abandons a job halfway.
+func (p *Processor) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < max(p.cfg.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+
+	wg.Wait()
+	p.logger.Info("slip job workers stopped")
+}
+
+// work processes jobs back to back while there are any, and polls for new
+// ones every poll interval when the queue is empty.
+func (p *Processor) work(ctx context.Context) {
+	for {
+		worked, err := p.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			p.logger.Error("process slip job failed", zap.Error(err))
+		}
+		if worked && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.cfg.PollInterval):
+		}
+	}
+}
+
+// RunOnce claims one due job and processes it, and reports whether there was
+// one. The error is about the queue itself; a job that fails is retried or
+// buried, which RunOnce does not report as an error.
+func (p *Processor) RunOnce(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	now := p.now()
+	var j job
+	err := p.db.QueryRowContext(ctx, claimStmt, now.Add(p.cfg.Lease), now).
+		Scan(&j.ID, &j.SpenderID, &j.Key, &j.Filename, &j.ContentType, &j.Size, &j.UploadedBy, &j.CapturedAt, &j.Attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// The job is ours now; see it through even if ctx is cancelled.
+	ctx = context.WithoutCancel(ctx)
+	logger := p.logger.With(zap.Int("job_id", j.ID), zap.String("key", j.Key), zap.Int("attempt", j.Attempts))
+
+	if j.Attempts > p.cfg.MaxAttempts {
+		return true, p.fail(ctx, logger, j, errLeaseExpired)
+	}
+
+	result, err := p.process(ctx, logger, j)
+	if err != nil {
+		return true, p.fail(ctx, logger, j, err)
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return true, err
+	}
+	if _, err := p.db.ExecContext(ctx, completeStmt, j.ID, j.Attempts, body); err != nil {
+		return true, err
+	}
+
+	if result.Duplicate && result.Key != j.Key {
+		if err := p.store.Delete(ctx, j.Key); err != nil {
+			logger.Warn("delete duplicate slip failed", zap.Error(err))
+		}
+	}
+	logger.Info("slip job succeeded", zap.Bool("duplicate", result.Duplicate))
+	return true, nil
+}
+
+// fail queues j again after its backoff, or buries it when it has no
+// attempts left or its file is gone.
+func (p *Processor) fail(ctx context.Context, logger *zap.Logger, j job, cause error) error {
+	if j.Attempts >= p.cfg.MaxAttempts || errors.Is(cause, ErrBlobNotFound) {
+		logger.Error("slip job dead", zap.Error(cause))
+		_, err := p.db.ExecContext(ctx, buryStmt, j.ID, j.Attempts, cause.Error())
+		return err
+	}
+
+	runAt := p.now().Add(p.backoff(j.Attempts))
+	logger.Warn("slip job failed, retrying", zap.Time("run_at", runAt), zap.Error(cause))
+	_, err := p.db.ExecContext(ctx, retryStmt, j.ID, j.Attempts, runAt, cause.Error())
+	return err
+}
+
+// backoff is how long a job waits after its attempt-th failed attempt.
+func (p *Processor) backoff(attempt int) time.Duration {
+	d := p.cfg.Backoff
+	for i := 1; i < attempt && d < p.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, p.cfg.MaxBackoff)
+}
+
+// process processes the slip of j. Every step can be repeated, so an attempt
+// that failed halfway, or whose worker stopped, is simply run again: a slip
+// recorded by an earlier attempt is recognised by its key.
+func (p *Processor) process(ctx context.Context, logger *zap.Logger, j job) (UploadResult, error) {
+	result := UploadResult{Filename: j.Filename}
+
+	obj, err := p.store.Open(ctx, j.Key)
+	if err != nil {
+		return result, fmt.Errorf("open slip: %w", err)
+	}
+	defer obj.Body.Close()
+
+	f, ok := obj.Body.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(obj.Body)
+		if err != nil {
+			return result, fmt.Errorf("read slip: %w", err)
+		}
+		f = bytes.NewReader(data)
+	}
+
+	var img image.Image
+	var dhash sql.NullInt64
+	raster := j.ContentType == "image/jpeg" || j.ContentType == "image/png"
+	if raster {
+		img, err = decodeImage(f)
+		if err != nil {
+			logger.Info("slip image not decoded", zap.Error(err))
+		} else {
+			dhash = sql.NullInt64{Int64: int64(dHash(img)), Valid: true}
+			if result.QR, err = readSlipQR(img); err != nil {
+				logger.Info("slip QR not read", zap.Error(err))
+			}
+		}
+	}
+
+	sum, err := hashFile(f)
+	if err != nil {
+		return result, fmt.Errorf("hash slip: %w", err)
+	}
+
+	existing, found, err := findSlip(ctx, p.db, j.SpenderID, sum)
+	if err != nil {
+		return result, fmt.Errorf("find slip: %w", err)
+	}
+	if found && existing.Key != j.Key {
+		return p.duplicate(ctx, result, existing)
+	}
+	if !found {
+		// Thumbnails are stored before the slip is recorded, so a recorded
+		// slip always has the thumbnails it names.
+		var thumbs thumbnails
+		if img != nil && p.thumbs.Size > 0 {
+			if thumbs, err = p.storeThumbnails(ctx, j.Key, img); err != nil {
+				return result, fmt.Errorf("store thumbnails: %w", err)
+			}
+		}
+
+		recorded, err := recordSlip(ctx, p.db, j.Key, j.SpenderID, sum, dhash, j.ContentType, j.Size, j.UploadedBy, thumbs)
+		if err != nil {
+			return result, fmt.Errorf("record slip: %w", err)
+		}
+		if !recorded {
+			// The same file was recorded concurrently by another job.
+			p.deleteThumbnails(ctx, logger, thumbs)
+			existing, _, err := findSlip(ctx, p.db, j.SpenderID, sum)
+			if err != nil {
+				return result, fmt.Errorf("find slip: %w", err)
+			}
+			return p.duplicate(ctx, result, existing)
+		}
+	}
+
+	if raster && p.extractor != nil {
+		draft, err := p.extract(ctx, f, j.ContentType, result.QR)
+		// A slip that cannot be read is still a stored slip: the last attempt
+		// goes without a draft rather than burying the job.
+		if err != nil && j.Attempts < p.cfg.MaxAttempts {
+			return result, err
+		}
+		if err != nil {
+			logger.Warn("extract slip failed", zap.Error(err))
+		}
+		result.Draft = draft
+	}
+	if j.CapturedAt.Valid {
+		// The uploader asked for the time the picture was taken over any
+		// date read off the slip.
+		if result.Draft == nil {
+			result.Draft = &Draft{}
+		}
+		result.Draft.Date = j.CapturedAt.Time.Format(draftDateLayout)
+	}
+
+	result.Key = j.Key
+	result.ContentType = j.ContentType
+	result.Size = j.Size
+	return result, nil
+}
+
+// extract reads a draft transaction off the image in f. The reference of a
+// verification QR, when the slip has one, is exact and replaces whatever was
+// read off the printed text.
+func (p *Processor) extract(ctx context.Context, f io.ReadSeeker, contentType string, qr *SlipQR) (*Draft, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	draft, err := p.extractor.Extract(ctx, f, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("extract slip: %w", err)
+	}
+	if qr != nil {
+		draft.Reference = qr.TransactionRef
+	}
+
+	return &draft, nil
+}
+
+// duplicate describes in result the slip stored before with the same content.
+func (p *Processor) duplicate(ctx context.Context, result UploadResult, existing storedSlip) (UploadResult, error) {
+	tx, err := slipTransaction(ctx, p.db, existing.TransactionID)
+	if err != nil {
+		return result, fmt.Errorf("load slip transaction: %w", err)
+	}
+
+	result.Key = existing.Key
+	result.ContentType = existing.ContentType
+	result.Size = existing.Size
+	result.Duplicate = true
+	result.Transaction = tx
+	return result, nil
+}
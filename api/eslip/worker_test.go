@@ -0,0 +1,326 @@
+package eslip
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"golang.org/x/image/webp"
+)
+
+var (
+	jobCfg    = config.SlipJobs{Workers: 1, PollInterval: time.Millisecond, MaxAttempts: 3, Backoff: 10 * time.Second, MaxBackoff: time.Minute, Lease: 5 * time.Minute}
+	jobThumbs = config.Thumbnails{Size: 64, JPEGQuality: 80}
+	jobNow    = time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC)
+	jobCols   = []string{"id", "spender_id", "key", "filename", "content_type", "size", "uploaded_by", "captured_at", "attempts"}
+)
+
+func newProcessor(t *testing.T, store BlobStore, extractor Extractor) (*Processor, sqlmock.Sqlmock) {
+	db, mock := newMock(t)
+	p := NewProcessor(db, store, extractor, jobCfg, jobThumbs, zap.NewNop())
+	p.now = func() time.Time { return jobNow }
+	return p, mock
+}
+
+// storeSlip stores content under key in a fresh local store.
+func storeSlip(t *testing.T, key, content string) *LocalStore {
+	store, _ := NewLocalStore(t.TempDir())
+	assert.NoError(t, store.Put(context.Background(), key, bytes.NewReader([]byte(content)), int64(len(content)), ""))
+	return store
+}
+
+func expectClaim(mock sqlmock.Sqlmock, key, contentType string, attempts int) {
+	mock.ExpectQuery(claimStmt).WithArgs(jobNow.Add(jobCfg.Lease), jobNow).
+		WillReturnRows(sqlmock.NewRows(jobCols).AddRow(9, 1, key, "eslip.png", contentType, 70, 1, nil, attempts))
+}
+
+// resultArg matches the JSON result a job is completed with and keeps it.
+type resultArg struct{ got *UploadResult }
+
+func (a resultArg) Match(v driver.Value) bool {
+	b, ok := v.([]byte)
+	return ok && json.Unmarshal(b, a.got) == nil
+}
+
+func TestRunOnce(t *testing.T) {
+	t.Run("given no due job should report there was none", func(t *testing.T) {
+		p, mock := newProcessor(t, failingStore{}, nil)
+		mock.ExpectQuery(claimStmt).WillReturnRows(sqlmock.NewRows(jobCols))
+
+		worked, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.False(t, worked)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a new e-slip should record it with its QR, thumbnails and draft and complete the job", func(t *testing.T) {
+		slip, err := os.ReadFile("../../e-slip1.png")
+		assert.NoError(t, err)
+		extractor := FakeExtractor{Draft: Draft{Date: "2022-09-01 16:30:00", Amount: amount("888.88"), Currency: "THB", Reference: "12345678901234567B"}}
+		store := storeSlip(t, "k.png", string(slip))
+		p, mock := newProcessor(t, store, extractor)
+		expectClaim(mock, "k.png", "image/png", 1)
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(slipCols))
+		mock.ExpectExec(insertSlipStmt).
+			WithArgs("k.png", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), "image/png", 70, 1, "k.thumb.jpg", "k.thumb.webp").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		var result UploadResult
+		mock.ExpectExec(completeStmt).WithArgs(9, 1, resultArg{&result}).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		worked, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, worked)
+		assert.Equal(t, "k.png", result.Key)
+		assert.False(t, result.Duplicate)
+		if assert.NotNil(t, result.QR) {
+			assert.Equal(t, "004", result.QR.SendingBank)
+		}
+		assert.Equal(t, &Draft{Date: "2022-09-01 16:30:00", Amount: amount("888.88"), Currency: "THB", Reference: "012048104549301021"}, result.Draft,
+			"the QR reference replaces the one read off the text")
+		for key, decode := range map[string]func(io.Reader) (image.Image, error){"k.thumb.jpg": jpeg.Decode, "k.thumb.webp": webp.Decode} {
+			obj, err := store.Open(context.Background(), key)
+			if assert.NoError(t, err, key) {
+				thumb, err := decode(obj.Body)
+				obj.Body.Close()
+				assert.NoError(t, err, key)
+				assert.Equal(t, image.Pt(53, 64), thumb.Bounds().Size(), key)
+			}
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given thumbnails are turned off should record the slip without them", func(t *testing.T) {
+		store := storeSlip(t, "k.png", pngImage())
+		p, mock := newProcessor(t, store, nil)
+		p.thumbs.Size = 0
+		expectClaim(mock, "k.png", "image/png", 1)
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(slipCols))
+		mock.ExpectExec(insertSlipStmt).
+			WithArgs("k.png", 1, sqlmock.AnyArg(), sqlmock.AnyArg(), "image/png", 70, 1, "", "").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(completeStmt).WithArgs(9, 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		_, err = store.Open(context.Background(), "k.thumb.jpg")
+		assert.ErrorIs(t, err, ErrBlobNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given the uploader asked for the capture time should date the draft with it", func(t *testing.T) {
+		extractor := FakeExtractor{Draft: Draft{Date: "2022-09-01 16:30:00", Amount: amount("120.00")}}
+		store := storeSlip(t, "k.jpg", jpegImage())
+		p, mock := newProcessor(t, store, extractor)
+		mock.ExpectQuery(claimStmt).WithArgs(jobNow.Add(jobCfg.Lease), jobNow).
+			WillReturnRows(sqlmock.NewRows(jobCols).AddRow(9, 1, "k.jpg", "receipt.jpg", "image/jpeg", 70, 1, time.Date(2024, 7, 10, 9, 30, 0, 0, time.UTC), 1))
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(slipCols))
+		mock.ExpectExec(insertSlipStmt).WillReturnResult(sqlmock.NewResult(0, 1))
+		var result UploadResult
+		mock.ExpectExec(completeStmt).WithArgs(9, 1, resultArg{&result}).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, &Draft{Date: "2024-07-10 09:30:00", Amount: amount("120.00")}, result.Draft)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a file the spender uploaded before should complete with the stored slip and drop the copy", func(t *testing.T) {
+		store := storeSlip(t, "k.png", pngImage())
+		p, mock := newProcessor(t, store, nil)
+		expectClaim(mock, "k.png", "image/png", 1)
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(slipCols).AddRow("first.png", "image/png", 70, 7))
+		mock.ExpectQuery(slipTxStmt).WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(txCols).AddRow(7, "2024-05-11 15:04:05", 250, "food", "expense", "", "/api/v1/slips/first.png", 1, "THB", 250, "THB", 1, ""))
+		var result UploadResult
+		mock.ExpectExec(completeStmt).WithArgs(9, 1, resultArg{&result}).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		worked, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, worked)
+		assert.True(t, result.Duplicate)
+		assert.Equal(t, "first.png", result.Key)
+		if assert.NotNil(t, result.Transaction) {
+			assert.Equal(t, uint(7), result.Transaction.ID)
+		}
+		_, err = store.Open(context.Background(), "k.png")
+		assert.ErrorIs(t, err, ErrBlobNotFound)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given the same file recorded concurrently should complete with the first", func(t *testing.T) {
+		p, mock := newProcessor(t, storeSlip(t, "k.pdf", pdfDocument), nil)
+		expectClaim(mock, "k.pdf", "application/pdf", 1)
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(slipCols))
+		mock.ExpectExec(insertSlipStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(slipCols).AddRow("first.pdf", "application/pdf", 70, nil))
+		var result UploadResult
+		mock.ExpectExec(completeStmt).WithArgs(9, 1, resultArg{&result}).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, result.Duplicate)
+		assert.Equal(t, "first.pdf", result.Key)
+		assert.Nil(t, result.Transaction)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given the same image recorded concurrently should drop its thumbnails", func(t *testing.T) {
+		store := storeSlip(t, "k.png", pngImage())
+		p, mock := newProcessor(t, store, nil)
+		expectClaim(mock, "k.png", "image/png", 1)
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(slipCols))
+		mock.ExpectExec(insertSlipStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(slipCols).AddRow("first.png", "image/png", 70, nil))
+		mock.ExpectExec(completeStmt).WithArgs(9, 1, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		for _, key := range []string{"k.png", "k.thumb.jpg", "k.thumb.webp"} {
+			_, err = store.Open(context.Background(), key)
+			assert.ErrorIs(t, err, ErrBlobNotFound, key)
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a slip recorded by an earlier attempt should not record it again", func(t *testing.T) {
+		p, mock := newProcessor(t, storeSlip(t, "k.pdf", pdfDocument), nil)
+		expectClaim(mock, "k.pdf", "application/pdf", 2)
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(slipCols).AddRow("k.pdf", "application/pdf", 70, nil))
+		var result UploadResult
+		mock.ExpectExec(completeStmt).WithArgs(9, 2, resultArg{&result}).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.False(t, result.Duplicate)
+		assert.Equal(t, "k.pdf", result.Key)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a failing attempt should queue the job again after its backoff", func(t *testing.T) {
+		p, mock := newProcessor(t, failingStore{}, nil)
+		expectClaim(mock, "k.png", "image/png", 2)
+		mock.ExpectExec(retryStmt).WithArgs(9, 2, jobNow.Add(20*time.Second), "open slip: disk full").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		worked, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.True(t, worked)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given the last attempt fails should bury the job", func(t *testing.T) {
+		p, mock := newProcessor(t, failingStore{}, nil)
+		expectClaim(mock, "k.png", "image/png", 3)
+		mock.ExpectExec(buryStmt).WithArgs(9, 3, "open slip: disk full").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given the slip is gone should bury the job at once", func(t *testing.T) {
+		store, _ := NewLocalStore(t.TempDir())
+		p, mock := newProcessor(t, store, nil)
+		expectClaim(mock, "k.png", "image/png", 1)
+		mock.ExpectExec(buryStmt).WithArgs(9, 1, "open slip: "+ErrBlobNotFound.Error()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a job abandoned too many times should bury it without running it", func(t *testing.T) {
+		p, mock := newProcessor(t, failingStore{}, nil)
+		expectClaim(mock, "k.png", "image/png", 4)
+		mock.ExpectExec(buryStmt).WithArgs(9, 4, errLeaseExpired.Error()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := p.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given the extractor fails should retry and finally complete without a draft", func(t *testing.T) {
+		extractor := FakeExtractor{Err: errors.New("ocr crashed")}
+		store := storeSlip(t, "k.png", pngImage())
+		p, mock := newProcessor(t, store, extractor)
+		expectClaim(mock, "k.png", "image/png", 1)
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(slipCols))
+		mock.ExpectExec(insertSlipStmt).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(retryStmt).WithArgs(9, 1, jobNow.Add(10*time.Second), "extract slip: ocr crashed").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		expectClaim(mock, "k.png", "image/png", 3)
+		mock.ExpectQuery(findSlipStmt).WithArgs(1, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows(slipCols).AddRow("k.png", "image/png", 70, nil))
+		var result UploadResult
+		mock.ExpectExec(completeStmt).WithArgs(9, 3, resultArg{&result}).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := p.RunOnce(context.Background())
+		assert.NoError(t, err)
+		_, err = p.RunOnce(context.Background())
+		assert.NoError(t, err)
+
+		assert.Equal(t, "k.png", result.Key)
+		assert.Nil(t, result.Draft)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	p := NewProcessor(nil, nil, nil, jobCfg, jobThumbs, zap.NewNop())
+
+	for attempt, want := range map[int]time.Duration{1: 10 * time.Second, 2: 20 * time.Second, 3: 40 * time.Second, 4: time.Minute, 60: time.Minute} {
+		assert.Equal(t, want, p.backoff(attempt), "attempt %d", attempt)
+	}
+}
+
+func TestProcessorRun(t *testing.T) {
+	t.Run("given ctx is cancelled should stop its workers and return", func(t *testing.T) {
+		p, mock := newProcessor(t, failingStore{}, nil)
+		mock.MatchExpectationsInOrder(false)
+		for i := 0; i < 10; i++ {
+			mock.ExpectQuery(claimStmt).WillReturnRows(sqlmock.NewRows(jobCols))
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan struct{})
+		go func() {
+			p.Run(ctx)
+			close(done)
+		}()
+		cancel()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after ctx was cancelled")
+		}
+	})
+}
@@ -0,0 +1,251 @@
+package exchange
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/go-playground/validator/v10"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// DefaultCurrency is used for transactions and spenders that do not name one.
+const DefaultCurrency = "THB"
+
+// RateSQL converts a transaction into its spender's home currency using the
+// latest rate effective on the transaction date. It expects the transaction
+// to be aliased as t and the spender as s, and is NULL when no rate is loaded.
+const RateSQL = `CASE WHEN t.currency = s.home_currency THEN 1 ELSE (SELECT r.rate FROM exchange_rates r WHERE r.base = t.currency AND r.quote = s.home_currency AND r.effective_date <= t.date::date ORDER BY r.effective_date DESC LIMIT 1) END`
+
+var (
+	ErrInvalidCurrency = errors.New("the value of currency must be an ISO 4217 code")
+	ErrInvalidRate     = errors.New("the value of rate must be a number greater than 0")
+	ErrRatePrecision   = errors.New("the value of rate must have at most 10 digits before the decimal point and 8 after it")
+	ErrInvalidCSV      = errors.New("csv must have the columns base, quote, rate, effective_date")
+)
+
+var codes = validator.New()
+
+// NormalizeCurrency upper-cases an ISO 4217 code, defaulting an empty one to
+// DefaultCurrency.
+func NormalizeCurrency(code string) (string, error) {
+	if code == "" {
+		return DefaultCurrency, nil
+	}
+
+	code = strings.ToUpper(code)
+	if err := codes.Var(code, "iso4217"); err != nil {
+		return "", ErrInvalidCurrency
+	}
+
+	return code, nil
+}
+
+// Rate converts one unit of Base into Quote from EffectiveDate onwards.
+type Rate struct {
+	Base          string      `json:"base" validate:"required,iso4217"`
+	Quote         string      `json:"quote" validate:"required,iso4217,nefield=Base"`
+	Rate          json.Number `json:"rate" validate:"required"`
+	EffectiveDate string      `json:"effective_date" validate:"required,datetime=2006-01-02"`
+}
+
+type handler struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *handler {
+	return &handler{db}
+}
+
+const (
+	listStmt   = `SELECT base, quote, rate, effective_date FROM exchange_rates WHERE ($1 = '' OR base = $1) AND ($2 = '' OR quote = $2) ORDER BY effective_date DESC, base, quote`
+	upsertStmt = `INSERT INTO exchange_rates (base, quote, rate, effective_date) VALUES ($1, $2, $3, $4) ON CONFLICT (base, quote, effective_date) DO UPDATE SET rate = EXCLUDED.rate`
+)
+
+func (h handler) GetAll(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	base := strings.ToUpper(c.QueryParam("base"))
+	quote := strings.ToUpper(c.QueryParam("quote"))
+	rows, err := h.db.QueryContext(ctx, listStmt, base, quote)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	defer rows.Close()
+
+	rates := make([]Rate, 0)
+	for rows.Next() {
+		var r Rate
+		var rate string
+		var effective time.Time
+		if err := rows.Scan(&r.Base, &r.Quote, &rate, &effective); err != nil {
+			logger.Error("scan error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		r.Rate = json.Number(rate)
+		r.EffectiveDate = effective.Format(time.DateOnly)
+		rates = append(rates, r)
+	}
+
+	return c.JSON(http.StatusOK, rates)
+}
+
+// Load upserts a JSON array of rates in a single database transaction.
+func (h handler) Load(c echo.Context) error {
+	logger := mlog.L(c)
+
+	var rates []Rate
+	if err := c.Bind(&rates); err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	return h.save(c, rates)
+}
+
+// Import upserts rates from a CSV file uploaded in the file form field. The
+// first row must be the header base,quote,rate,effective_date.
+func (h handler) Import(c echo.Context) error {
+	logger := mlog.L(c)
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		logger.Error("open file error", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+	defer f.Close()
+
+	rates, err := ParseCSV(f)
+	if err != nil {
+		logger.Error("parse csv error", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	return h.save(c, rates)
+}
+
+func (h handler) save(c echo.Context, rates []Rate) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var messages []string
+	for i := range rates {
+		rates[i].Base = strings.ToUpper(rates[i].Base)
+		rates[i].Quote = strings.ToUpper(rates[i].Quote)
+		if err := c.Validate(rates[i]); err != nil {
+			for _, m := range errs.ParseError(err).Messages {
+				messages = append(messages, fmt.Sprintf("rates[%d]: %s", i, m))
+			}
+			continue
+		}
+		if err := validRate(rates[i].Rate); err != nil {
+			messages = append(messages, fmt.Sprintf("rates[%d]: %s", i, err))
+		}
+	}
+	if len(messages) > 0 {
+		logger.Error("validate rates failed", zap.Strings("messages", messages))
+		return c.JSON(http.StatusBadRequest, errs.ErrorResponse{Messages: messages})
+	}
+
+	if err := h.upsert(ctx, rates); err != nil {
+		logger.Error("upsert rates error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	logger.Info("load exchange rates successfully", zap.Int("count", len(rates)))
+	return c.JSON(http.StatusCreated, rates)
+}
+
+func (h handler) upsert(ctx context.Context, rates []Rate) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, r := range rates {
+		if _, err := tx.ExecContext(ctx, upsertStmt, r.Base, r.Quote, r.Rate.String(), r.EffectiveDate); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Rates are stored as NUMERIC(18,8): ten digits before the decimal point and
+// eight after it.
+var (
+	rateScale = big.NewRat(100_000_000, 1)
+	rateLimit = big.NewRat(10_000_000_000, 1)
+)
+
+func validRate(n json.Number) error {
+	r, ok := new(big.Rat).SetString(n.String())
+	if !ok || r.Sign() <= 0 {
+		return ErrInvalidRate
+	}
+	if r.Cmp(rateLimit) >= 0 || !new(big.Rat).Mul(r, rateScale).IsInt() {
+		return ErrRatePrecision
+	}
+	return nil
+}
+
+// ParseCSV reads rates from CSV with a base,quote,rate,effective_date header.
+func ParseCSV(r io.Reader) ([]Rate, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, ErrInvalidCSV
+	}
+
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"base", "quote", "rate", "effective_date"} {
+		if _, ok := cols[name]; !ok {
+			return nil, ErrInvalidCSV
+		}
+	}
+
+	var rates []Rate
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rates = append(rates, Rate{
+			Base:          strings.TrimSpace(rec[cols["base"]]),
+			Quote:         strings.TrimSpace(rec[cols["quote"]]),
+			Rate:          json.Number(strings.TrimSpace(rec[cols["rate"]])),
+			EffectiveDate: strings.TrimSpace(rec[cols["effective_date"]]),
+		})
+	}
+
+	return rates, nil
+}
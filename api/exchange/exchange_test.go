@@ -0,0 +1,218 @@
+package exchange
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeCurrency(t *testing.T) {
+	tests := []struct {
+		code     string
+		expected string
+		err      error
+	}{
+		{"", DefaultCurrency, nil},
+		{"usd", "USD", nil},
+		{"JPY", "JPY", nil},
+		{"ABC", "", ErrInvalidCurrency},
+		{"BAHT", "", ErrInvalidCurrency},
+	}
+
+	for _, tt := range tests {
+		code, err := NormalizeCurrency(tt.code)
+		assert.Equal(t, tt.expected, code)
+		assert.Equal(t, tt.err, err)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	t.Run("given csv with header should parse rates", func(t *testing.T) {
+		rates, err := ParseCSV(strings.NewReader("effective_date,base,quote,rate\n2024-05-01,USD,THB,36.5\n2024-05-01, jpy, THB, 0.2351\n"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Rate{
+			{Base: "USD", Quote: "THB", Rate: "36.5", EffectiveDate: "2024-05-01"},
+			{Base: "jpy", Quote: "THB", Rate: "0.2351", EffectiveDate: "2024-05-01"},
+		}, rates)
+	})
+
+	t.Run("given csv without required column should return error", func(t *testing.T) {
+		_, err := ParseCSV(strings.NewReader("base,quote,rate\nUSD,THB,36.5\n"))
+
+		assert.Equal(t, ErrInvalidCSV, err)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("given valid rates should upsert them in one transaction", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[{"base": "usd", "quote": "THB", "rate": 36.5, "effective_date": "2024-05-01"}, {"base": "JPY", "quote": "THB", "rate": "0.2351", "effective_date": "2024-05-01"}]`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(upsertStmt).WithArgs("USD", "THB", "36.5", "2024-05-01").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(upsertStmt).WithArgs("JPY", "THB", "0.2351", "2024-05-01").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		h := New(db)
+		err := h.Load(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given invalid rates should return every error by index", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[{"base": "XXY", "quote": "THB", "rate": 1, "effective_date": "2024-05-01"}, {"base": "USD", "quote": "THB", "rate": -1, "effective_date": "2024-05-01"}]`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(nil)
+		err := h.Load(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["rates[0]: the value of Base must be an ISO 4217 currency code", "rates[1]: the value of rate must be a number greater than 0"]}`, rec.Body.String())
+	})
+
+	t.Run("given rate finer or larger than the column holds should return bad request", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[{"base": "USD", "quote": "THB", "rate": 0.123456789, "effective_date": "2024-05-01"}, {"base": "USD", "quote": "THB", "rate": 12345678901, "effective_date": "2024-05-01"}, {"base": "USD", "quote": "THB", "rate": 1e-9, "effective_date": "2024-05-01"}]`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(nil)
+		err := h.Load(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		msg := "the value of rate must have at most 10 digits before the decimal point and 8 after it"
+		assert.JSONEq(t, `{"messages":["rates[0]: `+msg+`", "rates[1]: `+msg+`", "rates[2]: `+msg+`"]}`, rec.Body.String())
+	})
+
+	t.Run("given database failure should roll back", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`[{"base": "USD", "quote": "THB", "rate": 36.5, "effective_date": "2024-05-01"}]`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(upsertStmt).WithArgs("USD", "THB", "36.5", "2024-05-01").WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		h := New(db)
+		err := h.Load(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestImport(t *testing.T) {
+	t.Run("given csv file should upsert its rates", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		part, _ := w.CreateFormFile("file", "rates.csv")
+		part.Write([]byte("base,quote,rate,effective_date\nUSD,THB,36.5,2024-05-01\n"))
+		w.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", body)
+		req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(upsertStmt).WithArgs("USD", "THB", "36.5", "2024-05-01").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		h := New(db)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `[{"base": "USD", "quote": "THB", "rate": 36.5, "effective_date": "2024-05-01"}]`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given request without file should return error", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(nil)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
+
+func TestGetAll(t *testing.T) {
+	t.Run("given base filter should list matching rates", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/?base=usd", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(listStmt).WithArgs("USD", "").
+			WillReturnRows(sqlmock.NewRows([]string{"base", "quote", "rate", "effective_date"}).
+				AddRow("USD", "THB", "36.50000000", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+
+		h := New(db)
+		err := h.GetAll(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[{"base": "USD", "quote": "THB", "rate": 36.50000000, "effective_date": "2024-05-01"}]`, rec.Body.String())
+	})
+}
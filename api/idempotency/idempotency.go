@@ -0,0 +1,197 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	HeaderKey      = "Idempotency-Key"
+	HeaderReplayed = "Idempotent-Replayed"
+
+	maxKeyLength = 255
+)
+
+var (
+	ErrInvalidKey = errors.New("Idempotency-Key must be between 1 and 255 characters")
+	ErrKeyReused  = errors.New("Idempotency-Key was already used with a different request")
+	ErrInProgress = errors.New("a request with this Idempotency-Key is still in progress")
+)
+
+// replayHeaders are the response headers stored with a result and sent again
+// on replay. Content-Type is always kept.
+var replayHeaders = []string{echo.HeaderContentType, echo.HeaderLocation, utils.HeaderETag}
+
+const (
+	// claimStmt takes the key for this request. A live key held by an earlier
+	// request is left alone and no row is returned; an expired one is
+	// reclaimed as if it were new.
+	claimStmt   = `INSERT INTO idempotency_key (scope, key, request_hash, expires_at) VALUES ($1, $2, $3, $4) ON CONFLICT (scope, key) DO UPDATE SET request_hash = EXCLUDED.request_hash, status_code = NULL, response_headers = NULL, response_body = NULL, created_at = now(), expires_at = EXCLUDED.expires_at WHERE idempotency_key.expires_at < now() RETURNING key`
+	lookupStmt  = `SELECT request_hash, status_code, response_headers, response_body FROM idempotency_key WHERE scope = $1 AND key = $2`
+	saveStmt    = `UPDATE idempotency_key SET status_code = $3, response_headers = $4, response_body = $5 WHERE scope = $1 AND key = $2`
+	releaseStmt = `DELETE FROM idempotency_key WHERE scope = $1 AND key = $2`
+)
+
+// Middleware makes requests carrying an Idempotency-Key header safe to retry.
+// The first request with a key runs and its response is kept for ttl; a
+// retry with the same body gets that response back without running again,
+// and one with a different body gets 409 Conflict. Keys are scoped to the
+// authenticated caller. Server errors release the key so the client can retry.
+func Middleware(db *sql.DB, ttl time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderKey)
+			if key == "" {
+				return next(c)
+			}
+
+			logger := mlog.L(c).With(zap.String("idempotency_key", key))
+			ctx := c.Request().Context()
+
+			if len(key) > maxKeyLength {
+				return c.JSON(http.StatusBadRequest, errs.ParseError(ErrInvalidKey))
+			}
+
+			p, ok := auth.PrincipalFrom(c)
+			if !ok {
+				return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+			}
+			scope := Scope(p)
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				logger.Error("read request body error", zap.Error(err))
+				return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+			hash := RequestHash(c.Request(), body)
+
+			err = db.QueryRowContext(ctx, claimStmt, scope, key, hash, time.Now().Add(ttl)).Scan(&key)
+			if errors.Is(err, sql.ErrNoRows) {
+				return replay(c, db, scope, key, hash)
+			}
+			if err != nil {
+				logger.Error("claim idempotency key error", zap.Error(err))
+				return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+			}
+
+			rec := &recorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = rec
+
+			err = next(c)
+			status := c.Response().Status
+			if err != nil || status >= http.StatusInternalServerError {
+				// Use a fresh context: the request's may be done by now and
+				// a stuck claim would block every retry until it expires.
+				if _, rerr := db.ExecContext(context.Background(), releaseStmt, scope, key); rerr != nil {
+					logger.Error("release idempotency key error", zap.Error(rerr))
+				}
+				return err
+			}
+
+			headers, _ := json.Marshal(keep(c.Response().Header()))
+			if _, err := db.ExecContext(context.Background(), saveStmt, scope, key, status, string(headers), rec.body.Bytes()); err != nil {
+				logger.Error("save idempotent response error", zap.Error(err))
+			}
+
+			return nil
+		}
+	}
+}
+
+func replay(c echo.Context, db *sql.DB, scope, key, hash string) error {
+	logger := mlog.L(c).With(zap.String("idempotency_key", key))
+
+	var storedHash string
+	var status sql.NullInt64
+	var headers sql.NullString
+	var body []byte
+	err := db.QueryRowContext(c.Request().Context(), lookupStmt, scope, key).Scan(&storedHash, &status, &headers, &body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The holder released the key between our claim and lookup.
+		logger.Warn("idempotency key released concurrently")
+		return c.JSON(http.StatusConflict, errs.ParseError(ErrInProgress))
+	}
+	if err != nil {
+		logger.Error("lookup idempotency key error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	if storedHash != hash {
+		logger.Warn("idempotency key reused with different request")
+		return c.JSON(http.StatusConflict, errs.ParseError(ErrKeyReused))
+	}
+
+	if !status.Valid {
+		logger.Warn("idempotency key still in progress")
+		return c.JSON(http.StatusConflict, errs.ParseError(ErrInProgress))
+	}
+
+	var h map[string]string
+	_ = json.Unmarshal([]byte(headers.String), &h)
+	for name, value := range h {
+		c.Response().Header().Set(name, value)
+	}
+	c.Response().Header().Set(HeaderReplayed, "true")
+
+	logger.Info("replay idempotent response", zap.Int64("status", status.Int64))
+	c.Response().WriteHeader(int(status.Int64))
+	_, err = c.Response().Write(body)
+	return err
+}
+
+// Scope identifies the caller a key belongs to, so two clients choosing the
+// same key never see each other's responses.
+func Scope(p auth.Principal) string {
+	if p.IsService() {
+		return fmt.Sprintf("service:%d", p.ServiceKeyID)
+	}
+
+	return fmt.Sprintf("spender:%d", p.SpenderID)
+}
+
+// RequestHash fingerprints the method, path and body of a request.
+func RequestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func keep(header http.Header) map[string]string {
+	kept := map[string]string{}
+	for _, name := range replayHeaders {
+		if v := header.Get(name); v != "" {
+			kept[name] = v
+		}
+	}
+
+	return kept
+}
+
+// recorder copies the response body while it is written to the client.
+type recorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,170 @@
+package idempotency
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const body = `{"amount": 30, "category": "food"}`
+
+type anyTime struct{}
+
+func (anyTime) Match(v driver.Value) bool {
+	_, ok := v.(time.Time)
+	return ok
+}
+
+func newContext(key, reqBody string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/transactions", strings.NewReader(reqBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+	return c, rec
+}
+
+func created(c echo.Context) error {
+	c.Response().Header().Set("ETag", `"1"`)
+	return c.JSON(http.StatusCreated, map[string]int{"id": 1})
+}
+
+func TestMiddleware(t *testing.T) {
+	hash := RequestHash(httptest.NewRequest(http.MethodPost, "/transactions", nil), []byte(body))
+
+	t.Run("given no key should pass through", func(t *testing.T) {
+		c, rec := newContext("", body)
+
+		err := Middleware(nil, time.Hour)(created)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	t.Run("given key too long should return bad request", func(t *testing.T) {
+		c, rec := newContext(strings.Repeat("k", 256), body)
+
+		err := Middleware(nil, time.Hour)(created)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("given new key should run handler and store its response", func(t *testing.T) {
+		c, rec := newContext("abc", body)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(claimStmt).WithArgs("spender:1", "abc", hash, anyTime{}).
+			WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("abc"))
+		mock.ExpectExec(saveStmt).
+			WithArgs("spender:1", "abc", http.StatusCreated, `{"Content-Type":"application/json","ETag":"\"1\""}`, []byte("{\"id\":1}\n")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := Middleware(db, time.Hour)(created)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Empty(t, rec.Header().Get(HeaderReplayed))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given completed key with same body should replay response", func(t *testing.T) {
+		c, rec := newContext("abc", body)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(claimStmt).WithArgs("spender:1", "abc", hash, anyTime{}).
+			WillReturnRows(sqlmock.NewRows([]string{"key"}))
+		mock.ExpectQuery(lookupStmt).WithArgs("spender:1", "abc").
+			WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_headers", "response_body"}).
+				AddRow(hash, http.StatusCreated, `{"Content-Type":"application/json","ETag":"\"1\""}`, []byte(`{"id":1}`)))
+
+		called := false
+		err := Middleware(db, time.Hour)(func(c echo.Context) error {
+			called = true
+			return nil
+		})(c)
+
+		assert.NoError(t, err)
+		assert.False(t, called)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, "true", rec.Header().Get(HeaderReplayed))
+		assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+		assert.JSONEq(t, `{"id": 1}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given key used with different body should return conflict", func(t *testing.T) {
+		c, rec := newContext("abc", `{"amount": 99}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(claimStmt).WillReturnRows(sqlmock.NewRows([]string{"key"}))
+		mock.ExpectQuery(lookupStmt).WithArgs("spender:1", "abc").
+			WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_headers", "response_body"}).
+				AddRow(hash, http.StatusCreated, `{}`, []byte(`{"id":1}`)))
+
+		err := Middleware(db, time.Hour)(created)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.JSONEq(t, `{"messages": ["Idempotency-Key was already used with a different request"]}`, rec.Body.String())
+	})
+
+	t.Run("given key still in progress should return conflict", func(t *testing.T) {
+		c, rec := newContext("abc", body)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(claimStmt).WillReturnRows(sqlmock.NewRows([]string{"key"}))
+		mock.ExpectQuery(lookupStmt).WithArgs("spender:1", "abc").
+			WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_headers", "response_body"}).
+				AddRow(hash, nil, nil, nil))
+
+		err := Middleware(db, time.Hour)(created)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.JSONEq(t, `{"messages": ["a request with this Idempotency-Key is still in progress"]}`, rec.Body.String())
+	})
+
+	t.Run("given server error should release key", func(t *testing.T) {
+		c, rec := newContext("abc", body)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(claimStmt).WillReturnRows(sqlmock.NewRows([]string{"key"}).AddRow("abc"))
+		mock.ExpectExec(releaseStmt).WithArgs("spender:1", "abc").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := Middleware(db, time.Hour)(func(c echo.Context) error {
+			return c.JSON(http.StatusInternalServerError, map[string]string{})
+		})(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestScope(t *testing.T) {
+	assert.Equal(t, "spender:7", Scope(auth.Principal{SpenderID: 7}))
+	assert.Equal(t, "service:3", Scope(auth.Principal{Role: auth.RoleService, ServiceKeyID: 3}))
+}
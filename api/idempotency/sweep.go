@@ -0,0 +1,58 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sweepStmt deletes the keys whose responses are no longer replayed. claimStmt
+// reclaims an expired key when the same key comes back, but most never do.
+const sweepStmt = `DELETE FROM idempotency_key WHERE expires_at < $1`
+
+// Sweeper deletes expired idempotency keys, which would otherwise pile up in
+// idempotency_key for good.
+type Sweeper struct {
+	db       *sql.DB
+	interval time.Duration
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+func NewSweeper(db *sql.DB, interval time.Duration, logger *zap.Logger) *Sweeper {
+	return &Sweeper{db: db, interval: interval, logger: logger, now: time.Now}
+}
+
+// Run sweeps straight away and then every interval until ctx is done.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := s.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("delete expired idempotency keys failed", zap.Error(err))
+		}
+		if deleted > 0 {
+			s.logger.Info("expired idempotency keys deleted", zap.Int64("deleted", deleted))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce deletes the keys expired by now and returns how many it deleted.
+func (s *Sweeper) RunOnce(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, sweepStmt, s.now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
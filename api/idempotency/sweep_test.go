@@ -0,0 +1,41 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestSweeper(t *testing.T) {
+	now := time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC)
+
+	t.Run("given expired keys should delete them", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(sweepStmt).WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 3))
+		s := NewSweeper(db, time.Hour, zap.NewNop())
+		s.now = func() time.Time { return now }
+
+		deleted, err := s.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), deleted)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given the delete fails should return error", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectExec(sweepStmt).WillReturnError(errors.New("connection reset"))
+		s := NewSweeper(db, time.Hour, zap.NewNop())
+
+		_, err := s.RunOnce(context.Background())
+
+		assert.Error(t, err)
+	})
+}
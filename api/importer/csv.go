@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+)
+
+// headerSearchRows is how far into a statement the header row may appear.
+// Bank exports usually open with a few lines of account details.
+const headerSearchRows = 20
+
+// buddhistEraOffset is how many years the Thai calendar runs ahead.
+const buddhistEraOffset = 543
+
+var (
+	ErrNoAmount    = errors.New("row has neither a debit nor a credit amount")
+	ErrBothAmounts = errors.New("row has both a debit and a credit amount")
+)
+
+var beYear = regexp.MustCompile(`\b2[4-9]\d\d\b`)
+
+// ParseCSV reads a CSV statement with p. It fails only when the file itself is
+// unusable; rows that cannot be mapped are returned as RowErrors alongside
+// the rows that could. Rows without a date, such as totals, are skipped.
+func ParseCSV(r io.Reader, p Profile) ([]Record, []RowError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	cols, err := findHeader(cr, p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var records []Record
+	var rowErrs []RowError
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+
+		cell := func(name string) string {
+			i, ok := cols[strings.ToLower(name)]
+			if name == "" || !ok || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+
+		if cell(p.DateColumn) == "" {
+			continue
+		}
+
+		record, err := mapRow(p, cell)
+		if err != nil {
+			rowErrs = append(rowErrs, RowError{Line: line, Err: err})
+			continue
+		}
+		record.Line = line
+		records = append(records, record)
+	}
+
+	return records, rowErrs, nil
+}
+
+// findHeader advances cr past the header row and returns the index of every
+// column by lower-cased name.
+func findHeader(cr *csv.Reader, p Profile) (map[string]int, error) {
+	want := p.columns()
+	for i := 0; i < headerSearchRows; i++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		cols := map[string]int{}
+		for j, name := range rec {
+			name = strings.TrimPrefix(name, "\ufeff")
+			cols[strings.ToLower(strings.TrimSpace(name))] = j
+		}
+
+		found := true
+		for _, name := range want {
+			if _, ok := cols[strings.ToLower(name)]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			return cols, nil
+		}
+	}
+
+	return nil, fmt.Errorf("could not find a header row with columns %s", strings.Join(want, ", "))
+}
+
+func mapRow(p Profile, cell func(string) string) (Record, error) {
+	date, err := parseDate(p, cell(p.DateColumn), cell(p.TimeColumn))
+	if err != nil {
+		return Record{}, err
+	}
+
+	amount, txType, err := parseAmount(p, cell)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return newRecord(p, date, amount, txType, cell(p.CategoryColumn), cell(p.NoteColumn), cell(p.ReferenceColumn)), nil
+}
+
+func parseDate(p Profile, date, clock string) (string, error) {
+	if p.BuddhistEra {
+		date = beYear.ReplaceAllStringFunc(date, func(y string) string {
+			n, _ := strconv.Atoi(y)
+			return strconv.Itoa(n - buddhistEraOffset)
+		})
+	}
+
+	layout := p.DateFormat
+	if p.TimeColumn != "" && clock != "" {
+		timeFormat := p.TimeFormat
+		if timeFormat == "" {
+			timeFormat = "15:04"
+		}
+		layout += " " + timeFormat
+		date += " " + clock
+	}
+
+	t, err := time.Parse(layout, date)
+	if err != nil {
+		return "", fmt.Errorf("date %q does not match format %q", date, layout)
+	}
+
+	return t.Format(dateLayout), nil
+}
+
+func parseAmount(p Profile, cell func(string) string) (money.Money, string, error) {
+	if p.AmountColumn != "" {
+		amount, err := parseMoney(cell(p.AmountColumn))
+		if err != nil {
+			return 0, "", err
+		}
+		return signed(amount)
+	}
+
+	debit, err := parseMoney(cell(p.DebitColumn))
+	if err != nil {
+		return 0, "", err
+	}
+	credit, err := parseMoney(cell(p.CreditColumn))
+	if err != nil {
+		return 0, "", err
+	}
+
+	switch {
+	case debit != 0 && credit != 0:
+		return 0, "", ErrBothAmounts
+	case debit != 0:
+		return abs(debit), "expense", nil
+	case credit != 0:
+		return abs(credit), "income", nil
+	}
+	return 0, "", ErrNoAmount
+}
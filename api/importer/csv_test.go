@@ -0,0 +1,83 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCSV(t *testing.T) {
+	t.Run("given debit and credit columns should infer transaction type", func(t *testing.T) {
+		csv := "Account,123-4-56789-0\n" +
+			"\n" +
+			"Date,Time,Withdrawal,Deposit,Balance,Description\n" +
+			"01/05/2024,08:15,\"1,250.00\",,8750.00,7-Eleven\n" +
+			"02/05/2024,12:00,,\"30,000.00\",38750.00,Salary\n" +
+			",,\"1,250.00\",\"30,000.00\",,Total\n"
+
+		records, rowErrs, err := ParseCSV(strings.NewReader(csv), Banks["scb"])
+
+		assert.NoError(t, err)
+		assert.Empty(t, rowErrs)
+		assert.Equal(t, []Record{
+			{Line: 4, Date: "2024-05-01 08:15:00", Amount: money.MustParse("1250"), TransactionType: "expense", Category: DefaultCategory, Note: "7-Eleven"},
+			{Line: 5, Date: "2024-05-02 12:00:00", Amount: money.MustParse("30000"), TransactionType: "income", Category: DefaultCategory, Note: "Salary"},
+		}, records)
+	})
+
+	t.Run("given buddhist era dates and byte order mark should convert the year", func(t *testing.T) {
+		csv := "\ufeffDate,Description,Debit,Credit\n29/02/2567,Rent,8000,\n"
+
+		records, rowErrs, err := ParseCSV(strings.NewReader(csv), Banks["krungthai"])
+
+		assert.NoError(t, err)
+		assert.Empty(t, rowErrs)
+		assert.Equal(t, "2024-02-29 00:00:00", records[0].Date)
+	})
+
+	t.Run("given signed amount column should use the sign", func(t *testing.T) {
+		p := Profile{Name: "custom", DateColumn: "date", DateFormat: "2006-01-02", AmountColumn: "amount", CategoryColumn: "category", DefaultCategory: "misc"}
+		csv := "date,amount,category\n2024-05-01,-45.50,food\n2024-05-02,(12.00),\n2024-05-03,100,\n"
+
+		records, rowErrs, err := ParseCSV(strings.NewReader(csv), p)
+
+		assert.NoError(t, err)
+		assert.Empty(t, rowErrs)
+		assert.Equal(t, []Record{
+			{Line: 2, Date: "2024-05-01 00:00:00", Amount: money.MustParse("45.50"), TransactionType: "expense", Category: "food"},
+			{Line: 3, Date: "2024-05-02 00:00:00", Amount: money.MustParse("12"), TransactionType: "expense", Category: "misc"},
+			{Line: 4, Date: "2024-05-03 00:00:00", Amount: money.MustParse("100"), TransactionType: "income", Category: "misc"},
+		}, records)
+	})
+
+	t.Run("given unmappable rows should report them by line", func(t *testing.T) {
+		csv := "Date,Description,Debit,Credit\n2024-05-01,Bad date,10,\n01/05/2024,Nothing,,\n01/05/2024,Both,10,20\n01/05/2024,Garbage,ten,\n"
+
+		records, rowErrs, err := ParseCSV(strings.NewReader(csv), Profile{Name: "custom", DateColumn: "Date", DateFormat: "02/01/2006", DebitColumn: "Debit", CreditColumn: "Credit"})
+
+		assert.NoError(t, err)
+		assert.Empty(t, records)
+		assert.Len(t, rowErrs, 4)
+		assert.Equal(t, 2, rowErrs[0].Line)
+		assert.True(t, errors.Is(rowErrs[1], ErrNoAmount))
+		assert.True(t, errors.Is(rowErrs[2], ErrBothAmounts))
+		assert.True(t, errors.Is(rowErrs[3], money.ErrInvalid))
+	})
+
+	t.Run("given file without mapped header should return error", func(t *testing.T) {
+		_, _, err := ParseCSV(strings.NewReader("foo,bar\n1,2\n"), Banks["kbank"])
+
+		assert.EqualError(t, err, "could not find a header row with columns Date, Time, Withdrawal, Deposit, Details")
+	})
+}
+
+func TestCheckMapping(t *testing.T) {
+	assert.NoError(t, checkMapping(Profile{AmountColumn: "amount"}))
+	assert.NoError(t, checkMapping(Profile{DebitColumn: "out", CreditColumn: "in"}))
+	assert.Equal(t, ErrAmountMapping, checkMapping(Profile{}))
+	assert.Equal(t, ErrAmountMapping, checkMapping(Profile{DebitColumn: "out"}))
+	assert.Equal(t, ErrAmountMapping, checkMapping(Profile{AmountColumn: "amount", DebitColumn: "out", CreditColumn: "in"}))
+}
@@ -0,0 +1,180 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+)
+
+// Statement formats an import can read.
+const (
+	FormatCSV = "csv"
+	FormatOFX = "ofx"
+	FormatQIF = "qif"
+)
+
+// DefaultCategory is given to imported rows whose statement and profile name
+// no category.
+const DefaultCategory = "uncategorized"
+
+// dateLayout is how transaction dates are stored.
+const dateLayout = "2006-01-02 15:04:05"
+
+// Column widths of the transaction table.
+const (
+	maxCategory = 50
+	maxNote     = 255
+	maxRef      = 255
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("format must be one of csv ofx qif")
+	ErrZeroAmount        = errors.New("row amount is zero")
+)
+
+var amountNoise = strings.NewReplacer(",", "", " ", "", "฿", "", "THB", "")
+
+// Record is one statement entry mapped onto transaction fields.
+type Record struct {
+	Line            int
+	Date            string
+	Amount          money.Money
+	TransactionType string
+	Category        string
+	Note            string
+
+	// ExternalRef is the statement's own id for the entry, used to skip it
+	// when the same statement is imported again. Empty when it has none.
+	ExternalRef string
+
+	// Currency is set when the statement declares one; it overrides the
+	// profile's.
+	Currency string
+}
+
+// RowError is a statement entry that could not be mapped.
+type RowError struct {
+	Line int
+	Err  error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// parseFunc reads a statement into the entries it could map and those it
+// could not. It fails only when the file as a whole is unreadable.
+type parseFunc func(r io.Reader, p Profile) ([]Record, []RowError, error)
+
+var parsers = map[string]parseFunc{
+	FormatCSV: ParseCSV,
+	FormatOFX: ParseOFX,
+	FormatQIF: ParseQIF,
+}
+
+// DetectFormat guesses the format of a statement from its file name and,
+// failing that, from the first bytes of its content. It falls back to CSV.
+func DetectFormat(filename string, head []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ofx", ".qfx":
+		return FormatOFX
+	case ".qif":
+		return FormatQIF
+	case ".csv":
+		return FormatCSV
+	}
+
+	head = bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\ufeff")))
+	upper := bytes.ToUpper(head)
+	switch {
+	case bytes.HasPrefix(upper, []byte("OFXHEADER")), bytes.HasPrefix(upper, []byte("<?XML")) && bytes.Contains(upper, []byte("<OFX")), bytes.HasPrefix(upper, []byte("<OFX")):
+		return FormatOFX
+	case bytes.HasPrefix(upper, []byte("!TYPE")), bytes.HasPrefix(upper, []byte("!ACCOUNT")), bytes.HasPrefix(upper, []byte("!OPTION")):
+		return FormatQIF
+	}
+
+	return FormatCSV
+}
+
+// newRecord builds a Record, falling back to the profile's category and
+// trimming text to fit the transaction table.
+func newRecord(p Profile, date string, amount money.Money, txType, category, note, ref string) Record {
+	if category == "" {
+		category = p.DefaultCategory
+	}
+	if category == "" {
+		category = DefaultCategory
+	}
+
+	return Record{
+		Date:            date,
+		Amount:          amount,
+		TransactionType: txType,
+		Category:        truncate(category, maxCategory),
+		Note:            truncate(note, maxNote),
+		ExternalRef:     truncate(ref, maxRef),
+	}
+}
+
+// signed splits a signed amount into its size and transaction type:
+// negative amounts leave the account, positive ones enter it.
+func signed(amount money.Money) (money.Money, string, error) {
+	switch {
+	case amount < 0:
+		return -amount, "expense", nil
+	case amount > 0:
+		return amount, "income", nil
+	}
+
+	return 0, "", ErrZeroAmount
+}
+
+// parseMoney reads amounts as banks print them: with thousands separators,
+// an optional currency sign and negatives in parentheses. Blank is zero.
+func parseMoney(s string) (money.Money, error) {
+	s = amountNoise.Replace(s)
+	if s == "" || s == "-" {
+		return 0, nil
+	}
+
+	negative := strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")")
+	if negative {
+		s = s[1 : len(s)-1]
+	}
+
+	m, err := money.Parse(s)
+	if err != nil {
+		return 0, fmt.Errorf("amount %q: %w", s, err)
+	}
+	if negative {
+		m = -m
+	}
+
+	return m, nil
+}
+
+func abs(m money.Money) money.Money {
+	if m < 0 {
+		return -m
+	}
+
+	return m
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,27 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		head     string
+		expected string
+	}{
+		{"statement.QFX", "", FormatOFX},
+		{"statement.qif", "", FormatQIF},
+		{"statement.csv", "OFXHEADER:100", FormatCSV},
+		{"download", "OFXHEADER:100\nDATA:OFXSGML", FormatOFX},
+		{"download", `<?xml version="1.0"?><?OFX OFXHEADER="200"?><OFX>`, FormatOFX},
+		{"download", "\ufeff!Type:Bank\n", FormatQIF},
+		{"download", "Date,Amount\n", FormatCSV},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, DetectFormat(tt.filename, []byte(tt.head)), tt.filename+" "+tt.head)
+	}
+}
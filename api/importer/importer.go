@@ -0,0 +1,498 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/exchange"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// Limits bound what one import request may carry. MaxRequestSize is in
+// bytes; MaxRows counts the entries of the statement, valid or not.
+type Limits struct {
+	MaxRequestSize int64
+	MaxRows        int
+}
+
+type handler struct {
+	db     *sql.DB
+	limits Limits
+}
+
+func New(db *sql.DB, limits Limits) *handler {
+	return &handler{db: db, limits: limits}
+}
+
+// Row is one statement entry as it would be, or was, imported.
+type Row struct {
+	Line        int                      `json:"line"`
+	Transaction *transaction.Transaction `json:"transaction,omitempty"`
+	Error       *errs.ErrorResponse      `json:"error,omitempty"`
+
+	// Duplicate marks an entry whose reference was already imported, or
+	// appears earlier in the same file. It is skipped on commit.
+	Duplicate bool `json:"duplicate,omitempty"`
+}
+
+type Result struct {
+	Format     string `json:"format"`
+	Profile    string `json:"profile"`
+	Committed  bool   `json:"committed"`
+	Valid      int    `json:"valid"`
+	Invalid    int    `json:"invalid"`
+	Duplicates int    `json:"duplicates"`
+	Rows       []Row  `json:"rows"`
+}
+
+const (
+	listProfilesStmt  = `SELECT id, name, mapping FROM import_profile WHERE spender_id = $1 ORDER BY name`
+	getProfileStmt    = `SELECT id, name, mapping FROM import_profile WHERE spender_id = $1 AND name = $2`
+	upsertProfileStmt = `INSERT INTO import_profile (spender_id, name, mapping) VALUES ($1, $2, $3) ON CONFLICT (spender_id, name) DO UPDATE SET mapping = EXCLUDED.mapping RETURNING id`
+	deleteProfileStmt = `DELETE FROM import_profile WHERE spender_id = $1 AND name = $2`
+	existingRefsStmt  = `SELECT external_ref FROM transaction WHERE spender_id = $1 AND external_ref = ANY($2)`
+)
+
+// sniffLen is how much of a file DetectFormat looks at.
+const sniffLen = 512
+
+// Import reads a statement from the multipart field "file" and maps it onto
+// transactions of spender :id. The format is taken from field "format" or
+// detected from the file. CSV needs a mapping: either the saved or bank
+// profile named by field "profile" or a Profile in JSON in field "mapping".
+// OFX and QIF may name one for its default category and currency.
+//
+// By default nothing is written and the mapped rows are returned for review.
+// With commit=true the rows are created in one database transaction through
+// transaction.Insert, provided every row is valid. Entries whose statement
+// reference was imported before are reported as duplicates and skipped.
+// Requests larger than the configured size and statements with more rows
+// than the configured count are refused as a whole.
+func (h handler) Import(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, h.limits.MaxRequestSize)
+
+	spenderID, status, err := authorize(c)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	_, err = c.MultipartForm()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		logger.Warn("import request too large", zap.Int64("limit", h.limits.MaxRequestSize))
+		return c.JSON(http.StatusRequestEntityTooLarge, errs.ParseError(fmt.Errorf("request must be at most %d bytes", h.limits.MaxRequestSize)))
+	}
+	if err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	commit := false
+	if v := c.FormValue("commit"); v != "" {
+		if commit, err = strconv.ParseBool(v); err != nil {
+			logger.Error("commit parameter is invalid", zap.Error(err))
+			return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+		}
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		logger.Error("open file error", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+	defer f.Close()
+
+	format := strings.ToLower(c.FormValue("format"))
+	if format == "" {
+		head := make([]byte, sniffLen)
+		n, _ := io.ReadFull(f, head)
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			logger.Error("rewind file error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		format = DetectFormat(fh.Filename, head[:n])
+	}
+	parse, ok := parsers[format]
+	if !ok {
+		return c.JSON(http.StatusBadRequest, errs.ParseError(ErrUnsupportedFormat))
+	}
+
+	profile, status, err := h.resolveProfile(c, spenderID)
+	if errors.Is(err, ErrProfileRequired) && format != FormatCSV {
+		profile, err = Profile{Name: format}, nil
+	}
+	if err != nil {
+		logger.Error("resolve import profile error", zap.Error(err))
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	currency, err := exchange.NormalizeCurrency(profile.Currency)
+	if err != nil {
+		logger.Error("currency is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	records, rowErrs, err := parse(f, profile)
+	if err != nil {
+		logger.Error("parse statement error", zap.String("format", format), zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+	if n := len(records) + len(rowErrs); n > h.limits.MaxRows {
+		logger.Warn("statement has too many rows", zap.Int("rows", n), zap.Int("limit", h.limits.MaxRows))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(fmt.Errorf("statement must have at most %d rows", h.limits.MaxRows)))
+	}
+
+	result := Result{Format: format, Profile: profile.Name}
+	for _, re := range rowErrs {
+		resp := errs.ParseError(re.Err)
+		result.Rows = append(result.Rows, Row{Line: re.Line, Error: &resp})
+	}
+	for _, r := range records {
+		tx := transaction.Transaction{
+			Date:            r.Date,
+			Amount:          r.Amount,
+			Category:        r.Category,
+			TransactionType: r.TransactionType,
+			Note:            r.Note,
+			SpenderID:       spenderID,
+			Currency:        currency,
+			ExternalRef:     r.ExternalRef,
+		}
+		row := Row{Line: r.Line, Transaction: &tx}
+		if err := check(c, &tx, r.Currency); err != nil {
+			resp := errs.ParseError(err)
+			row.Error = &resp
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	sort.Slice(result.Rows, func(i, j int) bool { return result.Rows[i].Line < result.Rows[j].Line })
+
+	if err := h.markDuplicates(ctx, spenderID, result.Rows); err != nil {
+		logger.Error("query existing references error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	for _, row := range result.Rows {
+		switch {
+		case row.Error != nil:
+			result.Invalid++
+		case row.Duplicate:
+			result.Duplicates++
+		default:
+			result.Valid++
+		}
+	}
+
+	if !commit {
+		logger.Info("preview import", zap.String("format", format), zap.Int("valid", result.Valid), zap.Int("invalid", result.Invalid), zap.Int("duplicates", result.Duplicates))
+		return c.JSON(http.StatusOK, result)
+	}
+
+	if result.Invalid > 0 {
+		logger.Warn("import rejected", zap.Int("invalid", result.Invalid))
+		return c.JSON(http.StatusBadRequest, result)
+	}
+
+	if err := h.commit(ctx, result.Rows); err != nil {
+		logger.Error("commit import error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	result.Committed = true
+	logger.Info("import successfully", zap.Int("spender_id", spenderID), zap.Int("created", result.Valid), zap.Int("duplicates", result.Duplicates))
+	return c.JSON(http.StatusCreated, result)
+}
+
+// check validates tx the way a created transaction is, first switching it to
+// the currency its statement declared, if any.
+func check(c echo.Context, tx *transaction.Transaction, currency string) error {
+	if currency != "" {
+		var err error
+		if tx.Currency, err = exchange.NormalizeCurrency(currency); err != nil {
+			return err
+		}
+	}
+
+	return c.Validate(*tx)
+}
+
+// markDuplicates flags rows whose reference spender already has, or that
+// repeat a reference seen earlier in rows.
+func (h handler) markDuplicates(ctx context.Context, spenderID int, rows []Row) error {
+	var refs []string
+	for _, row := range rows {
+		if row.Transaction != nil && row.Transaction.ExternalRef != "" {
+			refs = append(refs, row.Transaction.ExternalRef)
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	existing, err := h.db.QueryContext(ctx, existingRefsStmt, spenderID, pq.Array(refs))
+	if err != nil {
+		return err
+	}
+	defer existing.Close()
+
+	seen := map[string]bool{}
+	for existing.Next() {
+		var ref string
+		if err := existing.Scan(&ref); err != nil {
+			return err
+		}
+		seen[ref] = true
+	}
+	if err := existing.Err(); err != nil {
+		return err
+	}
+
+	for i := range rows {
+		if rows[i].Transaction == nil || rows[i].Error != nil {
+			continue
+		}
+		ref := rows[i].Transaction.ExternalRef
+		if ref == "" {
+			continue
+		}
+		rows[i].Duplicate = seen[ref]
+		seen[ref] = true
+	}
+
+	return nil
+}
+
+func (h handler) commit(ctx context.Context, rows []Row) error {
+	dbtx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer dbtx.Rollback()
+
+	for i := range rows {
+		if rows[i].Duplicate {
+			continue
+		}
+		created, err := transaction.Insert(ctx, dbtx, *rows[i].Transaction)
+		if err != nil {
+			return err
+		}
+		rows[i].Transaction = &created
+	}
+
+	return dbtx.Commit()
+}
+
+// resolveProfile picks the mapping for an import request: inline JSON in
+// field "mapping" wins, then a profile the spender saved under the name in
+// field "profile", then the bank profile of that name.
+func (h handler) resolveProfile(c echo.Context, spenderID int) (Profile, int, error) {
+	if mapping := c.FormValue("mapping"); mapping != "" {
+		var p Profile
+		if err := json.Unmarshal([]byte(mapping), &p); err != nil {
+			return Profile{}, http.StatusBadRequest, err
+		}
+		if p.Name == "" {
+			p.Name = "custom"
+		}
+		if err := validateProfile(c, p); err != nil {
+			return Profile{}, http.StatusBadRequest, err
+		}
+		return p, http.StatusOK, nil
+	}
+
+	name := ProfileName(c.FormValue("profile"))
+	if name == "" {
+		return Profile{}, http.StatusBadRequest, ErrProfileRequired
+	}
+
+	p, err := h.savedProfile(c.Request().Context(), spenderID, name)
+	if err == nil {
+		return p, http.StatusOK, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Profile{}, http.StatusInternalServerError, err
+	}
+
+	if p, ok := Banks[name]; ok {
+		return p, http.StatusOK, nil
+	}
+
+	return Profile{}, http.StatusNotFound, ErrProfileNotFound
+}
+
+func (h handler) savedProfile(ctx context.Context, spenderID int, name string) (Profile, error) {
+	return scanProfile(h.db.QueryRowContext(ctx, getProfileStmt, spenderID, name))
+}
+
+func scanProfile(row interface{ Scan(dest ...any) error }) (Profile, error) {
+	var id int
+	var name string
+	var mapping []byte
+	if err := row.Scan(&id, &name, &mapping); err != nil {
+		return Profile{}, err
+	}
+
+	var p Profile
+	if err := json.Unmarshal(mapping, &p); err != nil {
+		return Profile{}, err
+	}
+	p.ID = id
+	p.Name = name
+
+	return p, nil
+}
+
+func validateProfile(c echo.Context, p Profile) error {
+	if err := c.Validate(p); err != nil {
+		return err
+	}
+
+	return checkMapping(p)
+}
+
+// GetProfiles lists the bank profiles followed by those spender :id saved.
+func (h handler) GetProfiles(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	spenderID, status, err := authorize(c)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	names := make([]string, 0, len(Banks))
+	for name := range Banks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	profiles := make([]Profile, 0, len(Banks))
+	for _, name := range names {
+		profiles = append(profiles, Banks[name])
+	}
+
+	rows, err := h.db.QueryContext(ctx, listProfilesStmt, spenderID)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		p, err := scanProfile(rows)
+		if err != nil {
+			logger.Error("scan error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		profiles = append(profiles, p)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("rows error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	return c.JSON(http.StatusOK, profiles)
+}
+
+// SaveProfile stores a profile for spender :id, replacing any saved under
+// the same name.
+func (h handler) SaveProfile(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	spenderID, status, err := authorize(c)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	var p Profile
+	if err := c.Bind(&p); err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+	p.ID = 0
+	p.Name = ProfileName(p.Name)
+
+	if err := validateProfile(c, p); err != nil {
+		logger.Error("validate request body failed", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+	if _, err := exchange.NormalizeCurrency(p.Currency); err != nil {
+		logger.Error("currency is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	mapping, _ := json.Marshal(p)
+	if err := h.db.QueryRowContext(ctx, upsertProfileStmt, spenderID, p.Name, mapping).Scan(&p.ID); err != nil {
+		logger.Error("save profile error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	logger.Info("save import profile successfully", zap.Int("id", p.ID))
+	return c.JSON(http.StatusCreated, p)
+}
+
+// DeleteProfile removes the profile spender :id saved as :name.
+func (h handler) DeleteProfile(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	spenderID, status, err := authorize(c)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	res, err := h.db.ExecContext(ctx, deleteProfileStmt, spenderID, ProfileName(c.Param("name")))
+	if err != nil {
+		logger.Error("delete profile error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrProfileNotFound))
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// authorize returns spender :id when the caller may act on it.
+func authorize(c echo.Context) (int, int, error) {
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return 0, http.StatusUnauthorized, errs.ErrUnauthorized
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, http.StatusBadRequest, err
+	}
+
+	if !p.CanAccess(id) {
+		return 0, http.StatusForbidden, errs.ErrForbidden
+	}
+
+	return id, http.StatusOK, nil
+}
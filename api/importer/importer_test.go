@@ -0,0 +1,360 @@
+package importer
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
+	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+const insertStmt = "WITH t AS (INSERT INTO transaction (date, amount, category, transaction_type, note, image_url, spender_id, currency, external_ref) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, '')) RETURNING *) SELECT " + transaction.Columns + " FROM t" + transaction.Join
+
+const statement = "Date,Time,Withdrawal,Deposit,Balance,Description\n" +
+	"01/05/2024,08:15,\"1,250.00\",,8750.00,7-Eleven\n" +
+	"02/05/2024,12:00,,\"30,000.00\",38750.00,Salary\n"
+
+var limits = Limits{MaxRequestSize: 1 << 20, MaxRows: 100}
+
+func newImportContext(fields map[string]string, filename, file string) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	e.Validator = cv.New()
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for k, v := range fields {
+		_ = w.WriteField(k, v)
+	}
+	if file != "" {
+		part, _ := w.CreateFormFile("file", filename)
+		part.Write([]byte(file))
+	}
+	w.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	utils.SetParams(c, map[string]string{"id": "1"})
+	auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+	return c, rec
+}
+
+func TestImport(t *testing.T) {
+	cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+
+	t.Run("given bank profile should preview rows without writing", func(t *testing.T) {
+		c, rec := newImportContext(map[string]string{"profile": "SCB"}, "statement.csv", statement)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(getProfileStmt).WithArgs(1, "scb").WillReturnRows(sqlmock.NewRows([]string{"id", "name", "mapping"}))
+
+		h := New(db, limits)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"format": "csv", "profile": "scb", "duplicates": 0, "committed": false, "valid": 2, "invalid": 0, "rows": [
+			{"line": 2, "transaction": {"date": "2024-05-01 08:15:00", "amount": 1250, "category": "uncategorized", "transaction_type": "expense", "note": "7-Eleven", "image_url": "", "spender_id": 1, "currency": "THB"}},
+			{"line": 3, "transaction": {"date": "2024-05-02 12:00:00", "amount": 30000, "category": "uncategorized", "transaction_type": "income", "note": "Salary", "image_url": "", "spender_id": 1, "currency": "THB"}}
+		]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given commit should insert every row in one transaction", func(t *testing.T) {
+		c, rec := newImportContext(map[string]string{"profile": "groceries", "commit": "true"}, "statement.csv", "when,amount\n2024-05-01,-80\n")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(getProfileStmt).WithArgs(1, "groceries").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "mapping"}).
+				AddRow(4, "groceries", []byte(`{"date_column": "when", "date_format": "2006-01-02", "amount_column": "amount", "default_category": "food"}`)))
+		mock.ExpectBegin()
+		mock.ExpectQuery(insertStmt).
+			WithArgs("2024-05-01 00:00:00", money.MustParse("80"), "food", "expense", "", "", 1, "THB", "").
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(7, "2024-05-01 00:00:00", 80, "food", "expense", "", "", 1, "THB", 80, "THB", 1, ""))
+		mock.ExpectCommit()
+
+		h := New(db, limits)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"format": "csv", "profile": "groceries", "duplicates": 0, "committed": true, "valid": 1, "invalid": 0, "rows": [
+			{"line": 2, "transaction": {"id": 7, "date": "2024-05-01 00:00:00", "amount": 80, "category": "food", "transaction_type": "expense", "note": "", "image_url": "", "spender_id": 1, "currency": "THB", "converted_amount": 80, "converted_currency": "THB"}}
+		]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given ofx statement imported before should skip known references", func(t *testing.T) {
+		ofx := "<OFX><CURDEF>THB\n" +
+			"<STMTTRN><DTPOSTED>20240501<TRNAMT>-50<FITID>F1<NAME>Coffee</STMTTRN>\n" +
+			"<STMTTRN><DTPOSTED>20240502<TRNAMT>-70<FITID>F2<NAME>Lunch</STMTTRN>\n" +
+			"</OFX>\n"
+		c, rec := newImportContext(map[string]string{"commit": "true"}, "statement.ofx", ofx)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(existingRefsStmt).WithArgs(1, pq.Array([]string{"F1", "F2"})).
+			WillReturnRows(sqlmock.NewRows([]string{"external_ref"}).AddRow("F1"))
+		mock.ExpectBegin()
+		mock.ExpectQuery(insertStmt).
+			WithArgs("2024-05-02 00:00:00", money.MustParse("70"), "uncategorized", "expense", "Lunch", "", 1, "THB", "F2").
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(8, "2024-05-02 00:00:00", 70, "uncategorized", "expense", "Lunch", "", 1, "THB", 70, "THB", 1, "F2"))
+		mock.ExpectCommit()
+
+		h := New(db, limits)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"format": "ofx", "profile": "ofx", "committed": true, "valid": 1, "invalid": 0, "duplicates": 1, "rows": [
+			{"line": 2, "duplicate": true, "transaction": {"date": "2024-05-01 00:00:00", "amount": 50, "category": "uncategorized", "transaction_type": "expense", "note": "Coffee", "image_url": "", "spender_id": 1, "currency": "THB", "external_ref": "F1"}},
+			{"line": 3, "transaction": {"id": 8, "date": "2024-05-02 00:00:00", "amount": 70, "category": "uncategorized", "transaction_type": "expense", "note": "Lunch", "image_url": "", "spender_id": 1, "currency": "THB", "external_ref": "F2", "converted_amount": 70, "converted_currency": "THB"}}
+		]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given qif entries sharing a check number should import them all", func(t *testing.T) {
+		entry := "D05/01/2024\nT-500\nNATM\nPCash\n^\n"
+		c, rec := newImportContext(map[string]string{"commit": "true"}, "statement.qif", "!Type:Bank\n"+entry+entry)
+		first := qifRef("2024-05-01 00:00:00", money.MustParse("-500"), "Cash", 0)
+		second := qifRef("2024-05-01 00:00:00", money.MustParse("-500"), "Cash", 1)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(existingRefsStmt).WithArgs(1, pq.Array([]string{first, second})).
+			WillReturnRows(sqlmock.NewRows([]string{"external_ref"}))
+		mock.ExpectBegin()
+		for i, ref := range []string{first, second} {
+			mock.ExpectQuery(insertStmt).
+				WithArgs("2024-05-01 00:00:00", money.MustParse("500"), "uncategorized", "expense", "Cash", "", 1, "THB", ref).
+				WillReturnRows(sqlmock.NewRows(cols).AddRow(i+1, "2024-05-01 00:00:00", 500, "uncategorized", "expense", "Cash", "", 1, "THB", 500, "THB", 1, ref))
+		}
+		mock.ExpectCommit()
+
+		h := New(db, limits)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"valid":2`)
+		assert.Contains(t, rec.Body.String(), `"duplicates":0`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a qif export overlapping one imported before should import only the new entries", func(t *testing.T) {
+		entry := "D05/01/2024\nT-500\nNATM\nPCash\n^\n"
+		later := "D05/03/2024\nT-500\nNATM\nPCash\n^\n"
+		c, rec := newImportContext(map[string]string{"commit": "true"}, "statement.qif", "!Type:Bank\n"+entry+entry+later)
+		first := qifRef("2024-05-01 00:00:00", money.MustParse("-500"), "Cash", 0)
+		second := qifRef("2024-05-01 00:00:00", money.MustParse("-500"), "Cash", 1)
+		third := qifRef("2024-05-03 00:00:00", money.MustParse("-500"), "Cash", 0)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(existingRefsStmt).WithArgs(1, pq.Array([]string{first, second, third})).
+			WillReturnRows(sqlmock.NewRows([]string{"external_ref"}).AddRow(first).AddRow(second))
+		mock.ExpectBegin()
+		mock.ExpectQuery(insertStmt).
+			WithArgs("2024-05-03 00:00:00", money.MustParse("500"), "uncategorized", "expense", "Cash", "", 1, "THB", third).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(3, "2024-05-03 00:00:00", 500, "uncategorized", "expense", "Cash", "", 1, "THB", 500, "THB", 1, third))
+		mock.ExpectCommit()
+
+		h := New(db, limits)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"duplicates":2`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given invalid rows should refuse to commit", func(t *testing.T) {
+		c, rec := newImportContext(map[string]string{
+			"mapping": `{"date_column": "when", "date_format": "2006-01-02", "amount_column": "amount"}`,
+			"commit":  "true",
+		}, "statement.csv", "when,amount\n2024-05-01,-80\n05/02/2024,10\n")
+
+		h := New(nil, limits)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"format": "csv", "profile": "custom", "duplicates": 0, "committed": false, "valid": 1, "invalid": 1, "rows": [
+			{"line": 2, "transaction": {"date": "2024-05-01 00:00:00", "amount": 80, "category": "uncategorized", "transaction_type": "expense", "note": "", "image_url": "", "spender_id": 1, "currency": "THB"}},
+			{"line": 3, "error": {"messages": ["date \"05/02/2024\" does not match format \"2006-01-02\""]}}
+		]}`, rec.Body.String())
+	})
+
+	t.Run("given unknown profile should return not found", func(t *testing.T) {
+		c, rec := newImportContext(map[string]string{"profile": "mybank"}, "statement.csv", statement)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(getProfileStmt).WithArgs(1, "mybank").WillReturnRows(sqlmock.NewRows([]string{"id", "name", "mapping"}))
+
+		h := New(db, limits)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("given a request over the size limit should return request entity too large", func(t *testing.T) {
+		c, rec := newImportContext(map[string]string{"profile": "scb"}, "statement.csv", statement+strings.Repeat("\n", 2048))
+
+		h := New(nil, Limits{MaxRequestSize: 1024, MaxRows: 100})
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.JSONEq(t, `{"messages": ["request must be at most 1024 bytes"]}`, rec.Body.String())
+	})
+
+	t.Run("given more rows than allowed should return bad request", func(t *testing.T) {
+		c, rec := newImportContext(map[string]string{
+			"mapping": `{"date_column": "when", "date_format": "2006-01-02", "amount_column": "amount"}`,
+		}, "statement.csv", "when,amount\n2024-05-01,-80\n2024-05-02,-20\nbad,row\n")
+
+		h := New(nil, Limits{MaxRequestSize: 1 << 20, MaxRows: 2})
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages": ["statement must have at most 2 rows"]}`, rec.Body.String())
+	})
+
+	t.Run("given other spender should return forbidden", func(t *testing.T) {
+		c, rec := newImportContext(map[string]string{"profile": "scb"}, "statement.csv", statement)
+		utils.SetParams(c, map[string]string{"id": "2"})
+
+		h := New(nil, limits)
+		err := h.Import(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestSaveProfile(t *testing.T) {
+	newContext := func(body string) (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		e.Validator = cv.New()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		utils.SetParams(c, map[string]string{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		return c, rec
+	}
+
+	t.Run("given valid profile should save it", func(t *testing.T) {
+		c, rec := newContext(`{"name": " Groceries ", "date_column": "when", "date_format": "2006-01-02", "amount_column": "amount"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(upsertProfileStmt).
+			WithArgs(1, "groceries", []byte(`{"name":"groceries","date_column":"when","date_format":"2006-01-02","amount_column":"amount"}`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+
+		h := New(db, limits)
+		err := h.SaveProfile(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id": 4, "name": "groceries", "date_column": "when", "date_format": "2006-01-02", "amount_column": "amount"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given profile without amount mapping should return error", func(t *testing.T) {
+		c, rec := newContext(`{"name": "broken", "date_column": "when", "date_format": "2006-01-02", "debit_column": "out"}`)
+
+		h := New(nil, limits)
+		err := h.SaveProfile(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages": ["profile must map either amount_column or both debit_column and credit_column"]}`, rec.Body.String())
+	})
+}
+
+func TestGetProfiles(t *testing.T) {
+	t.Run("given saved profile should list it after bank profiles", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		utils.SetParams(c, map[string]string{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(listProfilesStmt).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "mapping"}).
+				AddRow(4, "groceries", []byte(`{"date_column": "when", "date_format": "2006-01-02", "amount_column": "amount"}`)))
+
+		h := New(db, limits)
+		err := h.GetProfiles(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var names []string
+		for _, name := range []string{"kbank", "krungthai", "scb", "groceries"} {
+			if strings.Contains(rec.Body.String(), `"name":"`+name+`"`) {
+				names = append(names, name)
+			}
+		}
+		assert.Equal(t, []string{"kbank", "krungthai", "scb", "groceries"}, names)
+	})
+}
+
+func TestDeleteProfile(t *testing.T) {
+	t.Run("given missing profile should return not found", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodDelete, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id", "name")
+		c.SetParamValues("1", "groceries")
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectExec(deleteProfileStmt).WithArgs(1, "groceries").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		h := New(db, limits)
+		err := h.DeleteProfile(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
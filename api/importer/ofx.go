@@ -0,0 +1,148 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var ErrInvalidOFX = errors.New("file is not an OFX statement")
+
+// ofxTxn holds the elements of one <STMTTRN> aggregate.
+type ofxTxn struct {
+	line   int
+	fields map[string]string
+}
+
+// ParseOFX reads the transactions of an OFX statement. Both the SGML flavour
+// of OFX 1.x, where leaf elements are not closed, and the XML of OFX 2.x are
+// accepted. FITID becomes the ExternalRef and CURDEF the Currency.
+func ParseOFX(r io.Reader, p Profile) ([]Record, []RowError, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := bytes.Index(bytes.ToUpper(body), []byte("<OFX>"))
+	if start < 0 {
+		return nil, nil, ErrInvalidOFX
+	}
+
+	var currency string
+	var txns []ofxTxn
+	var current *ofxTxn
+
+	line := 1 + bytes.Count(body[:start], []byte("\n"))
+	rest := body[start:]
+	for {
+		open := bytes.IndexByte(rest, '<')
+		if open < 0 {
+			break
+		}
+		line += bytes.Count(rest[:open], []byte("\n"))
+		rest = rest[open:]
+
+		end := bytes.IndexByte(rest, '>')
+		if end < 0 {
+			return nil, nil, ErrInvalidOFX
+		}
+		tag := strings.ToUpper(strings.TrimSpace(string(rest[1:end])))
+		rest = rest[end+1:]
+
+		next := bytes.IndexByte(rest, '<')
+		if next < 0 {
+			next = len(rest)
+		}
+		value := strings.TrimSpace(string(rest[:next]))
+
+		switch {
+		case tag == "STMTTRN":
+			current = &ofxTxn{line: line, fields: map[string]string{}}
+		case tag == "/STMTTRN":
+			if current != nil {
+				txns = append(txns, *current)
+				current = nil
+			}
+		case tag == "CURDEF":
+			currency = value
+		case strings.HasPrefix(tag, "/"), value == "":
+		case current != nil:
+			current.fields[tag] = unescapeOFX(value)
+		}
+	}
+
+	var records []Record
+	var rowErrs []RowError
+	for _, txn := range txns {
+		record, err := mapOFX(p, txn.fields)
+		if err != nil {
+			rowErrs = append(rowErrs, RowError{Line: txn.line, Err: err})
+			continue
+		}
+		record.Line = txn.line
+		record.Currency = currency
+		records = append(records, record)
+	}
+
+	return records, rowErrs, nil
+}
+
+func mapOFX(p Profile, f map[string]string) (Record, error) {
+	date, err := parseOFXDate(f["DTPOSTED"])
+	if err != nil {
+		return Record{}, err
+	}
+
+	amount, err := parseMoney(f["TRNAMT"])
+	if err != nil {
+		return Record{}, err
+	}
+	amount, txType, err := signed(amount)
+	if err != nil {
+		return Record{}, err
+	}
+
+	note := f["NAME"]
+	if memo := f["MEMO"]; memo != "" && memo != note {
+		if note != "" {
+			note += " - "
+		}
+		note += memo
+	}
+
+	return newRecord(p, date, amount, txType, "", note, f["FITID"]), nil
+}
+
+// parseOFXDate reads OFX datetimes such as 20240501, 20240501083000 or
+// 20240501083000.000[+7:ICT]. The time zone is dropped; dates are stored as
+// the bank printed them.
+func parseOFXDate(s string) (string, error) {
+	digits := s
+	if i := strings.IndexAny(digits, ".["); i >= 0 {
+		digits = digits[:i]
+	}
+
+	layout := "20060102150405"
+	switch len(digits) {
+	case 8:
+		layout = "20060102"
+	case 12:
+		layout = "200601021504"
+	}
+
+	t, err := time.Parse(layout, digits)
+	if err != nil {
+		return "", fmt.Errorf("DTPOSTED %q is not an OFX date", s)
+	}
+
+	return t.Format(dateLayout), nil
+}
+
+var ofxEntities = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'", "&nbsp;", " ", "&amp;", "&")
+
+func unescapeOFX(s string) string {
+	return ofxEntities.Replace(s)
+}
@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/stretchr/testify/assert"
+)
+
+const sgmlStatement = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240501083000.000[-5:EST]
+<TRNAMT>-12.50
+<FITID>2024050101
+<NAME>STARBUCKS &amp; CO
+<MEMO>Card 1234
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240502
+<TRNAMT>1500.00
+<FITID>2024050202
+<NAME>PAYROLL
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>yesterday
+<TRNAMT>-1
+<FITID>2024050303
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	t.Run("given sgml statement should map transactions and keep FITID", func(t *testing.T) {
+		records, rowErrs, err := ParseOFX(strings.NewReader(sgmlStatement), Profile{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Record{
+			{Line: 9, Date: "2024-05-01 08:30:00", Amount: money.MustParse("12.50"), TransactionType: "expense", Category: DefaultCategory, Note: "STARBUCKS & CO - Card 1234", ExternalRef: "2024050101", Currency: "USD"},
+			{Line: 17, Date: "2024-05-02 00:00:00", Amount: money.MustParse("1500"), TransactionType: "income", Category: DefaultCategory, Note: "PAYROLL", ExternalRef: "2024050202", Currency: "USD"},
+		}, records)
+		assert.Len(t, rowErrs, 1)
+		assert.Equal(t, 24, rowErrs[0].Line)
+		assert.EqualError(t, rowErrs[0].Err, `DTPOSTED "yesterday" is not an OFX date`)
+	})
+
+	t.Run("given xml statement should map transactions", func(t *testing.T) {
+		xml := `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX><CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS><CURDEF>THB</CURDEF><BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20240510</DTPOSTED><TRNAMT>-99.00</TRNAMT><FITID>A1</FITID><NAME>Grab</NAME></STMTTRN>
+</BANKTRANLIST></CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1></OFX>`
+
+		records, rowErrs, err := ParseOFX(strings.NewReader(xml), Profile{DefaultCategory: "card"})
+
+		assert.NoError(t, err)
+		assert.Empty(t, rowErrs)
+		assert.Equal(t, []Record{
+			{Line: 4, Date: "2024-05-10 00:00:00", Amount: money.MustParse("99"), TransactionType: "expense", Category: "card", Note: "Grab", ExternalRef: "A1", Currency: "THB"},
+		}, records)
+	})
+
+	t.Run("given file without OFX element should return error", func(t *testing.T) {
+		_, _, err := ParseOFX(strings.NewReader("date,amount\n"), Profile{})
+
+		assert.Equal(t, ErrInvalidOFX, err)
+	})
+}
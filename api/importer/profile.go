@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrAmountMapping   = errors.New("profile must map either amount_column or both debit_column and credit_column")
+	ErrProfileRequired = errors.New("field profile or mapping is required")
+	ErrProfileNotFound = errors.New("import profile not found")
+)
+
+// Profile maps the columns of a bank's CSV statement onto transactions.
+// Columns are named by their header text, compared case-insensitively.
+// OFX and QIF statements carry their own structure and only use a profile
+// for DefaultCategory, Currency and, for QIF, DateFormat.
+//
+// Amounts come either from one signed AmountColumn, where negative values are
+// expenses, or from separate DebitColumn and CreditColumn, where a debit is an
+// expense and a credit is income.
+type Profile struct {
+	ID              int    `json:"id,omitempty"`
+	Name            string `json:"name" validate:"required"`
+	DateColumn      string `json:"date_column" validate:"required"`
+	DateFormat      string `json:"date_format" validate:"required"`
+	TimeColumn      string `json:"time_column,omitempty"`
+	TimeFormat      string `json:"time_format,omitempty"`
+	BuddhistEra     bool   `json:"buddhist_era,omitempty"`
+	AmountColumn    string `json:"amount_column,omitempty"`
+	DebitColumn     string `json:"debit_column,omitempty"`
+	CreditColumn    string `json:"credit_column,omitempty"`
+	NoteColumn      string `json:"note_column,omitempty"`
+	CategoryColumn  string `json:"category_column,omitempty"`
+	ReferenceColumn string `json:"reference_column,omitempty"`
+	DefaultCategory string `json:"default_category,omitempty"`
+	Currency        string `json:"currency,omitempty"`
+}
+
+// Banks holds starting profiles for the statement exports of Thai banks.
+// A spender can save a profile under the same name to override one.
+var Banks = map[string]Profile{
+	"kbank": {
+		Name:         "kbank",
+		DateColumn:   "Date",
+		DateFormat:   "02-01-06",
+		TimeColumn:   "Time",
+		TimeFormat:   "15:04",
+		DebitColumn:  "Withdrawal",
+		CreditColumn: "Deposit",
+		NoteColumn:   "Details",
+	},
+	"scb": {
+		Name:         "scb",
+		DateColumn:   "Date",
+		DateFormat:   "02/01/2006",
+		TimeColumn:   "Time",
+		TimeFormat:   "15:04",
+		DebitColumn:  "Withdrawal",
+		CreditColumn: "Deposit",
+		NoteColumn:   "Description",
+	},
+	"krungthai": {
+		Name:         "krungthai",
+		DateColumn:   "Date",
+		DateFormat:   "02/01/2006",
+		BuddhistEra:  true,
+		DebitColumn:  "Debit",
+		CreditColumn: "Credit",
+		NoteColumn:   "Description",
+	},
+}
+
+// ProfileName normalizes the name a profile is saved and looked up by.
+func ProfileName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// checkMapping reports whether p says where to find amounts. The tags on
+// Profile cover the rest.
+func checkMapping(p Profile) error {
+	single := p.AmountColumn != ""
+	split := p.DebitColumn != "" && p.CreditColumn != ""
+	if single == split {
+		return ErrAmountMapping
+	}
+
+	return nil
+}
+
+// columns lists the header names p reads.
+func (p Profile) columns() []string {
+	var cols []string
+	for _, col := range []string{p.DateColumn, p.TimeColumn, p.AmountColumn, p.DebitColumn, p.CreditColumn, p.NoteColumn, p.CategoryColumn, p.ReferenceColumn} {
+		if col != "" {
+			cols = append(cols, col)
+		}
+	}
+
+	return cols
+}
@@ -0,0 +1,168 @@
+package importer
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+)
+
+var ErrInvalidQIF = errors.New("file is not a QIF statement")
+
+// qifDateLayouts are tried in order when the profile names no DateFormat.
+// QIF comes mostly from US software, so dates are read month first.
+var qifDateLayouts = []string{"1/2/2006", "1/2/06", "2006-01-02", "1-2-2006", "1-2-06"}
+
+// qifAccountTypes are the !Type headers that introduce transactions. Other
+// sections, such as category and memorized lists, are skipped.
+var qifAccountTypes = map[string]bool{
+	"bank": true, "cash": true, "ccard": true, "oth a": true, "oth l": true,
+}
+
+// ParseQIF reads the transactions of a QIF file. Each entry is a run of
+// lines keyed by their first letter and closed by "^". QIF has no
+// transaction id of its own, so the ExternalRef is made up by qifRef.
+func ParseQIF(r io.Reader, p Profile) ([]Record, []RowError, error) {
+	sc := bufio.NewScanner(r)
+
+	var records []Record
+	var rowErrs []RowError
+	var sawType, inTxns bool
+	fields := map[byte]string{}
+	line, start := 0, 0
+	// seen counts the entries read so far by what qifRef is made from.
+	seen := map[string]int{}
+
+	for sc.Scan() {
+		line++
+		text := strings.TrimRight(sc.Text(), "\r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "!") {
+			header := strings.ToLower(strings.TrimSpace(text))
+			if strings.HasPrefix(header, "!type:") {
+				sawType = true
+				inTxns = qifAccountTypes[strings.TrimSpace(strings.TrimPrefix(header, "!type:"))]
+			}
+			fields = map[byte]string{}
+			continue
+		}
+		if !inTxns {
+			continue
+		}
+
+		if text[0] == '^' {
+			if len(fields) > 0 {
+				record, err := mapQIF(p, fields, seen)
+				if err != nil {
+					rowErrs = append(rowErrs, RowError{Line: start, Err: err})
+				} else {
+					record.Line = start
+					records = append(records, record)
+				}
+			}
+			fields = map[byte]string{}
+			continue
+		}
+
+		if len(fields) == 0 {
+			start = line
+		}
+		// Split lines (S, E, $) repeat per split; the first one is enough
+		// to know the entry was split, and the total is in T.
+		if _, ok := fields[text[0]]; !ok {
+			fields[text[0]] = strings.TrimSpace(text[1:])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, err
+	}
+	if !sawType {
+		return nil, nil, ErrInvalidQIF
+	}
+
+	return records, rowErrs, nil
+}
+
+func mapQIF(p Profile, f map[byte]string, seen map[string]int) (Record, error) {
+	date, err := parseQIFDate(p, f['D'])
+	if err != nil {
+		return Record{}, err
+	}
+
+	raw := f['T']
+	if raw == "" {
+		raw = f['U']
+	}
+	amount, err := parseMoney(raw)
+	if err != nil {
+		return Record{}, err
+	}
+	alike := date + "\x00" + amount.String() + "\x00" + f['P']
+	ref := qifRef(date, amount, f['P'], seen[alike])
+	seen[alike]++
+	amount, txType, err := signed(amount)
+	if err != nil {
+		return Record{}, err
+	}
+
+	note := f['P']
+	if memo := f['M']; memo != "" {
+		if note != "" {
+			note += " - "
+		}
+		note += memo
+	}
+
+	// Transfers name the other account in brackets rather than a category.
+	category := f['L']
+	if strings.HasPrefix(category, "[") {
+		category = ""
+	}
+
+	return newRecord(p, date, amount, txType, category, note, ref), nil
+}
+
+// qifRef makes up the reference of a QIF entry from its date, amount and
+// payee, and from how many entries alike came before it in the file. The
+// check number in N will not do: it is often free text such as "ATM" that
+// repeats within a file and across accounts. An entry gets the same
+// reference from any export that covers its date, so a later export
+// overlapping an imported one only adds what is new, while look-alike
+// entries, such as two cash withdrawals on one day, are told apart.
+func qifRef(date string, amount money.Money, payee string, occurrence int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%s\x00%d", date, amount, payee, occurrence)))
+	return "qif:" + hex.EncodeToString(sum[:16])
+}
+
+// parseQIFDate reads QIF dates, including Quicken's 1/ 5'24 form where an
+// apostrophe separates years from 2000 on.
+func parseQIFDate(p Profile, s string) (string, error) {
+	if p.DateFormat != "" {
+		t, err := time.Parse(p.DateFormat, s)
+		if err != nil {
+			return "", fmt.Errorf("date %q does not match format %q", s, p.DateFormat)
+		}
+		return t.Format(dateLayout), nil
+	}
+
+	normalized := strings.ReplaceAll(strings.ReplaceAll(s, " ", ""), "'", "/")
+	for _, layout := range qifDateLayouts {
+		if t, err := time.Parse(layout, normalized); err == nil {
+			return t.Format(dateLayout), nil
+		}
+	}
+
+	return "", fmt.Errorf("date %q is not a QIF date", s)
+}
@@ -0,0 +1,68 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQIF(t *testing.T) {
+	t.Run("given bank entries should map them with a reference of their own", func(t *testing.T) {
+		qif := "!Type:Cat\nNFood\n^\n" +
+			"!Type:Bank\n" +
+			"D5/ 1'24\nT-45.50\nN1001\nPLotus's\nMWeekly shop\nLGroceries\n^\n" +
+			"D05/02/2024\nU1,200.00\nPRefund\nL[Savings]\n^\n" +
+			"D13/13/2024\nT-1\n^\n"
+
+		records, rowErrs, err := ParseQIF(strings.NewReader(qif), Profile{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []Record{
+			{Line: 5, Date: "2024-05-01 00:00:00", Amount: money.MustParse("45.50"), TransactionType: "expense", Category: "Groceries", Note: "Lotus's - Weekly shop", ExternalRef: qifRef("2024-05-01 00:00:00", money.MustParse("-45.50"), "Lotus's", 0)},
+			{Line: 12, Date: "2024-05-02 00:00:00", Amount: money.MustParse("1200"), TransactionType: "income", Category: DefaultCategory, Note: "Refund", ExternalRef: qifRef("2024-05-02 00:00:00", money.MustParse("1200"), "Refund", 0)},
+		}, records)
+		assert.Len(t, rowErrs, 1)
+		assert.Equal(t, 17, rowErrs[0].Line)
+	})
+
+	t.Run("given an entry in exports covering different periods should give it the same reference", func(t *testing.T) {
+		earlier := "D04/30/2024\nT-80\nPBus\n^\n"
+		entry := "D05/01/2024\nT-500\nNATM\nPCash\n^\n"
+
+		first, _, err := ParseQIF(strings.NewReader("!Type:Bank\n"+entry), Profile{})
+		assert.NoError(t, err)
+		second, _, err := ParseQIF(strings.NewReader("!Type:Bank\n"+earlier+entry), Profile{})
+		assert.NoError(t, err)
+
+		if assert.Len(t, first, 1) && assert.Len(t, second, 2) {
+			assert.Equal(t, first[0].ExternalRef, second[1].ExternalRef)
+		}
+	})
+
+	t.Run("given entries alike but for their place in the file should give them different references", func(t *testing.T) {
+		entry := "D05/01/2024\nT-500\nNATM\nPCash\n^\n"
+
+		records, _, err := ParseQIF(strings.NewReader("!Type:Bank\n"+entry+entry), Profile{})
+
+		assert.NoError(t, err)
+		if assert.Len(t, records, 2) {
+			assert.NotEqual(t, records[0].ExternalRef, records[1].ExternalRef)
+			assert.NotContains(t, records[0].ExternalRef, "ATM")
+		}
+	})
+
+	t.Run("given profile date format should read dates with it", func(t *testing.T) {
+		records, _, err := ParseQIF(strings.NewReader("!Type:CCard\nD02/05/2024\nT-10\n^\n"), Profile{DateFormat: "02/01/2006"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-05-02 00:00:00", records[0].Date)
+	})
+
+	t.Run("given file without type header should return error", func(t *testing.T) {
+		_, _, err := ParseQIF(strings.NewReader("D05/02/2024\nT-10\n^\n"), Profile{})
+
+		assert.Equal(t, ErrInvalidQIF, err)
+	})
+}
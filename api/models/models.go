@@ -1,13 +1,17 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+)
 
 type Transaction struct {
-	ID       int       `db:"id" json:"id"`
-	Date     time.Time `db:"date" json:"date"`
-	Amount   float64   `db:"amount" json:"amount"`
-	Category string    `db:"category" json:"category"`
-	Type     string    `db:"transaction_type" json:"type"`
-	Note     string    `db:"note" json:"note"`
-	ImageURL string    `db:"image_url" json:"image_url"`
+	ID       int         `db:"id" json:"id"`
+	Date     time.Time   `db:"date" json:"date"`
+	Amount   money.Money `db:"amount" json:"amount"`
+	Category string      `db:"category" json:"category"`
+	Type     string      `db:"transaction_type" json:"type"`
+	Note     string      `db:"note" json:"note"`
+	ImageURL string      `db:"image_url" json:"image_url"`
 }
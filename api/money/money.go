@@ -0,0 +1,150 @@
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of decimal places stored by the DECIMAL(10,2) amount
+// columns.
+const Scale = 2
+
+var (
+	ErrInvalid   = errors.New("amount must be a number with at most 2 decimal places")
+	ErrOverflow  = errors.New("amount is out of range")
+	errScanValue = errors.New("unsupported amount type")
+)
+
+var hundred = big.NewRat(100, 1)
+
+// decimalRe is the plain decimal notation Parse accepts. big.Rat alone would
+// also take fractions such as "3/2", hex such as "0x10" and exponents.
+var decimalRe = regexp.MustCompile(`^[-+]?[0-9]+(\.[0-9]+)?$`)
+
+// Money is an exact amount counted in hundredths of the currency unit, so
+// 12.34 is stored as 1234. It scans from and writes to Postgres numeric as
+// decimal text and marshals to JSON as a number with two decimal places.
+type Money int64
+
+// Parse converts a decimal string such as "12.34" or "-5" to Money. Values
+// with more than two decimal places are rejected rather than rounded, though
+// trailing zeros, as Postgres may print them, are fine.
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if !decimalRe.MatchString(s) {
+		return 0, ErrInvalid
+	}
+
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, ErrInvalid
+	}
+
+	r.Mul(r, hundred)
+	if !r.IsInt() {
+		return 0, ErrInvalid
+	}
+
+	n := r.Num()
+	if !n.IsInt64() {
+		return 0, ErrOverflow
+	}
+
+	return Money(n.Int64()), nil
+}
+
+// MustParse is Parse for constants known to be valid; it panics otherwise.
+func MustParse(s string) Money {
+	m, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return m
+}
+
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+	}
+
+	u := uint64(v)
+	if v < 0 {
+		u = uint64(-v)
+	}
+
+	return fmt.Sprintf("%s%d.%02d", sign, u/100, u%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts either a JSON number or a string holding one.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+
+	*m = v
+	return nil
+}
+
+// Scan implements sql.Scanner. Postgres numeric arrives as text; integer and
+// float sources are accepted for drivers that report them natively.
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case int64:
+		if v > math.MaxInt64/100 || v < math.MinInt64/100 {
+			return ErrOverflow
+		}
+		*m = Money(v * 100)
+		return nil
+	case float64:
+		*m = Money(math.Round(v * 100))
+		return nil
+	}
+
+	return fmt.Errorf("%w %T", errScanValue, src)
+}
+
+func (m *Money) scanString(s string) error {
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+
+	*m = v
+	return nil
+}
+
+// Value implements driver.Valuer, sending the amount as decimal text so
+// Postgres stores it without passing through float64.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
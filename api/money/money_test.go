@@ -0,0 +1,113 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Money
+		err      error
+	}{
+		{"12.34", 1234, nil},
+		{"0.1", 10, nil},
+		{"-5", -500, nil},
+		{"+7.5", 750, nil},
+		{"12.340", 1234, nil},
+		{"12.345", 0, ErrInvalid},
+		{"abc", 0, ErrInvalid},
+		{"3/2", 0, ErrInvalid},
+		{"0x10", 0, ErrInvalid},
+		{"1e3", 0, ErrInvalid},
+		{"1E-2", 0, ErrInvalid},
+		{".5", 0, ErrInvalid},
+		{"1000000000000000000000", 0, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		m, err := Parse(tt.input)
+		assert.ErrorIs(t, err, tt.err, tt.input)
+		assert.Equal(t, tt.expected, m, tt.input)
+	}
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "12.34", Money(1234).String())
+	assert.Equal(t, "0.05", Money(5).String())
+	assert.Equal(t, "-0.50", Money(-50).String())
+	assert.Equal(t, "0.00", Money(0).String())
+}
+
+func TestSumIsExact(t *testing.T) {
+	var total Money
+	for i := 0; i < 10; i++ {
+		total += MustParse("0.1")
+	}
+
+	assert.Equal(t, MustParse("1"), total)
+}
+
+func TestJSON(t *testing.T) {
+	t.Run("given money should marshal as fixed scale number", func(t *testing.T) {
+		b, err := json.Marshal(struct {
+			Amount Money `json:"amount"`
+		}{MustParse("25.5")})
+
+		assert.NoError(t, err)
+		assert.Equal(t, `{"amount":25.50}`, string(b))
+	})
+
+	t.Run("given number or string should unmarshal exactly", func(t *testing.T) {
+		var v struct {
+			A Money `json:"a"`
+			B Money `json:"b"`
+		}
+
+		err := json.Unmarshal([]byte(`{"a": 0.29, "b": "1234.56"}`), &v)
+
+		assert.NoError(t, err)
+		assert.Equal(t, Money(29), v.A)
+		assert.Equal(t, Money(123456), v.B)
+	})
+
+	t.Run("given too many decimals should return error", func(t *testing.T) {
+		var m Money
+
+		err := json.Unmarshal([]byte(`1.005`), &m)
+
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src      any
+		expected Money
+	}{
+		{[]byte("100.25"), 10025},
+		{"7.10", 710},
+		{int64(20), 2000},
+		{float64(0.29), 29},
+		{nil, 0},
+	}
+
+	for _, tt := range tests {
+		var m Money
+		assert.NoError(t, m.Scan(tt.src))
+		assert.Equal(t, tt.expected, m)
+	}
+
+	var m Money
+	assert.Error(t, m.Scan(true))
+}
+
+func TestValue(t *testing.T) {
+	v, err := MustParse("30").Value()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "30.00", v)
+}
@@ -0,0 +1,316 @@
+package recurring
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/exchange"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	ErrRecurringNotFound = errors.New("recurring transaction not found")
+	ErrInvalidTime       = errors.New("starts_at and until must be formatted as YYYY-MM-DD or RFC3339")
+	ErrStartsTooEarly    = fmt.Errorf("starts_at must leave at most %d occurrences in the past", maxCatchUp)
+)
+
+// Recurring is a transaction that repeats on a schedule. The scheduler
+// creates one transaction per occurrence; NextRun is when the next one is
+// due and is omitted once the schedule has ended.
+type Recurring struct {
+	ID              int         `json:"id,omitempty"`
+	SpenderID       int         `json:"spender_id"`
+	Amount          money.Money `json:"amount" validate:"required,money_gt=0"`
+	Currency        string      `json:"currency"`
+	Category        string      `json:"category" validate:"required"`
+	TransactionType string      `json:"transaction_type" validate:"required,oneof=income expense"`
+	Note            string      `json:"note"`
+
+	Frequency   string `json:"frequency" validate:"required,oneof=daily weekly monthly yearly"`
+	Interval    int    `json:"interval"`
+	StartsAt    string `json:"starts_at" validate:"required"`
+	Until       string `json:"until,omitempty"`
+	Count       int    `json:"count,omitempty" validate:"gte=0"`
+	Occurrences int    `json:"occurrences"`
+	NextRun     string `json:"next_run,omitempty"`
+}
+
+// Rule parses the schedule of r.
+func (r Recurring) Rule() (Rule, error) {
+	start, err := parseTime(r.StartsAt, false)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	rule := Rule{Frequency: r.Frequency, Interval: r.Interval, Start: start, Count: r.Count}
+	if r.Until != "" {
+		until, err := parseTime(r.Until, true)
+		if err != nil {
+			return Rule{}, err
+		}
+		rule.Until = &until
+	}
+
+	return rule, rule.validate()
+}
+
+// Transaction is occurrence at of r as a transaction.
+func (r Recurring) Transaction(at time.Time) transaction.Transaction {
+	return transaction.Transaction{
+		Date:            at.Format(time.RFC3339),
+		Amount:          r.Amount,
+		Category:        r.Category,
+		TransactionType: r.TransactionType,
+		Note:            r.Note,
+		SpenderID:       r.SpenderID,
+		Currency:        r.Currency,
+	}
+}
+
+type handler struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *handler {
+	return &handler{db: db}
+}
+
+const (
+	columns    = `id, spender_id, amount, currency, category, transaction_type, note, frequency, "interval", starts_at, until, COALESCE(count, 0), occurrences, next_run`
+	insertStmt = `INSERT INTO recurring_transaction (spender_id, amount, currency, category, transaction_type, note, frequency, "interval", starts_at, until, count, next_run) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, 0), $12) RETURNING id`
+	getStmt    = `SELECT ` + columns + ` FROM recurring_transaction WHERE id = $1`
+	listStmt   = `SELECT ` + columns + ` FROM recurring_transaction WHERE spender_id = $1 ORDER BY id`
+	deleteStmt = `DELETE FROM recurring_transaction WHERE id = $1`
+)
+
+// scan reads a row selected with columns into r.
+func scan(row interface{ Scan(dest ...any) error }, r *Recurring) error {
+	var start time.Time
+	var until, next *time.Time
+	err := row.Scan(&r.ID, &r.SpenderID, &r.Amount, &r.Currency, &r.Category, &r.TransactionType, &r.Note, &r.Frequency, &r.Interval, &start, &until, &r.Count, &r.Occurrences, &next)
+	if err != nil {
+		return err
+	}
+
+	r.StartsAt = start.Format(time.RFC3339)
+	r.Until = formatTime(until)
+	r.NextRun = formatTime(next)
+	return nil
+}
+
+// Create stores a recurring transaction. Its first occurrence is due at
+// starts_at; a start in the past is caught up by the scheduler's next run.
+// A start so far back that more occurrences than the scheduler creates in
+// one go would already be due is refused, so a schedule starting in 1900
+// cannot flood the spender with transactions.
+func (h handler) Create(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var r Recurring
+	if err := c.Bind(&r); err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+	}
+	r.SpenderID = p.OwnerFor(r.SpenderID)
+	if r.SpenderID == 0 {
+		logger.Error("spender_id is required")
+		return c.JSON(http.StatusBadRequest, errs.ParseError(transaction.ErrSpenderRequired))
+	}
+
+	if err := c.Validate(r); err != nil {
+		logger.Error("validate request body failed", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	var err error
+	if r.Currency, err = exchange.NormalizeCurrency(r.Currency); err != nil {
+		logger.Error("currency is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	rule, err := r.Rule()
+	if err != nil {
+		logger.Error("schedule is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	if at, ok := rule.Next(maxCatchUp); ok && !at.After(time.Now()) {
+		logger.Error("schedule starts too far in the past", zap.String("starts_at", r.StartsAt))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(ErrStartsTooEarly))
+	}
+
+	var next *time.Time
+	if at, ok := rule.Next(0); ok {
+		next = &at
+	}
+
+	err = h.db.QueryRowContext(ctx, insertStmt, r.SpenderID, r.Amount, r.Currency, r.Category, r.TransactionType, r.Note, r.Frequency, r.Interval, rule.Start, rule.Until, r.Count, next).Scan(&r.ID)
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	r.StartsAt = rule.Start.Format(time.RFC3339)
+	r.Until = formatTime(rule.Until)
+	r.NextRun = formatTime(next)
+
+	logger.Info("create successfully", zap.Int("id", r.ID))
+	return c.JSON(http.StatusCreated, r)
+}
+
+// Get returns a single recurring transaction.
+func (h handler) Get(c echo.Context) error {
+	r, status, err := h.load(c)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	return c.JSON(http.StatusOK, r)
+}
+
+// Delete stops a recurring transaction. Transactions it already created are
+// kept.
+func (h handler) Delete(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	r, status, err := h.load(c)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	if _, err := h.db.ExecContext(ctx, deleteStmt, r.ID); err != nil {
+		logger.Error("delete recurring transaction error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	logger.Info("delete successfully", zap.Int("id", r.ID))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetBySpender lists the recurring transactions of spender :id.
+func (h handler) GetBySpender(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+	}
+
+	spenderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Error("ID parameter is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	if !p.CanAccess(spenderID) {
+		return c.JSON(http.StatusForbidden, errs.ParseError(errs.ErrForbidden))
+	}
+
+	rows, err := h.db.QueryContext(ctx, listStmt, spenderID)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	defer rows.Close()
+
+	list := make([]Recurring, 0)
+	for rows.Next() {
+		var r Recurring
+		if err := scan(rows, &r); err != nil {
+			logger.Error("scan error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+		list = append(list, r)
+	}
+	if err := rows.Err(); err != nil {
+		logger.Error("rows error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	return c.JSON(http.StatusOK, list)
+}
+
+// load reads the recurring transaction named by the :id path parameter and
+// checks the principal may act on it.
+func (h handler) load(c echo.Context) (Recurring, int, error) {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Error("ID parameter is invalid", zap.Error(err))
+		return Recurring{}, http.StatusBadRequest, err
+	}
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return Recurring{}, http.StatusUnauthorized, errs.ErrUnauthorized
+	}
+
+	var r Recurring
+	err = scan(h.db.QueryRowContext(ctx, getStmt, id), &r)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("recurring transaction not found", zap.Int("id", id))
+		return Recurring{}, http.StatusNotFound, ErrRecurringNotFound
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return Recurring{}, http.StatusInternalServerError, err
+	}
+
+	if !p.CanAccess(r.SpenderID) {
+		logger.Warn("recurring transaction belongs to another spender", zap.Int("id", id), zap.Int("spender_id", p.SpenderID))
+		return Recurring{}, http.StatusForbidden, errs.ErrForbidden
+	}
+
+	return r, http.StatusOK, nil
+}
+
+// parseTime accepts a calendar date or an RFC3339 timestamp. A calendar date
+// used as an upper bound covers the whole day.
+func parseTime(v string, upper bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(dateLayout, v)
+	if err != nil {
+		return time.Time{}, ErrInvalidTime
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return t, nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
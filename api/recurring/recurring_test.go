@@ -0,0 +1,208 @@
+package recurring
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
+	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var recurringColumns = []string{"id", "spender_id", "amount", "currency", "category", "transaction_type", "note", "frequency", "interval", "starts_at", "until", "count", "occurrences", "next_run"}
+
+func newContext(method, body string, p auth.Principal) (echo.Context, *httptest.ResponseRecorder) {
+	e := echo.New()
+	e.Validator = cv.New()
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	auth.SetPrincipal(c, p)
+	return c, rec
+}
+
+func TestCreate(t *testing.T) {
+	spender := auth.Principal{SpenderID: 1, Role: auth.RoleSpender}
+
+	t.Run("given a monthly schedule should create it due at starts_at", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, `{"spender_id": 9, "amount": 15000, "category": "rent", "transaction_type": "expense", "note": "condo", "frequency": "monthly", "starts_at": "2024-05-31", "count": 12}`, spender)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		start := date("2024-05-31")
+		mock.ExpectQuery(insertStmt).
+			WithArgs(1, money.MustParse("15000"), "THB", "rent", "expense", "condo", "monthly", 1, start, nil, 12, &start).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+
+		err := New(db).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id": 7, "spender_id": 1, "amount": 15000, "currency": "THB", "category": "rent", "transaction_type": "expense", "note": "condo", "frequency": "monthly", "interval": 1, "starts_at": "2024-05-31T00:00:00Z", "count": 12, "occurrences": 0, "next_run": "2024-05-31T00:00:00Z"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given unknown frequency should return bad request", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, `{"amount": 100, "category": "gym", "transaction_type": "expense", "frequency": "hourly", "starts_at": "2024-05-01"}`, spender)
+
+		err := New(nil).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("given both until and count should return bad request", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, `{"amount": 100, "category": "gym", "transaction_type": "expense", "frequency": "weekly", "starts_at": "2024-05-01", "until": "2024-12-31", "count": 3}`, spender)
+
+		err := New(nil).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages": ["only one of until and count may be set"]}`, rec.Body.String())
+	})
+
+	t.Run("given starts_at more occurrences back than one catch-up should return bad request", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, `{"amount": 100, "category": "gym", "transaction_type": "expense", "frequency": "daily", "starts_at": "1900-01-01"}`, spender)
+
+		err := New(nil).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages": ["starts_at must leave at most 100 occurrences in the past"]}`, rec.Body.String())
+	})
+
+	t.Run("given malformed starts_at should return bad request", func(t *testing.T) {
+		c, rec := newContext(http.MethodPost, `{"amount": 100, "category": "gym", "transaction_type": "expense", "frequency": "weekly", "starts_at": "01/05/2024"}`, spender)
+
+		err := New(nil).Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages": ["starts_at and until must be formatted as YYYY-MM-DD or RFC3339"]}`, rec.Body.String())
+	})
+}
+
+func TestGet(t *testing.T) {
+	row := func() *sqlmock.Rows {
+		start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		next := start.AddDate(0, 1, 0)
+		return sqlmock.NewRows(recurringColumns).AddRow(7, 1, 500, "THB", "netflix", "expense", "", "monthly", 1, start, nil, 0, 1, next)
+	}
+
+	t.Run("given own recurring transaction should return it", func(t *testing.T) {
+		c, rec := newContext(http.MethodGet, "", auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		utils.SetParams(c, utils.KeyValuePairs{"id": "7"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs(7).WillReturnRows(row())
+
+		err := New(db).Get(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 7, "spender_id": 1, "amount": 500, "currency": "THB", "category": "netflix", "transaction_type": "expense", "note": "", "frequency": "monthly", "interval": 1, "starts_at": "2024-05-01T00:00:00Z", "occurrences": 1, "next_run": "2024-06-01T00:00:00Z"}`, rec.Body.String())
+	})
+
+	t.Run("given another spender's recurring transaction should return forbidden", func(t *testing.T) {
+		c, rec := newContext(http.MethodGet, "", auth.Principal{SpenderID: 2, Role: auth.RoleSpender})
+		utils.SetParams(c, utils.KeyValuePairs{"id": "7"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs(7).WillReturnRows(row())
+
+		err := New(db).Get(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("given unknown id should return not found", func(t *testing.T) {
+		c, rec := newContext(http.MethodGet, "", auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		utils.SetParams(c, utils.KeyValuePairs{"id": "7"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(getStmt).WithArgs(7).WillReturnRows(sqlmock.NewRows(recurringColumns))
+
+		err := New(db).Get(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestDelete(t *testing.T) {
+	t.Run("given own recurring transaction should delete it", func(t *testing.T) {
+		c, rec := newContext(http.MethodDelete, "", auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		utils.SetParams(c, utils.KeyValuePairs{"id": "7"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(getStmt).WithArgs(7).
+			WillReturnRows(sqlmock.NewRows(recurringColumns).AddRow(7, 1, 500, "THB", "netflix", "expense", "", "monthly", 1, start, nil, 0, 0, start))
+		mock.ExpectExec(deleteStmt).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := New(db).Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestGetBySpender(t *testing.T) {
+	t.Run("given own spender id should list the recurring transactions", func(t *testing.T) {
+		c, rec := newContext(http.MethodGet, "", auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		start := time.Date(2024, 1, 25, 0, 0, 0, 0, time.UTC)
+		until := time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC)
+		mock.ExpectQuery(listStmt).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(recurringColumns).AddRow(3, 1, 50000, "THB", "salary", "income", "", "monthly", 1, start, until, 0, 12, nil))
+
+		err := New(db).GetBySpender(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `[{"id": 3, "spender_id": 1, "amount": 50000, "currency": "THB", "category": "salary", "transaction_type": "income", "note": "", "frequency": "monthly", "interval": 1, "starts_at": "2024-01-25T00:00:00Z", "until": "2024-12-25T00:00:00Z", "occurrences": 12}]`, rec.Body.String())
+	})
+
+	t.Run("given another spender id should return forbidden", func(t *testing.T) {
+		c, rec := newContext(http.MethodGet, "", auth.Principal{SpenderID: 2, Role: auth.RoleSpender})
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+
+		err := New(nil).GetBySpender(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("given query error should return internal server error", func(t *testing.T) {
+		c, rec := newContext(http.MethodGet, "", auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+		mock.ExpectQuery(listStmt).WithArgs(1).WillReturnError(errors.New("query error"))
+
+		err := New(db).GetBySpender(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+}
@@ -0,0 +1,88 @@
+package recurring
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+	Yearly  = "yearly"
+)
+
+var (
+	ErrInvalidInterval  = errors.New("the value of interval must be greater than 0")
+	ErrUntilAndCount    = errors.New("only one of until and count may be set")
+	ErrUntilBeforeStart = errors.New("until must not be before starts_at")
+)
+
+// Rule is the subset of an iCalendar RRULE that recurring transactions need:
+// FREQ and INTERVAL, bounded by either UNTIL or COUNT, or by neither.
+type Rule struct {
+	Frequency string
+	Interval  int
+	Start     time.Time
+	Until     *time.Time
+	Count     int
+}
+
+func (r Rule) validate() error {
+	if r.Interval < 1 {
+		return ErrInvalidInterval
+	}
+	if r.Until != nil && r.Count > 0 {
+		return ErrUntilAndCount
+	}
+	if r.Until != nil && r.Until.Before(r.Start) {
+		return ErrUntilBeforeStart
+	}
+
+	return nil
+}
+
+// At returns occurrence n, counting from 0 at Start. Every occurrence is
+// computed from Start rather than from the one before, so a rent due on the
+// 31st falls on the last day of shorter months and returns to the 31st after.
+func (r Rule) At(n int) time.Time {
+	step := n * r.Interval
+	switch r.Frequency {
+	case Daily:
+		return r.Start.AddDate(0, 0, step)
+	case Weekly:
+		return r.Start.AddDate(0, 0, 7*step)
+	case Yearly:
+		return addMonths(r.Start, 12*step)
+	default:
+		return addMonths(r.Start, step)
+	}
+}
+
+// Next returns occurrence n and whether the rule still has it.
+func (r Rule) Next(n int) (time.Time, bool) {
+	if r.Count > 0 && n >= r.Count {
+		return time.Time{}, false
+	}
+
+	at := r.At(n)
+	if r.Until != nil && at.After(*r.Until) {
+		return time.Time{}, false
+	}
+
+	return at, true
+}
+
+// addMonths moves t by months, clamping the day to the end of the target
+// month instead of overflowing into the next one as time.AddDate does.
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month(), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	target := first.AddDate(0, months, 0)
+
+	day := t.Day()
+	if last := target.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+
+	return target.AddDate(0, 0, day-1)
+}
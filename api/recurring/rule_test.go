@@ -0,0 +1,77 @@
+package recurring
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestRuleAt(t *testing.T) {
+	cases := []struct {
+		name string
+		rule Rule
+		n    int
+		want string
+	}{
+		{"daily", Rule{Frequency: Daily, Interval: 1, Start: date("2024-05-30")}, 3, "2024-06-02"},
+		{"every second week", Rule{Frequency: Weekly, Interval: 2, Start: date("2024-05-01")}, 2, "2024-05-29"},
+		{"monthly on the 31st clamps to february", Rule{Frequency: Monthly, Interval: 1, Start: date("2024-01-31")}, 1, "2024-02-29"},
+		{"monthly on the 31st returns to the 31st", Rule{Frequency: Monthly, Interval: 1, Start: date("2024-01-31")}, 2, "2024-03-31"},
+		{"quarterly", Rule{Frequency: Monthly, Interval: 3, Start: date("2024-11-15")}, 1, "2025-02-15"},
+		{"yearly on a leap day", Rule{Frequency: Yearly, Interval: 1, Start: date("2024-02-29")}, 1, "2025-02-28"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.rule.At(tc.n).Format(dateLayout))
+		})
+	}
+}
+
+func TestRuleNext(t *testing.T) {
+	t.Run("given count should stop after count occurrences", func(t *testing.T) {
+		r := Rule{Frequency: Monthly, Interval: 1, Start: date("2024-01-01"), Count: 2}
+
+		_, ok := r.Next(1)
+		assert.True(t, ok)
+		_, ok = r.Next(2)
+		assert.False(t, ok)
+	})
+
+	t.Run("given until should stop after until", func(t *testing.T) {
+		until := date("2024-01-15")
+		r := Rule{Frequency: Weekly, Interval: 1, Start: date("2024-01-01"), Until: &until}
+
+		at, ok := r.Next(2)
+		assert.True(t, ok)
+		assert.Equal(t, "2024-01-15", at.Format(dateLayout))
+		_, ok = r.Next(3)
+		assert.False(t, ok)
+	})
+
+	t.Run("given no bound should go on", func(t *testing.T) {
+		r := Rule{Frequency: Yearly, Interval: 1, Start: date("2024-01-01")}
+
+		at, ok := r.Next(100)
+		assert.True(t, ok)
+		assert.Equal(t, "2124-01-01", at.Format(dateLayout))
+	})
+}
+
+func TestRuleValidate(t *testing.T) {
+	until := date("2024-01-01")
+
+	assert.NoError(t, Rule{Frequency: Daily, Interval: 1, Start: until, Until: &until}.validate())
+	assert.ErrorIs(t, Rule{Frequency: Daily, Interval: 0, Start: until}.validate(), ErrInvalidInterval)
+	assert.ErrorIs(t, Rule{Frequency: Daily, Interval: 1, Start: until, Until: &until, Count: 3}.validate(), ErrUntilAndCount)
+	assert.ErrorIs(t, Rule{Frequency: Daily, Interval: 1, Start: until.AddDate(0, 0, 1), Until: &until}.validate(), ErrUntilBeforeStart)
+}
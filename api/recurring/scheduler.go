@@ -0,0 +1,148 @@
+package recurring
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// maxCatchUp caps how many occurrences of one schedule are created in a
+// single database transaction. A schedule further behind than that stays due
+// and is picked up again straight away.
+const maxCatchUp = 100
+
+const (
+	// dueStmt locks the schedule that has waited longest. SKIP LOCKED lets
+	// replicas running at the same time each take a different schedule
+	// instead of queueing behind one another.
+	dueStmt = `SELECT ` + columns + ` FROM recurring_transaction WHERE next_run <= $1 AND NOT (id = ANY($2)) ORDER BY next_run, id LIMIT 1 FOR UPDATE SKIP LOCKED`
+
+	occurrenceStmt = `INSERT INTO recurring_occurrence (recurring_id, seq, transaction_id) VALUES ($1, $2, $3)`
+	advanceStmt    = `UPDATE recurring_transaction SET occurrences = $2, next_run = $3 WHERE id = $1`
+)
+
+// Scheduler turns due occurrences of recurring transactions into
+// transactions. Each occurrence is created exactly once however many
+// replicas run a Scheduler: the schedule row is locked while its occurrences
+// are created, and recurring_occurrence refuses a second row for the same
+// occurrence should the lock ever be bypassed.
+type Scheduler struct {
+	db       *sql.DB
+	interval time.Duration
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+func NewScheduler(db *sql.DB, interval time.Duration, logger *zap.Logger) *Scheduler {
+	return &Scheduler{db: db, interval: interval, logger: logger, now: time.Now}
+}
+
+// Run materializes due occurrences straight away and then every interval
+// until ctx is done. A run in progress when ctx is cancelled finishes the
+// schedule it is working on before Run returns, so shutdown never leaves a
+// schedule half advanced.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		created, err := s.RunOnce(ctx)
+		if err != nil {
+			s.logger.Error("materialize recurring transactions failed", zap.Error(err))
+		}
+		if created > 0 {
+			s.logger.Info("recurring transactions created", zap.Int("created", created))
+		}
+
+		select {
+		case <-ctx.Done():
+			s.logger.Info("recurring scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce creates every occurrence due now and returns how many it created.
+// A schedule that fails is skipped for the rest of the run so it cannot hold
+// up the others; the first such error is returned.
+func (s *Scheduler) RunOnce(ctx context.Context) (int, error) {
+	now := s.now()
+	created := 0
+	failed := []int64{}
+	var firstErr error
+
+	for ctx.Err() == nil {
+		id, n, err := s.materialize(context.WithoutCancel(ctx), now, failed)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			s.logger.Error("materialize recurring transaction failed", zap.Int("id", id), zap.Error(err))
+			if id == 0 {
+				return created, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed = append(failed, int64(id))
+			continue
+		}
+		created += n
+	}
+
+	return created, firstErr
+}
+
+// materialize locks the schedule most overdue at now, other than those in
+// skip, and creates its due occurrences in one database transaction. It
+// returns sql.ErrNoRows when nothing is due.
+func (s *Scheduler) materialize(ctx context.Context, now time.Time, skip []int64) (int, int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var r Recurring
+	if err := scan(tx.QueryRowContext(ctx, dueStmt, now, pq.Array(skip)), &r); err != nil {
+		return 0, 0, err
+	}
+
+	rule, err := r.Rule()
+	if err != nil {
+		return r.ID, 0, err
+	}
+
+	created := 0
+	seq := r.Occurrences
+	at, ok := rule.Next(seq)
+	for ok && !at.After(now) && created < maxCatchUp {
+		t, err := transaction.Insert(ctx, tx, r.Transaction(at))
+		if err != nil {
+			return r.ID, 0, err
+		}
+		if _, err := tx.ExecContext(ctx, occurrenceStmt, r.ID, seq, t.ID); err != nil {
+			return r.ID, 0, err
+		}
+
+		created++
+		seq++
+		at, ok = rule.Next(seq)
+	}
+
+	var next *time.Time
+	if ok {
+		next = &at
+	}
+	if _, err := tx.ExecContext(ctx, advanceStmt, r.ID, seq, next); err != nil {
+		return r.ID, 0, err
+	}
+
+	return r.ID, created, tx.Commit()
+}
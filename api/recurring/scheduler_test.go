@@ -0,0 +1,150 @@
+package recurring
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const insertTxStmt = "WITH t AS (INSERT INTO transaction (date, amount, category, transaction_type, note, image_url, spender_id, currency, external_ref) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, '')) RETURNING *) SELECT " + transaction.Columns + " FROM t" + transaction.Join
+
+var txColumns = []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+
+func TestRunOnce(t *testing.T) {
+	now := time.Date(2024, 7, 10, 9, 0, 0, 0, time.UTC)
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("given a schedule behind by several months should catch up and advance it", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		s := NewScheduler(db, time.Minute, zap.NewNop())
+		s.now = func() time.Time { return now }
+
+		june := start.AddDate(0, 1, 0)
+		july := start.AddDate(0, 2, 0)
+		august := start.AddDate(0, 3, 0)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(dueStmt).WithArgs(now, pq.Array([]int64{})).
+			WillReturnRows(sqlmock.NewRows(recurringColumns).AddRow(7, 1, 15000, "THB", "rent", "expense", "condo", "monthly", 1, start, nil, 0, 1, june))
+		for i, at := range []time.Time{june, july} {
+			mock.ExpectQuery(insertTxStmt).
+				WithArgs(at.Format(time.RFC3339), sqlmock.AnyArg(), "rent", "expense", "condo", "", 1, "THB", "").
+				WillReturnRows(sqlmock.NewRows(txColumns).AddRow(100+i, at, 15000, "rent", "expense", "condo", "", 1, "THB", 15000, "THB", 1, ""))
+			mock.ExpectExec(occurrenceStmt).WithArgs(7, 1+i, 100+i).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectExec(advanceStmt).WithArgs(7, 3, &august).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(dueStmt).WithArgs(now, pq.Array([]int64{})).WillReturnRows(sqlmock.NewRows(recurringColumns))
+		mock.ExpectRollback()
+
+		created, err := s.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, created)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a schedule at its last occurrence should end it", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		s := NewScheduler(db, time.Minute, zap.NewNop())
+		s.now = func() time.Time { return now }
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(dueStmt).WithArgs(now, pq.Array([]int64{})).
+			WillReturnRows(sqlmock.NewRows(recurringColumns).AddRow(7, 1, 99, "THB", "gym", "expense", "", "monthly", 1, start, nil, 1, 0, start))
+		mock.ExpectQuery(insertTxStmt).
+			WithArgs(start.Format(time.RFC3339), sqlmock.AnyArg(), "gym", "expense", "", "", 1, "THB", "").
+			WillReturnRows(sqlmock.NewRows(txColumns).AddRow(100, start, 99, "gym", "expense", "", "", 1, "THB", 99, "THB", 1, ""))
+		mock.ExpectExec(occurrenceStmt).WithArgs(7, 0, 100).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(advanceStmt).WithArgs(7, 1, nil).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(dueStmt).WithArgs(now, pq.Array([]int64{})).WillReturnRows(sqlmock.NewRows(recurringColumns))
+		mock.ExpectRollback()
+
+		created, err := s.RunOnce(context.Background())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, created)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given an occurrence already created should roll back and skip the schedule", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		s := NewScheduler(db, time.Minute, zap.NewNop())
+		s.now = func() time.Time { return now }
+
+		conflict := &pq.Error{Code: "23505"}
+		mock.ExpectBegin()
+		mock.ExpectQuery(dueStmt).WithArgs(now, pq.Array([]int64{})).
+			WillReturnRows(sqlmock.NewRows(recurringColumns).AddRow(7, 1, 99, "THB", "gym", "expense", "", "monthly", 1, start, nil, 0, 0, start))
+		mock.ExpectQuery(insertTxStmt).
+			WithArgs(start.Format(time.RFC3339), sqlmock.AnyArg(), "gym", "expense", "", "", 1, "THB", "").
+			WillReturnRows(sqlmock.NewRows(txColumns).AddRow(100, start, 99, "gym", "expense", "", "", 1, "THB", 99, "THB", 1, ""))
+		mock.ExpectExec(occurrenceStmt).WithArgs(7, 0, 100).WillReturnError(conflict)
+		mock.ExpectRollback()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(dueStmt).WithArgs(now, pq.Array([]int64{7})).WillReturnRows(sqlmock.NewRows(recurringColumns))
+		mock.ExpectRollback()
+
+		created, err := s.RunOnce(context.Background())
+
+		assert.ErrorIs(t, err, conflict)
+		assert.Equal(t, 0, created)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given the database is unavailable should return the error", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		s := NewScheduler(db, time.Minute, zap.NewNop())
+		mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+
+		created, err := s.RunOnce(context.Background())
+
+		assert.EqualError(t, err, "connection refused")
+		assert.Equal(t, 0, created)
+	})
+}
+
+func TestRun(t *testing.T) {
+	t.Run("given cancelled context should return after one run", func(t *testing.T) {
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		s := NewScheduler(db, time.Hour, zap.NewNop())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		done := make(chan struct{})
+		go func() {
+			s.Run(ctx)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after its context was cancelled")
+		}
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
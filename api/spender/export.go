@@ -0,0 +1,238 @@
+package spender
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	ExportCSV   = "csv"
+	ExportXLSX  = "xlsx"
+	ExportJSONL = "jsonl"
+)
+
+var ErrInvalidExportFormat = errors.New("the value of format must be one of csv xlsx jsonl")
+
+const exportTxStmt = `SELECT ` + transaction.Columns + ` FROM transaction t` + transaction.Join
+
+// exportHeader names the columns of CSV and XLSX exports.
+var exportHeader = []string{"id", "date", "amount", "currency", "converted_amount", "home_currency", "category", "transaction_type", "note", "external_ref", "image_url"}
+
+// exportNumeric marks the exportHeader columns written as numbers in XLSX.
+var exportNumeric = map[int]bool{0: true, 2: true, 4: true}
+
+// rowWriter writes exported transactions in one format. Close must be called
+// after the last row for the output to be complete.
+type rowWriter interface {
+	Write(tx transaction.Transaction) error
+	Close() error
+}
+
+type exportFormat struct {
+	contentType string
+	newWriter   func(w io.Writer) (rowWriter, error)
+}
+
+var exportFormats = map[string]exportFormat{
+	ExportCSV:   {"text/csv; charset=utf-8", newCSVExport},
+	ExportXLSX:  {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", newXLSXExport},
+	ExportJSONL: {"application/x-ndjson", newJSONLExport},
+}
+
+// ExportTransactions downloads the transactions of spender :id as CSV, XLSX
+// or JSON Lines, chosen by the format query parameter (csv by default). It
+// takes the same filter parameters as GET /transactions, except spender_id.
+//
+// Rows are written as they are read from the database, so an export of any
+// size runs in constant memory. Once the first byte is sent the status can
+// no longer change; a failure after that aborts the connection so the client
+// sees an incomplete download instead of a short file.
+func (h handler) ExportTransactions(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, status, err := resolveSpenderID(c)
+	if err != nil {
+		logger.Error("resolve spender ID failed", zap.Error(err))
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	name := c.QueryParam("format")
+	if name == "" {
+		name = ExportCSV
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		logger.Error("export format is invalid", zap.String("format", name))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(ErrInvalidExportFormat))
+	}
+
+	f, err := transaction.ParseFilter(c)
+	if err != nil {
+		logger.Error("filter query is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+	f.SpenderID = id
+
+	where, args := f.Where(nil)
+	rows, err := h.db.QueryContext(ctx, exportTxStmt+where+f.OrderBy(), args...)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	defer rows.Close()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, format.contentType)
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="spender-%d-transactions.%s"`, id, name))
+	res.WriteHeader(http.StatusOK)
+
+	count, err := writeExport(rows, format, res)
+	if err != nil {
+		logger.Error("export interrupted", zap.Int("id", id), zap.Int("rows", count), zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+
+	logger.Info("export successfully", zap.Int("id", id), zap.String("format", name), zap.Int("rows", count))
+	return nil
+}
+
+// writeExport copies rows into w and returns how many were written.
+func writeExport(rows *sql.Rows, format exportFormat, w io.Writer) (int, error) {
+	out, err := format.newWriter(w)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for rows.Next() {
+		var tx transaction.Transaction
+		if err := transaction.Scan(rows, &tx); err != nil {
+			return count, err
+		}
+		if err := out.Write(tx); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+
+	return count, out.Close()
+}
+
+// exportRecord lays tx out in the order of exportHeader. The cells spenders
+// type themselves are passed through escapeFormula.
+func exportRecord(tx transaction.Transaction) []string {
+	converted := ""
+	if tx.ConvertedAmount != nil {
+		converted = tx.ConvertedAmount.String()
+	}
+
+	return []string{
+		strconv.FormatUint(uint64(tx.ID), 10),
+		tx.Date,
+		tx.Amount.String(),
+		tx.Currency,
+		converted,
+		tx.ConvertedCurrency,
+		escapeFormula(tx.Category),
+		tx.TransactionType,
+		escapeFormula(tx.Note),
+		escapeFormula(tx.ExternalRef),
+		tx.ImageURL,
+	}
+}
+
+// escapeFormula prefixes text that a spreadsheet would run as a formula with
+// a quote, so that opening an export shows a note such as =HYPERLINK(...) as
+// it was typed instead of evaluating it.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+type csvExport struct {
+	w *csv.Writer
+}
+
+// newCSVExport starts the file with a byte order mark, without which Excel
+// reads UTF-8 as the system code page and garbles Thai notes.
+func newCSVExport(w io.Writer) (rowWriter, error) {
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return nil, err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportHeader); err != nil {
+		return nil, err
+	}
+
+	return csvExport{cw}, nil
+}
+
+func (e csvExport) Write(tx transaction.Transaction) error {
+	return e.w.Write(exportRecord(tx))
+}
+
+func (e csvExport) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type xlsxExport struct {
+	w *xlsxWriter
+}
+
+func newXLSXExport(w io.Writer) (rowWriter, error) {
+	xw, err := newXLSXWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	if err := xw.WriteRow(exportHeader, nil); err != nil {
+		return nil, err
+	}
+
+	return xlsxExport{xw}, nil
+}
+
+func (e xlsxExport) Write(tx transaction.Transaction) error {
+	return e.w.WriteRow(exportRecord(tx), exportNumeric)
+}
+
+func (e xlsxExport) Close() error {
+	return e.w.Close()
+}
+
+// jsonlExport writes each transaction as the listing would, one per line.
+type jsonlExport struct {
+	enc *json.Encoder
+}
+
+func newJSONLExport(w io.Writer) (rowWriter, error) {
+	return jsonlExport{json.NewEncoder(w)}, nil
+}
+
+func (e jsonlExport) Write(tx transaction.Transaction) error {
+	return e.enc.Encode(tx)
+}
+
+func (jsonlExport) Close() error {
+	return nil
+}
@@ -0,0 +1,208 @@
+package spender
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportTransactions(t *testing.T) {
+	cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+	exportRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(cols).
+			AddRow(2, "2024-05-02", 200.5, "food", "expense", `ข้าว, "มันไก่"`, "", 1, "THB", 200.5, "THB", 1, "FIT-2").
+			AddRow(1, "2024-05-01", 10, "salary", "income", "", "", 1, "USD", nil, "THB", 1, "")
+	}
+	spenderOnly := exportTxStmt + " WHERE deleted_at IS NULL AND spender_id = $1 ORDER BY date DESC, id DESC"
+
+	newContext := func(query string, p auth.Principal) (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/spenders/:id/transactions/export")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, p)
+		return c, rec
+	}
+	owner := auth.Principal{SpenderID: 1, Role: auth.RoleSpender}
+
+	t.Run("given no format should stream csv with the listing filters applied", func(t *testing.T) {
+		c, rec := newContext("category=food,travel&type=expense&date_from=2024-05-01&sort=amount&order=asc&spender_id=9", owner)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		query := exportTxStmt + " WHERE deleted_at IS NULL AND date >= $1 AND category = ANY($2) AND transaction_type = $3 AND spender_id = $4 ORDER BY amount ASC, id ASC"
+		mock.ExpectQuery(query).
+			WithArgs(sqlmock.AnyArg(), pq.Array([]string{"food", "travel"}), "expense", 1).
+			WillReturnRows(exportRows())
+
+		err := New(config.FeatureFlag{}, db).ExportTransactions(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, `attachment; filename="spender-1-transactions.csv"`, rec.Header().Get(echo.HeaderContentDisposition))
+		assert.Equal(t, "\ufeff"+
+			"id,date,amount,currency,converted_amount,home_currency,category,transaction_type,note,external_ref,image_url\n"+
+			`2,2024-05-02,200.50,THB,200.50,THB,food,expense,"ข้าว, ""มันไก่""",FIT-2,`+"\n"+
+			"1,2024-05-01,10.00,USD,,,salary,income,,,\n", rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given format jsonl should write one transaction per line", func(t *testing.T) {
+		c, rec := newContext("format=jsonl", owner)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(spenderOnly).WithArgs(1).WillReturnRows(exportRows())
+
+		err := New(config.FeatureFlag{}, db).ExportTransactions(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "application/x-ndjson", rec.Header().Get(echo.HeaderContentType))
+		lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+		assert.Len(t, lines, 2)
+		assert.JSONEq(t, `{"id":2,"date":"2024-05-02","amount":200.50,"category":"food","transaction_type":"expense","note":"ข้าว, \"มันไก่\"","image_url":"","spender_id":1,"currency":"THB","external_ref":"FIT-2","converted_amount":200.50,"converted_currency":"THB"}`, lines[0])
+		assert.JSONEq(t, `{"id":1,"date":"2024-05-01","amount":10,"category":"salary","transaction_type":"income","note":"","image_url":"","spender_id":1,"currency":"USD"}`, lines[1])
+	})
+
+	t.Run("given format xlsx should write a workbook with one sheet", func(t *testing.T) {
+		c, rec := newContext("format=xlsx", owner)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(spenderOnly).WithArgs(1).WillReturnRows(exportRows())
+
+		err := New(config.FeatureFlag{}, db).ExportTransactions(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", rec.Header().Get(echo.HeaderContentType))
+
+		body := rec.Body.Bytes()
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		assert.NoError(t, err)
+
+		parts := map[string]string{}
+		for _, f := range zr.File {
+			r, err := f.Open()
+			assert.NoError(t, err)
+			b, _ := io.ReadAll(r)
+			r.Close()
+			parts[f.Name] = string(b)
+		}
+		assert.Contains(t, parts, "[Content_Types].xml")
+		assert.Contains(t, parts, "xl/workbook.xml")
+
+		sheet := parts["xl/worksheets/sheet1.xml"]
+		assert.Contains(t, sheet, `<row r="1"><c t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`)
+		assert.Contains(t, sheet, `<row r="2"><c t="n"><v>2</v></c><c t="inlineStr"><is><t xml:space="preserve">2024-05-02</t></is></c><c t="n"><v>200.50</v></c>`)
+		assert.Contains(t, sheet, `ข้าว, &#34;มันไก่&#34;`)
+		assert.Contains(t, sheet, `<c t="n"><v>10.00</v></c><c t="inlineStr"><is><t xml:space="preserve">USD</t></is></c><c/><c/>`)
+		assert.True(t, strings.HasSuffix(sheet, `</sheetData></worksheet>`))
+	})
+
+	t.Run("given text that looks like a formula should quote it in csv and xlsx only", func(t *testing.T) {
+		formulaRows := func() *sqlmock.Rows {
+			return sqlmock.NewRows(cols).
+				AddRow(3, "2024-05-03", 50, "@SUM(A1)", "expense", `=HYPERLINK("http://x","y")`, "", 1, "THB", 50, "THB", 1, "+66")
+		}
+		for format, want := range map[string]string{
+			"csv":   `3,2024-05-03,50.00,THB,50.00,THB,'@SUM(A1),expense,"'=HYPERLINK(""http://x"",""y"")",'+66,`,
+			"xlsx":  `<t xml:space="preserve">&#39;=HYPERLINK(&#34;http://x&#34;,&#34;y&#34;)</t>`,
+			"jsonl": `"note":"=HYPERLINK(\"http://x\",\"y\")"`,
+		} {
+			c, rec := newContext("format="+format, owner)
+			db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			defer db.Close()
+
+			mock.ExpectQuery(spenderOnly).WithArgs(1).WillReturnRows(formulaRows())
+
+			err := New(config.FeatureFlag{}, db).ExportTransactions(c)
+
+			assert.NoError(t, err)
+			body := rec.Body.String()
+			if format == ExportXLSX {
+				b := rec.Body.Bytes()
+				zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+				assert.NoError(t, err)
+				for _, f := range zr.File {
+					if f.Name == "xl/worksheets/sheet1.xml" {
+						r, _ := f.Open()
+						sheet, _ := io.ReadAll(r)
+						r.Close()
+						body = string(sheet)
+					}
+				}
+			}
+			assert.Contains(t, body, want, format)
+		}
+	})
+
+	t.Run("given unknown format should return bad request", func(t *testing.T) {
+		c, rec := newContext("format=pdf", owner)
+
+		err := New(config.FeatureFlag{}, nil).ExportTransactions(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["the value of format must be one of csv xlsx jsonl"]}`, rec.Body.String())
+	})
+
+	t.Run("given invalid filter should return bad request", func(t *testing.T) {
+		c, rec := newContext("type=transfer", owner)
+
+		err := New(config.FeatureFlag{}, nil).ExportTransactions(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("given another spender's id should return forbidden", func(t *testing.T) {
+		c, rec := newContext("", auth.Principal{SpenderID: 2, Role: auth.RoleSpender})
+
+		err := New(config.FeatureFlag{}, nil).ExportTransactions(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("given query error should return internal server error", func(t *testing.T) {
+		c, rec := newContext("", owner)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(spenderOnly).WithArgs(1).WillReturnError(errors.New("query error"))
+
+		err := New(config.FeatureFlag{}, db).ExportTransactions(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	})
+
+	t.Run("given error while streaming should abort the response", func(t *testing.T) {
+		c, _ := newContext("format=xlsx", owner)
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(spenderOnly).WithArgs(1).
+			WillReturnRows(exportRows().RowError(1, errors.New("connection reset")))
+
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			New(config.FeatureFlag{}, db).ExportTransactions(c)
+		})
+	})
+}
@@ -4,11 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"math"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/exchange"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/transaction"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
 
@@ -19,15 +23,27 @@ import (
 )
 
 type Spender struct {
-	ID    int64  `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID       int64  `json:"id"`
+	Name     string `json:"name" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password,omitempty"`
+
+	// HomeCurrency is what the summary converts amounts into. It defaults
+	// to THB on create and is kept as it is when an update leaves it out.
+	HomeCurrency string `json:"home_currency" validate:"omitempty,iso4217"`
+
+	// Version increases on every write and is exposed as the ETag header.
+	Version int `json:"-"`
 }
 
+// Summary totals are in the spender's home currency, named by Currency.
+// Unconverted counts transactions left out for lack of an exchange rate.
 type Summary struct {
-	TotalIncome    float64 `json:"total_income"`
-	TotalExpenses  float64 `json:"total_expenses"`
-	CurrentBalance float64 `json:"current_balance"`
+	TotalIncome    money.Money `json:"total_income"`
+	TotalExpenses  money.Money `json:"total_expenses"`
+	CurrentBalance money.Money `json:"current_balance"`
+	Currency       string      `json:"currency,omitempty"`
+	Unconverted    int         `json:"unconverted_count,omitempty"`
 }
 
 type TransactionResponse struct {
@@ -36,6 +52,16 @@ type TransactionResponse struct {
 	Pagination   utils.Pagination          `json:"pagination"`
 }
 
+// CursorTransactionResponse is returned by the keyset-paged listing. Summary
+// is only computed when include_total=true is requested.
+type CursorTransactionResponse struct {
+	Transactions []transaction.Transaction `json:"transactions"`
+	Summary      *Summary                  `json:"summary,omitempty"`
+	Pagination   utils.CursorPagination    `json:"pagination"`
+}
+
+var ErrSpenderNotFound = errors.New("spender not found")
+
 type handler struct {
 	flag config.FeatureFlag
 	db   *sql.DB
@@ -46,10 +72,20 @@ func New(cfg config.FeatureFlag, db *sql.DB) *handler {
 }
 
 const (
-	cStmt       = `INSERT INTO spender (name, email) VALUES ($1, $2) RETURNING id;`
-	getTxStmt   = `SELECT id, date, amount, category, transaction_type, note, image_url FROM transaction WHERE spender_id = $1 LIMIT $2 OFFSET $3`
-	countTxStmt = `SELECT COUNT(*) FROM transaction WHERE spender_id = $1`
-	sumStmt     = `SELECT SUM(amount) AS total, transaction_type FROM "transaction" WHERE spender_id = $1 GROUP BY transaction_type`
+	cStmt       = `INSERT INTO spender (name, email, password_hash, home_currency) VALUES ($1, $2, $3, $4) RETURNING id;`
+	versionStmt = `SELECT version FROM spender WHERE id = $1`
+	updateStmt  = `UPDATE spender SET name = $1, email = $2, home_currency = COALESCE(NULLIF($3, ''), home_currency), version = version + 1 WHERE id = $4 AND version = $5 RETURNING id, name, email, home_currency, version`
+	getTxStmt   = `SELECT ` + transaction.Columns + ` FROM transaction t` + transaction.Join + ` WHERE spender_id = $1 AND deleted_at IS NULL ORDER BY date DESC, id DESC LIMIT $2 OFFSET $3`
+	countTxStmt = `SELECT COUNT(*) FROM transaction WHERE spender_id = $1 AND deleted_at IS NULL`
+
+	// sumStmt totals a spender's transactions in their home currency.
+	// Transactions without a rate on their date are left out of the totals
+	// and counted instead.
+	sumStmt = `WITH converted AS (SELECT t.transaction_type, s.home_currency, ROUND(t.amount * ` + exchange.RateSQL + `, 2) AS amount FROM transaction t JOIN spender s ON s.id = t.spender_id WHERE t.spender_id = $1 AND t.deleted_at IS NULL) SELECT SUM(amount) AS total, COUNT(*) - COUNT(amount) AS unconverted, transaction_type, home_currency FROM converted GROUP BY transaction_type, home_currency`
+
+	firstTxStmt  = `SELECT ` + transaction.Columns + ` FROM transaction t` + transaction.Join + ` WHERE spender_id = $1 AND deleted_at IS NULL ORDER BY date DESC, id DESC LIMIT $2`
+	afterTxStmt  = `SELECT ` + transaction.Columns + ` FROM transaction t` + transaction.Join + ` WHERE spender_id = $1 AND deleted_at IS NULL AND (date, id) < ($2, $3) ORDER BY date DESC, id DESC LIMIT $4`
+	beforeTxStmt = `SELECT ` + transaction.Columns + ` FROM transaction t` + transaction.Join + ` WHERE spender_id = $1 AND deleted_at IS NULL AND (date, id) > ($2, $3) ORDER BY date ASC, id ASC LIMIT $4`
 )
 
 func (h handler) Create(c echo.Context) error {
@@ -66,8 +102,24 @@ func (h handler) Create(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
 
+	if sp.Password == "" {
+		logger.Error("password is required")
+		return c.JSON(http.StatusBadRequest, "password is required")
+	}
+
+	if sp.HomeCurrency, err = exchange.NormalizeCurrency(sp.HomeCurrency); err != nil {
+		logger.Error("home currency is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+
+	hash, err := auth.HashPassword(sp.Password)
+	if err != nil {
+		logger.Error("hash password error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+
 	var lastInsertId int64
-	err = h.db.QueryRowContext(ctx, cStmt, sp.Name, sp.Email).Scan(&lastInsertId)
+	err = h.db.QueryRowContext(ctx, cStmt, sp.Name, sp.Email, hash, sp.HomeCurrency).Scan(&lastInsertId)
 	if err != nil {
 		logger.Error("query row error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
@@ -75,6 +127,7 @@ func (h handler) Create(c echo.Context) error {
 
 	logger.Info("create successfully", zap.Int64("id", lastInsertId))
 	sp.ID = lastInsertId
+	sp.Password = ""
 	return c.JSON(http.StatusCreated, sp)
 }
 
@@ -82,7 +135,7 @@ func (h handler) GetAll(c echo.Context) error {
 	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	rows, err := h.db.QueryContext(ctx, `SELECT id, name, email FROM spender`)
+	rows, err := h.db.QueryContext(ctx, `SELECT id, name, email, home_currency FROM spender`)
 	if err != nil {
 		logger.Error("query error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
@@ -92,7 +145,7 @@ func (h handler) GetAll(c echo.Context) error {
 	var sps []Spender
 	for rows.Next() {
 		var sp Spender
-		err := rows.Scan(&sp.ID, &sp.Name, &sp.Email)
+		err := rows.Scan(&sp.ID, &sp.Name, &sp.Email, &sp.HomeCurrency)
 		if err != nil {
 			logger.Error("scan error", zap.Error(err))
 			return c.JSON(http.StatusInternalServerError, err.Error())
@@ -107,29 +160,102 @@ func (h handler) GetByID(c echo.Context) error {
 	ctx := c.Request().Context()
 	logger := mlog.L(c)
 
-	id := c.Param("id")
-	rows, err := h.db.QueryContext(ctx, `SELECT id, name, email FROM spender WHERE id = $1`, id)
+	id, status, err := resolveSpenderID(c)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			logger.Warn("spender not found", zap.String("id", id))
-			return c.JSON(http.StatusNotFound, "spender not found")
-		}
+		logger.Error("resolve spender ID failed", zap.Error(err))
+		return c.JSON(status, errs.ParseError(err))
+	}
 
+	sp := Spender{}
+	err = h.db.QueryRowContext(ctx, `SELECT id, name, email, home_currency, version FROM spender WHERE id = $1`, id).
+		Scan(&sp.ID, &sp.Name, &sp.Email, &sp.HomeCurrency, &sp.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("spender not found", zap.Int("id", id))
+		return c.JSON(http.StatusNotFound, "spender not found")
+	}
+	if err != nil {
 		logger.Error("query error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
-	defer rows.Close()
-	sp := Spender{}
-	for rows.Next() {
-		if err := rows.Scan(&sp.ID, &sp.Name, &sp.Email); err != nil {
-			logger.Error("scan error", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, err.Error())
-		}
+
+	return respondSpender(c, sp)
+}
+
+// respondSpender writes sp with its version as the ETag, or 304 Not Modified
+// when If-None-Match shows the client already holds it.
+func respondSpender(c echo.Context, sp Spender) error {
+	etag := utils.ETag(sp.Version)
+	c.Response().Header().Set(utils.HeaderETag, etag)
+	if utils.IfNoneMatch(c, etag) {
+		return c.NoContent(http.StatusNotModified)
 	}
 
 	return c.JSON(http.StatusOK, sp)
 }
 
+// Update replaces a spender's name and email, and their home currency when
+// one is given. An If-Match header naming a version other than the current
+// one fails with 412 Precondition Failed.
+func (h handler) Update(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, status, err := resolveSpenderID(c)
+	if err != nil {
+		logger.Error("resolve spender ID failed", zap.Error(err))
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	var sp Spender
+	if err := c.Bind(&sp); err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	sp.HomeCurrency = strings.ToUpper(sp.HomeCurrency)
+	if err := c.Validate(sp); err != nil {
+		logger.Error("validate request body failed", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	expected, err := utils.IfMatchVersions(c)
+	if err != nil {
+		logger.Warn("If-Match header cannot match", zap.Error(err))
+		return c.JSON(http.StatusPreconditionFailed, errs.ParseError(err))
+	}
+
+	var current int
+	err = h.db.QueryRowContext(ctx, versionStmt, id).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("spender not found", zap.Int("id", id))
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrSpenderNotFound))
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	if expected != nil && !slices.Contains(expected, current) {
+		logger.Warn("spender version does not match", zap.Int("id", id), zap.Ints("expected", expected), zap.Int("current", current))
+		return c.JSON(http.StatusPreconditionFailed, errs.ParseError(utils.ErrPreconditionFailed))
+	}
+
+	var updated Spender
+	err = h.db.QueryRowContext(ctx, updateStmt, sp.Name, sp.Email, sp.HomeCurrency, id, current).Scan(&updated.ID, &updated.Name, &updated.Email, &updated.HomeCurrency, &updated.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("spender changed concurrently", zap.Int("id", id))
+		return c.JSON(http.StatusPreconditionFailed, errs.ParseError(utils.ErrPreconditionFailed))
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	logger.Info("update successfully", zap.Int("id", id))
+	c.Response().Header().Set(utils.HeaderETag, utils.ETag(updated.Version))
+	return c.JSON(http.StatusOK, updated)
+}
+
 // GetTransactionsSummary returns the summary of total income, total expense, and current balance
 // from the transaction table. The response is a map with the following keys:
 // - total_income: total income amount
@@ -138,11 +264,10 @@ func (h handler) GetByID(c echo.Context) error {
 func (h handler) GetTransactionsSummary(c echo.Context) error {
 	ctx := c.Request().Context()
 	logger := mlog.L(c)
-	idParam := c.Param("id")
-	id, err := strconv.Atoi(idParam)
+	id, status, err := resolveSpenderID(c)
 	if err != nil {
-		logger.Error("ID parameter is invalid", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+		logger.Error("resolve spender ID failed", zap.Error(err))
+		return c.JSON(status, errs.ParseError(err))
 	}
 
 	summary, err := h.getSummaryBySpenderID(ctx, uint(id))
@@ -156,6 +281,32 @@ func (h handler) GetTransactionsSummary(c echo.Context) error {
 	return c.JSON(http.StatusOK, res)
 }
 
+// resolveSpenderID returns the spender a request acts on along with the
+// status code to respond with when it cannot be used. The :id path parameter
+// is only honored when the principal's policy allows access to it.
+func resolveSpenderID(c echo.Context) (int, int, error) {
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return 0, http.StatusUnauthorized, errs.ErrUnauthorized
+	}
+
+	idParam := c.Param("id")
+	if idParam == "" {
+		return p.SpenderID, http.StatusOK, nil
+	}
+
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		return 0, http.StatusBadRequest, err
+	}
+
+	if !p.CanAccess(id) {
+		return 0, http.StatusForbidden, errs.ErrForbidden
+	}
+
+	return id, http.StatusOK, nil
+}
+
 func (h handler) getSummaryBySpenderID(ctx context.Context, ID uint) (*Summary, error) {
 	rows, err := h.db.QueryContext(ctx, sumStmt, ID)
 	if err != nil {
@@ -163,99 +314,86 @@ func (h handler) getSummaryBySpenderID(ctx context.Context, ID uint) (*Summary,
 	}
 	defer rows.Close()
 
-	totalIncome, totalExpense := 0.0, 0.0
+	var summary Summary
 	for rows.Next() {
-		var amount float64
+		var amount money.Money
+		var unconverted int
 		var transactionType string
-		if err := rows.Scan(&amount, &transactionType); err != nil {
+		if err := rows.Scan(&amount, &unconverted, &transactionType, &summary.Currency); err != nil {
 			return nil, err
 		}
 
 		if transactionType == "income" {
-			totalIncome += amount
+			summary.TotalIncome += amount
 		} else {
-			totalExpense += amount
+			summary.TotalExpenses += amount
 		}
+		summary.Unconverted += unconverted
 	}
 
-	return &Summary{
-		TotalIncome:    totalIncome,
-		TotalExpenses:  totalExpense,
-		CurrentBalance: totalIncome - totalExpense,
-	}, nil
+	summary.CurrentBalance = summary.TotalIncome - summary.TotalExpenses
+	return &summary, nil
 }
 
 func (h handler) GetSpenderByID(c echo.Context) error {
 	ctx := c.Request().Context()
 	logger := mlog.L(c)
-	id := c.Param("id")
-	rows, err := h.db.QueryContext(ctx, `SELECT id, "name", email FROM spender WHERE id = $1`, id)
+	id, status, err := resolveSpenderID(c)
 	if err != nil {
-		logger.Error("query error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		logger.Error("resolve spender ID failed", zap.Error(err))
+		return c.JSON(status, errs.ParseError(err))
 	}
-	defer rows.Close()
+
 	data := Spender{}
-	for rows.Next() {
-		if err := rows.Scan(&data.ID, &data.Name, &data.Email); err != nil {
-			logger.Error("scan error", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, err.Error())
-		}
+	err = h.db.QueryRowContext(ctx, `SELECT id, "name", email, home_currency, version FROM spender WHERE id = $1`, id).
+		Scan(&data.ID, &data.Name, &data.Email, &data.HomeCurrency, &data.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("spender not found", zap.Int("id", id))
+		return c.JSON(http.StatusNotFound, "spender not found")
 	}
-	return c.JSON(http.StatusOK, data)
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return respondSpender(c, data)
 }
 
 func (h handler) GetTransactionBySpenderID(c echo.Context) error {
 	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	page := 1
-	perPage := 10
-	var err error
-
-	pageQuery := c.QueryParam("page")
-	if pageQuery != "" {
-		page, err = strconv.Atoi(pageQuery)
-		if err != nil {
-			logger.Error("page query is invalid", zap.Error(err), zap.String("page query", pageQuery))
-			return c.JSON(http.StatusBadRequest, errs.ParseError(err))
-		}
+	page, perPage, err := utils.ParsePage(c)
+	if err != nil {
+		logger.Error("page query is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
 	}
 
-	perPageQuery := c.QueryParam("per_page")
-	if perPageQuery != "" {
-		perPage, err = strconv.Atoi(perPageQuery)
-		if err != nil {
-			logger.Error("per_page query is invalid", zap.Error(err))
-			return c.JSON(http.StatusBadRequest, errs.ParseError(err))
-		}
+	id, status, err := resolveSpenderID(c)
+	if err != nil {
+		logger.Error("resolve spender ID failed", zap.Error(err))
+		return c.JSON(status, errs.ParseError(err))
 	}
 
-	idParam := c.Param("id")
-	id, err := strconv.Atoi(idParam)
-	if err != nil {
-		logger.Error("ID parameter is invalid", zap.Error(err))
-		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	if c.QueryParams().Has("cursor") {
+		return h.getTransactionsByCursor(c, id, perPage)
 	}
 
 	offset := (page - 1) * perPage
-	transactions := make([]transaction.Transaction, 0)
 	rows, err := h.db.QueryContext(ctx, getTxStmt, id, perPage, offset)
 	if err != nil {
 		logger.Error("query error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 	defer rows.Close()
-	for rows.Next() {
-		var tx transaction.Transaction
 
-		err := rows.Scan(&tx.ID, &tx.Date, &tx.Amount, &tx.Category, &tx.TransactionType, &tx.Note, &tx.ImageURL, &tx.SpenderID)
-		if err != nil {
-			logger.Error("scan error", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
-		}
-
-		transactions = append(transactions, tx)
+	transactions, err := scanTransactions(rows)
+	if err != nil {
+		logger.Error("scan error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	if err := h.loadAttachments(c, transactions); err != nil {
+		logger.Error("query attachments error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
 	}
 
 	summary, err := h.getSummaryBySpenderID(ctx, uint(id))
@@ -271,15 +409,126 @@ func (h handler) GetTransactionBySpenderID(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
 	}
 
-	totalPages := math.Ceil(float64(totalRows) / float64(perPage))
-
 	return c.JSON(http.StatusOK, TransactionResponse{
 		Transactions: transactions,
 		Summary:      *summary,
-		Pagination: utils.Pagination{
-			CurrentPage: uint(page),
-			TotalPages:  uint(totalPages),
-			PerPage:     uint(perPage),
-		},
+		Pagination:   utils.NewPagination(page, perPage, totalRows),
 	})
 }
+
+// getTransactionsByCursor pages through a spender's transactions by
+// (date, id) instead of OFFSET, so rows arriving between requests neither
+// shift nor duplicate entries. An empty cursor query parameter starts from
+// the newest transaction.
+func (h handler) getTransactionsByCursor(c echo.Context, id, perPage int) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	var cur *utils.Cursor
+	if v := c.QueryParam("cursor"); v != "" {
+		decoded, err := utils.DecodeCursor(v)
+		if err != nil {
+			logger.Error("cursor query is invalid", zap.Error(err))
+			return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+		}
+		cur = &decoded
+	}
+	backward := cur != nil && cur.Backward
+
+	var rows *sql.Rows
+	var err error
+	switch {
+	case cur == nil:
+		rows, err = h.db.QueryContext(ctx, firstTxStmt, id, perPage+1)
+	case backward:
+		rows, err = h.db.QueryContext(ctx, beforeTxStmt, id, cur.Date, cur.ID, perPage+1)
+	default:
+		rows, err = h.db.QueryContext(ctx, afterTxStmt, id, cur.Date, cur.ID, perPage+1)
+	}
+	if err != nil {
+		logger.Error("query error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	defer rows.Close()
+
+	transactions, err := scanTransactions(rows)
+	if err != nil {
+		logger.Error("scan error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	hasMore := len(transactions) > perPage
+	if hasMore {
+		transactions = transactions[:perPage]
+	}
+	if backward {
+		for i, j := 0, len(transactions)-1; i < j; i, j = i+1, j-1 {
+			transactions[i], transactions[j] = transactions[j], transactions[i]
+		}
+	}
+
+	if err := h.loadAttachments(c, transactions); err != nil {
+		logger.Error("query attachments error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	pagination := utils.CursorPagination{PerPage: uint(perPage)}
+	if len(transactions) > 0 {
+		first, last := transactions[0], transactions[len(transactions)-1]
+		if hasMore || backward {
+			pagination.NextCursor = utils.EncodeCursor(utils.Cursor{Date: last.Date, ID: last.ID})
+		}
+		if (hasMore && backward) || (cur != nil && !backward) {
+			pagination.PrevCursor = utils.EncodeCursor(utils.Cursor{Date: first.Date, ID: first.ID, Backward: true})
+		}
+	}
+
+	res := CursorTransactionResponse{
+		Transactions: transactions,
+		Pagination:   pagination,
+	}
+
+	if c.QueryParam("include_total") == "true" {
+		summary, err := h.getSummaryBySpenderID(ctx, uint(id))
+		if err != nil {
+			logger.Error("get transaction summary error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+
+		var totalRows uint
+		if err := h.db.QueryRowContext(ctx, countTxStmt, id).Scan(&totalRows); err != nil {
+			logger.Error("count total rows error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+
+		res.Summary = summary
+		res.Pagination.TotalCount = &totalRows
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// loadAttachments fills in the attachments of transactions.
+func (h handler) loadAttachments(c echo.Context, transactions []transaction.Transaction) error {
+	txs := make([]*transaction.Transaction, len(transactions))
+	for i := range transactions {
+		txs[i] = &transactions[i]
+	}
+
+	return transaction.LoadAttachments(c, h.db, txs...)
+}
+
+func scanTransactions(rows *sql.Rows) ([]transaction.Transaction, error) {
+	transactions := make([]transaction.Transaction, 0)
+	for rows.Next() {
+		var tx transaction.Transaction
+		err := transaction.Scan(rows, &tx)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, tx)
+	}
+
+	return transactions, rows.Err()
+}
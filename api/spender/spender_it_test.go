@@ -11,6 +11,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
 	"github.com/KKGo-Software-engineering/workshop-summer/migration"
 	"github.com/labstack/echo/v4"
@@ -33,7 +34,7 @@ func TestCreateSpenderIT(t *testing.T) {
 
 		e.POST("/spenders", h.Create)
 
-		payload := `{"name": "HongJot", "email": "hong@jot.ok"}`
+		payload := `{"name": "HongJot", "email": "hong@jot.ok", "password": "secret"}`
 		req := httptest.NewRequest(http.MethodPost, "/spenders", strings.NewReader(payload))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
@@ -84,11 +85,16 @@ func TestGetSpenderByIDIT(t *testing.T) {
 		defer e.Close()
 
 		e.POST("/spenders", h.Create)
-		e.GET("/spenders/:id", h.GetByID)
+		e.GET("/spenders/:id", h.GetByID, func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				auth.SetPrincipal(c, auth.Principal{Role: auth.RoleAdmin})
+				return next(c)
+			}
+		})
 
 		var sp Spender
 		{
-			payload := `{"name": "HongJot", "email": "hong@jot.ok"}`
+			payload := `{"name": "HongJot", "email": "hong@jot.ok", "password": "secret"}`
 			req := httptest.NewRequest(http.MethodPost, "/spenders", strings.NewReader(payload))
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 			rec := httptest.NewRecorder()
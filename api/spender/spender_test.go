@@ -2,27 +2,40 @@ package spender
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
+	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
+const attachmentsStmt = "SELECT ts.transaction_id, s.key, s.content_type, s.size, s.thumbnail_jpeg, s.thumbnail_webp, ts.created_at FROM transaction_slip ts JOIN slip s ON s.id = ts.slip_id WHERE ts.transaction_id = ANY($1) ORDER BY ts.created_at, s.id;"
+
+// expectAttachments expects the attachments of the transactions ids to be
+// loaded, and finds none.
+func expectAttachments(mock sqlmock.Sqlmock, ids ...int64) {
+	mock.ExpectQuery(attachmentsStmt).WithArgs(pq.Array(ids)).
+		WillReturnRows(sqlmock.NewRows([]string{"transaction_id", "key", "content_type", "size", "attached_at"}))
+}
+
 func TestCreateSpender(t *testing.T) {
 
 	t.Run("create spender succesfully when feature toggle is enable", func(t *testing.T) {
 		e := echo.New()
 		defer e.Close()
 
-		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok"}`))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok", "password": "secret"}`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
@@ -31,7 +44,7 @@ func TestCreateSpender(t *testing.T) {
 		defer db.Close()
 
 		row := sqlmock.NewRows([]string{"id"}).AddRow(1)
-		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok").WillReturnRows(row)
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", sqlmock.AnyArg(), "THB").WillReturnRows(row)
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 
 		h := New(cfg, db)
@@ -39,14 +52,54 @@ func TestCreateSpender(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusCreated, rec.Code)
-		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok"}`, rec.Body.String())
+		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "home_currency": "THB"}`, rec.Body.String())
+	})
+
+	t.Run("given a home currency should create the spender with it", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok", "password": "secret", "home_currency": "usd"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", sqlmock.AnyArg(), "USD").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		h := New(config.FeatureFlag{EnableCreateSpender: true}, db)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"home_currency":"USD"`)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a home currency that is not ISO 4217 should not create the spender", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok", "password": "secret", "home_currency": "baht"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(config.FeatureFlag{EnableCreateSpender: true}, nil)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "ISO 4217")
 	})
 
 	t.Run("create spender failed when feature toggle is disable", func(t *testing.T) {
 		e := echo.New()
 		defer e.Close()
 
-		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok"}`))
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok", "password": "secret"}`))
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
@@ -78,7 +131,7 @@ func TestCreateSpender(t *testing.T) {
 		assert.Contains(t, rec.Body.String(), "invalid character")
 	})
 
-	t.Run("create spender failed on database (feature toggle is enable) ", func(t *testing.T) {
+	t.Run("create spender failed when password is missing", func(t *testing.T) {
 		e := echo.New()
 		defer e.Close()
 
@@ -86,11 +139,29 @@ func TestCreateSpender(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		cfg := config.FeatureFlag{EnableCreateSpender: true}
+
+		h := New(cfg, nil)
+		err := h.Create(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), "password is required")
+	})
+
+	t.Run("create spender failed on database (feature toggle is enable) ", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"name": "HongJot", "email": "hong@jot.ok", "password": "secret"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
 
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok").WillReturnError(assert.AnError)
+		mock.ExpectQuery(cStmt).WithArgs("HongJot", "hong@jot.ok", sqlmock.AnyArg(), "THB").WillReturnError(assert.AnError)
 		cfg := config.FeatureFlag{EnableCreateSpender: true}
 
 		h := New(cfg, db)
@@ -113,18 +184,18 @@ func TestGetAllSpender(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id", "name", "email"}).
-			AddRow(1, "HongJot", "hong@jot.ok").
-			AddRow(2, "JotHong", "jot@jot.ok")
-		mock.ExpectQuery(`SELECT id, name, email FROM spender`).WillReturnRows(rows)
+		rows := sqlmock.NewRows([]string{"id", "name", "email", "home_currency"}).
+			AddRow(1, "HongJot", "hong@jot.ok", "THB").
+			AddRow(2, "JotHong", "jot@jot.ok", "USD")
+		mock.ExpectQuery(`SELECT id, name, email, home_currency FROM spender`).WillReturnRows(rows)
 
 		h := New(config.FeatureFlag{}, db)
 		err := h.GetAll(c)
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.JSONEq(t, `[{"id": 1, "name": "HongJot", "email": "hong@jot.ok"},
-		{"id": 2, "name": "JotHong", "email": "jot@jot.ok"}]`, rec.Body.String())
+		assert.JSONEq(t, `[{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "home_currency": "THB"},
+		{"id": 2, "name": "JotHong", "email": "jot@jot.ok", "home_currency": "USD"}]`, rec.Body.String())
 	})
 
 	t.Run("get all spender failed on database", func(t *testing.T) {
@@ -138,7 +209,7 @@ func TestGetAllSpender(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		mock.ExpectQuery(`SELECT id, name, email FROM spender`).WillReturnError(assert.AnError)
+		mock.ExpectQuery(`SELECT id, name, email, home_currency FROM spender`).WillReturnError(assert.AnError)
 
 		h := New(config.FeatureFlag{}, db)
 		err := h.GetAll(c)
@@ -158,13 +229,14 @@ func TestGetTransactionSummary(t *testing.T) {
 		c := e.NewContext(req, rec)
 		params := utils.KeyValuePairs{"id": "1"}
 		utils.SetParams(c, params)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"total", "transaction_type"}).
-			AddRow(2000, "income").
-			AddRow(1000, "expense")
+		rows := sqlmock.NewRows([]string{"total", "unconverted", "transaction_type", "home_currency"}).
+			AddRow(2000, 0, "income", "THB").
+			AddRow(1000, 0, "expense", "THB")
 		mock.ExpectQuery(sumStmt).WithArgs(1).WillReturnRows(rows)
 
 		h := New(config.FeatureFlag{}, db)
@@ -172,7 +244,33 @@ func TestGetTransactionSummary(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.JSONEq(t, `{"summary": { "total_income": 2000, "total_expenses": 1000, "current_balance": 1000 }}`, rec.Body.String())
+		assert.JSONEq(t, `{"summary": { "total_income": 2000, "total_expenses": 1000, "current_balance": 1000, "currency": "THB" }}`, rec.Body.String())
+	})
+
+	t.Run("given transactions without exchange rate should count them as unconverted", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		rows := sqlmock.NewRows([]string{"total", "unconverted", "transaction_type", "home_currency"}).
+			AddRow("5000.00", 0, "income", "THB").
+			AddRow(nil, 2, "expense", "THB")
+		mock.ExpectQuery(sumStmt).WithArgs(1).WillReturnRows(rows)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetTransactionsSummary(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"summary": { "total_income": 5000, "total_expenses": 0, "current_balance": 5000, "currency": "THB", "unconverted_count": 2 }}`, rec.Body.String())
 	})
 }
 
@@ -186,22 +284,49 @@ func TestGetSpenderByID(t *testing.T) {
 		c := e.NewContext(req, rec)
 		c.SetParamNames("id")
 		c.SetParamValues("1")
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		assert.NoError(t, err)
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id", "name", "email"}).
-			AddRow(1, "HongJot", "hongjot@email.com")
+		rows := sqlmock.NewRows([]string{"id", "name", "email", "home_currency", "version"}).
+			AddRow(1, "HongJot", "hongjot@email.com", "THB", 1)
 
-		mock.ExpectQuery(`SELECT id, name, email FROM spender WHERE id = $1`).WithArgs("1").WillReturnRows(rows)
+		mock.ExpectQuery(`SELECT id, name, email, home_currency, version FROM spender WHERE id = $1`).WithArgs(1).WillReturnRows(rows)
 
 		h := New(config.FeatureFlag{}, db)
 		err = h.GetByID(c)
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hongjot@email.com"}`, rec.Body.String())
+		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hongjot@email.com", "home_currency": "THB"}`, rec.Body.String())
+		assert.Equal(t, `"1"`, rec.Header().Get(utils.HeaderETag))
+	})
+
+	t.Run("given matching If-None-Match should return not modified", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(utils.HeaderIfNoneMatch, `"3"`)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT id, "name", email, home_currency, version FROM spender WHERE id = $1`).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "home_currency", "version"}).AddRow(1, "HongJot", "hongjot@email.com", "THB", 3))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetSpenderByID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Empty(t, rec.Body.String())
 	})
 
 	t.Run("get spender by id not found", func(t *testing.T) {
@@ -213,12 +338,13 @@ func TestGetSpenderByID(t *testing.T) {
 		c := e.NewContext(req, rec)
 		c.SetParamNames("id")
 		c.SetParamValues("1")
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		assert.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectQuery(`SELECT id, name, email FROM spender WHERE id = $1`).WithArgs("1").WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(`SELECT id, name, email, home_currency, version FROM spender WHERE id = $1`).WithArgs(1).WillReturnError(sql.ErrNoRows)
 
 		h := New(config.FeatureFlag{}, db)
 		err = h.GetByID(c)
@@ -229,6 +355,37 @@ func TestGetSpenderByID(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, rec.Code)
 	})
 
+	for _, tt := range []struct {
+		name, query string
+		get         func(handler, echo.Context) error
+	}{
+		{"GetByID", `SELECT id, name, email, home_currency, version FROM spender WHERE id = $1`, handler.GetByID},
+		{"GetSpenderByID", `SELECT id, "name", email, home_currency, version FROM spender WHERE id = $1`, handler.GetSpenderByID},
+	} {
+		t.Run("given no spender row "+tt.name+" should return not found without an ETag", func(t *testing.T) {
+			e := echo.New()
+			defer e.Close()
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+			auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleAdmin})
+
+			db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+			defer db.Close()
+
+			mock.ExpectQuery(tt.query).WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "home_currency", "version"}))
+
+			err := tt.get(*New(config.FeatureFlag{}, db), c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+			assert.Empty(t, rec.Header().Get(utils.HeaderETag))
+		})
+	}
+
 	t.Run("get spender by id failed on database", func(t *testing.T) {
 		e := echo.New()
 		defer e.Close()
@@ -238,12 +395,13 @@ func TestGetSpenderByID(t *testing.T) {
 		c := e.NewContext(req, rec)
 		c.SetParamNames("id")
 		c.SetParamValues("1")
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		assert.NoError(t, err)
 		defer db.Close()
 
-		mock.ExpectQuery(`SELECT id, name, email FROM spender WHERE id = $1`).WithArgs("1").WillReturnError(assert.AnError)
+		mock.ExpectQuery(`SELECT id, name, email, home_currency, version FROM spender WHERE id = $1`).WithArgs(1).WillReturnError(assert.AnError)
 
 		h := New(config.FeatureFlag{}, db)
 		err = h.GetByID(c)
@@ -262,6 +420,7 @@ func TestGetTransactionBySpenderID(t *testing.T) {
 		c.SetPath("/spenders/:id/transactions/summary")
 		params := utils.KeyValuePairs{"id": "1"}
 		utils.SetParams(c, params)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
@@ -270,13 +429,14 @@ func TestGetTransactionBySpenderID(t *testing.T) {
 
 		mock.ExpectQuery(getTxStmt).
 			WithArgs(1, 5, 0).
-			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
-				AddRow(1, "2021-01-01", 100.0, "food", "expense", "", "", 1).
-				AddRow(2, "2021-01-02", 200.0, "saving", "income", "", "", 1))
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}).
+				AddRow(1, "2021-01-01", 100.0, "food", "expense", "", "", 1, "THB", 100.0, "THB", 1, "").
+				AddRow(2, "2021-01-02", 200.0, "saving", "income", "", "", 1, "THB", 200.0, "THB", 1, ""))
+		expectAttachments(mock, 1, 2)
 
 		mock.ExpectQuery(sumStmt).
 			WithArgs(1).
-			WillReturnRows(sqlmock.NewRows([]string{"total", "transaction_type"}).AddRow(200, "income").AddRow(100, "expense"))
+			WillReturnRows(sqlmock.NewRows([]string{"total", "unconverted", "transaction_type", "home_currency"}).AddRow(200, 0, "income", "THB").AddRow(100, 0, "expense", "THB"))
 
 		mock.ExpectQuery(countTxStmt).
 			WithArgs(1).
@@ -286,7 +446,7 @@ func TestGetTransactionBySpenderID(t *testing.T) {
 
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.JSONEq(t, rec.Body.String(), `{"transactions":[{"id":1,"date":"2021-01-01","amount":100,"category":"food","transaction_type":"expense","note":"","image_url":"","spender_id":1},{"id":2,"date":"2021-01-02","amount":200,"category":"saving","transaction_type":"income","note":"","image_url":"","spender_id":1}],"summary":{"total_income":200,"total_expenses":100,"current_balance":100},"pagination":{"current_page":1,"total_pages":1,"per_page":5}}`)
+		assert.JSONEq(t, rec.Body.String(), `{"transactions":[{"id":1,"date":"2021-01-01","amount":100,"category":"food","transaction_type":"expense","note":"","image_url":"","spender_id":1,"currency":"THB","converted_amount":100,"converted_currency":"THB"},{"id":2,"date":"2021-01-02","amount":200,"category":"saving","transaction_type":"income","note":"","image_url":"","spender_id":1,"currency":"THB","converted_amount":200,"converted_currency":"THB"}],"summary":{"total_income":200,"total_expenses":100,"current_balance":100,"currency":"THB"},"pagination":{"current_page":1,"total_pages":1,"per_page":5,"total_count":2}}`)
 	})
 
 	t.Run("given invalid page should return error", func(t *testing.T) {
@@ -297,6 +457,7 @@ func TestGetTransactionBySpenderID(t *testing.T) {
 		c.SetPath("/spenders/:id/transactions/summary")
 		params := utils.KeyValuePairs{"id": "1"}
 		utils.SetParams(c, params)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, _, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
@@ -318,6 +479,7 @@ func TestGetTransactionBySpenderID(t *testing.T) {
 		c.SetPath("/spenders/:id/transactions/summary")
 		params := utils.KeyValuePairs{"id": "1"}
 		utils.SetParams(c, params)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, _, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
@@ -331,4 +493,368 @@ func TestGetTransactionBySpenderID(t *testing.T) {
 		assert.JSONEq(t, `{"messages":["strconv.Atoi: parsing \"invalid-per-page\": invalid syntax"]}`, rec.Body.String())
 	})
 
+	t.Run("given another spender's id should return forbidden", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/spenders/:id/transactions")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "2"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		h := New(config.FeatureFlag{}, nil)
+
+		err := h.GetTransactionBySpenderID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.JSONEq(t, `{"messages":["forbidden"]}`, rec.Body.String())
+	})
+
+	t.Run("given admin should return transactions of any spender", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/?page=1&per_page=5", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/spenders/:id/transactions")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "2"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleAdmin})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		h := New(config.FeatureFlag{}, db)
+
+		mock.ExpectQuery(getTxStmt).
+			WithArgs(2, 5, 0).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}))
+		mock.ExpectQuery(sumStmt).
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"total", "unconverted", "transaction_type", "home_currency"}))
+		mock.ExpectQuery(countTxStmt).
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		err := h.GetTransactionBySpenderID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given no authenticated spender should return unauthorized", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/spenders/:id/transactions")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+
+		h := New(config.FeatureFlag{}, nil)
+
+		err := h.GetTransactionBySpenderID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+}
+
+func TestGetTransactionBySpenderIDWithCursor(t *testing.T) {
+	cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+
+	newContext := func(query string) (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/spenders/:id/transactions")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		return c, rec
+	}
+
+	t.Run("given empty cursor should return first page with next cursor only", func(t *testing.T) {
+		c, rec := newContext("cursor=&per_page=2")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(firstTxStmt).WithArgs(1, 3).
+			WillReturnRows(sqlmock.NewRows(cols).
+				AddRow(3, "2024-05-03", 30.0, "food", "expense", "", "", 1, "THB", 30.0, "THB", 1, "").
+				AddRow(2, "2024-05-02", 20.0, "food", "expense", "", "", 1, "THB", 20.0, "THB", 1, "").
+				AddRow(1, "2024-05-01", 10.0, "food", "expense", "", "", 1, "THB", 10.0, "THB", 1, ""))
+		expectAttachments(mock, 3, 2)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetTransactionBySpenderID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var res CursorTransactionResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Len(t, res.Transactions, 2)
+		assert.Nil(t, res.Summary)
+		assert.Empty(t, res.Pagination.PrevCursor)
+		assert.Nil(t, res.Pagination.TotalCount)
+
+		next, err := utils.DecodeCursor(res.Pagination.NextCursor)
+		assert.NoError(t, err)
+		assert.Equal(t, utils.Cursor{Date: "2024-05-02", ID: 2}, next)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given next cursor should return following page with prev cursor", func(t *testing.T) {
+		cursor := utils.EncodeCursor(utils.Cursor{Date: "2024-05-02", ID: 2})
+		c, rec := newContext("per_page=2&cursor=" + cursor)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(afterTxStmt).WithArgs(1, "2024-05-02", 2, 3).
+			WillReturnRows(sqlmock.NewRows(cols).
+				AddRow(1, "2024-05-01", 10.0, "food", "expense", "", "", 1, "THB", 10.0, "THB", 1, ""))
+		expectAttachments(mock, 1)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetTransactionBySpenderID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var res CursorTransactionResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Len(t, res.Transactions, 1)
+		assert.Empty(t, res.Pagination.NextCursor)
+
+		prev, err := utils.DecodeCursor(res.Pagination.PrevCursor)
+		assert.NoError(t, err)
+		assert.Equal(t, utils.Cursor{Date: "2024-05-01", ID: 1, Backward: true}, prev)
+	})
+
+	t.Run("given prev cursor should return previous page in listing order", func(t *testing.T) {
+		cursor := utils.EncodeCursor(utils.Cursor{Date: "2024-05-01", ID: 1, Backward: true})
+		c, rec := newContext("per_page=1&cursor=" + cursor)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(beforeTxStmt).WithArgs(1, "2024-05-01", 1, 2).
+			WillReturnRows(sqlmock.NewRows(cols).
+				AddRow(2, "2024-05-02", 20.0, "food", "expense", "", "", 1, "THB", 20.0, "THB", 1, "").
+				AddRow(3, "2024-05-03", 30.0, "food", "expense", "", "", 1, "THB", 30.0, "THB", 1, ""))
+		expectAttachments(mock, 2)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetTransactionBySpenderID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var res CursorTransactionResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+		assert.Len(t, res.Transactions, 1)
+		assert.Equal(t, uint(2), res.Transactions[0].ID)
+		assert.NotEmpty(t, res.Pagination.NextCursor)
+		assert.NotEmpty(t, res.Pagination.PrevCursor)
+	})
+
+	t.Run("given include_total should return summary and total count", func(t *testing.T) {
+		c, rec := newContext("cursor=&per_page=2&include_total=true")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(firstTxStmt).WithArgs(1, 3).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-01", 10.0, "food", "expense", "", "", 1, "THB", 10.0, "THB", 1, ""))
+		expectAttachments(mock, 1)
+		mock.ExpectQuery(sumStmt).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"total", "unconverted", "transaction_type", "home_currency"}).AddRow(10, 0, "expense", "THB"))
+		mock.ExpectQuery(countTxStmt).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.GetTransactionBySpenderID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"transactions":[{"id":1,"date":"2024-05-01","amount":10,"category":"food","transaction_type":"expense","note":"","image_url":"","spender_id":1,"currency":"THB","converted_amount":10,"converted_currency":"THB"}],"summary":{"total_income":0,"total_expenses":10,"current_balance":-10,"currency":"THB"},"pagination":{"per_page":2,"total_count":1}}`, rec.Body.String())
+	})
+
+	t.Run("given malformed cursor should return error", func(t *testing.T) {
+		c, rec := newContext("cursor=not-a-cursor")
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.GetTransactionBySpenderID(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["cursor is invalid"]}`, rec.Body.String())
+	})
+}
+
+func TestUpdateSpender(t *testing.T) {
+	newContextWith := func(e *echo.Echo, ifMatch, body string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if ifMatch != "" {
+			req.Header.Set(utils.HeaderIfMatch, ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		return c, rec
+	}
+	newContext := func(e *echo.Echo, ifMatch string) (echo.Context, *httptest.ResponseRecorder) {
+		return newContextWith(e, ifMatch, `{"name": "HongJot", "email": "hong@jot.ok"}`)
+	}
+
+	t.Run("given current If-Match should update and return next etag", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, `"2"`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(versionStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectQuery(updateStmt).WithArgs("HongJot", "hong@jot.ok", "", 1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "home_currency", "version"}).AddRow(1, "HongJot", "hong@jot.ok", "THB", 3))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"3"`, rec.Header().Get(utils.HeaderETag))
+		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "home_currency": "THB"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given If-Match listing the current version among others should update", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, `"1", "2"`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(versionStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectQuery(updateStmt).WithArgs("HongJot", "hong@jot.ok", "", 1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "home_currency", "version"}).AddRow(1, "HongJot", "hong@jot.ok", "THB", 3))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a home currency should update it", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContextWith(e, "", `{"name": "HongJot", "email": "hong@jot.ok", "home_currency": "usd"}`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(versionStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectQuery(updateStmt).WithArgs("HongJot", "hong@jot.ok", "USD", 1, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "home_currency", "version"}).AddRow(1, "HongJot", "hong@jot.ok", "USD", 3))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 1, "name": "HongJot", "email": "hong@jot.ok", "home_currency": "USD"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given a home currency that is not ISO 4217 should return bad request", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContextWith(e, "", `{"name": "HongJot", "email": "hong@jot.ok", "home_currency": "baht"}`)
+
+		h := New(config.FeatureFlag{}, nil)
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["the value of HomeCurrency must be an ISO 4217 currency code"]}`, rec.Body.String())
+	})
+
+	t.Run("given stale If-Match should return precondition failed", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, `"1"`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(versionStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.JSONEq(t, `{"messages":["resource was modified, fetch it again and retry"]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given concurrent write between check and update should return precondition failed", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, "")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(versionStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(2))
+		mock.ExpectQuery(updateStmt).WithArgs("HongJot", "hong@jot.ok", "", 1, 2).WillReturnError(sql.ErrNoRows)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given unknown spender should return not found", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, "")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(versionStmt).WithArgs(1).WillReturnError(sql.ErrNoRows)
+
+		h := New(config.FeatureFlag{}, db)
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"messages":["spender not found"]}`, rec.Body.String())
+	})
 }
@@ -0,0 +1,83 @@
+package transaction
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// RouteSlip names the route that serves a stored slip. Attachment locations
+// reverse it.
+const RouteSlip = "eslip.get"
+
+// attachmentsStmt selects the slips attached to a set of transactions, in the
+// order they were attached.
+const attachmentsStmt = "SELECT ts.transaction_id, s.key, s.content_type, s.size, s.thumbnail_jpeg, s.thumbnail_webp, ts.created_at" +
+	" FROM transaction_slip ts JOIN slip s ON s.id = ts.slip_id" +
+	" WHERE ts.transaction_id = ANY($1) ORDER BY ts.created_at, s.id;"
+
+// Attachment is a slip attached to a transaction. Location downloads it, and
+// Thumbnails download small previews of it when it is an image.
+type Attachment struct {
+	Key         string      `json:"key"`
+	Location    string      `json:"location"`
+	ContentType string      `json:"content_type"`
+	Size        int64       `json:"size"`
+	Thumbnails  *Thumbnails `json:"thumbnails,omitempty"`
+	AttachedAt  time.Time   `json:"attached_at"`
+}
+
+// Thumbnails locate the previews of a slip, fit into a small square, in JPEG
+// and in lossless WebP.
+type Thumbnails struct {
+	JPEG string `json:"jpeg"`
+	WebP string `json:"webp"`
+}
+
+// LoadAttachments fills in the attachments of txs, and the thumbnail URL of
+// each from the first of them that has thumbnails.
+func LoadAttachments(c echo.Context, db *sql.DB, txs ...*Transaction) error {
+	if len(txs) == 0 {
+		return nil
+	}
+
+	byID := make(map[uint]*Transaction, len(txs))
+	ids := make([]int64, 0, len(txs))
+	for _, tx := range txs {
+		byID[tx.ID] = tx
+		ids = append(ids, int64(tx.ID))
+	}
+
+	rows, err := db.QueryContext(c.Request().Context(), attachmentsStmt, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint
+		var a Attachment
+		var thumbJPEG, thumbWebP sql.NullString
+		if err := rows.Scan(&id, &a.Key, &a.ContentType, &a.Size, &thumbJPEG, &thumbWebP, &a.AttachedAt); err != nil {
+			return err
+		}
+
+		a.Location = c.Echo().Reverse(RouteSlip, a.Key)
+		if thumbJPEG.Valid && thumbWebP.Valid {
+			a.Thumbnails = &Thumbnails{
+				JPEG: c.Echo().Reverse(RouteSlip, thumbJPEG.String),
+				WebP: c.Echo().Reverse(RouteSlip, thumbWebP.String),
+			}
+		}
+		if tx, ok := byID[id]; ok {
+			tx.Attachments = append(tx.Attachments, a)
+			if tx.ThumbnailURL == "" && a.Thumbnails != nil {
+				tx.ThumbnailURL = a.Thumbnails.JPEG
+			}
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,202 @@
+package transaction
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/exchange"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// MaxBatchSize caps how many transactions one batch request may create.
+const MaxBatchSize = 1000
+
+var (
+	ErrEmptyBatch   = errors.New("batch must contain at least one transaction")
+	ErrBatchTooBig  = fmt.Errorf("batch must contain at most %d transactions", MaxBatchSize)
+	ErrBatchAborted = errors.New("not created because another transaction in the batch failed")
+)
+
+const (
+	savepointStmt         = "SAVEPOINT batch_item;"
+	rollbackSavepointStmt = "ROLLBACK TO SAVEPOINT batch_item;"
+	releaseSavepointStmt  = "RELEASE SAVEPOINT batch_item;"
+)
+
+// BatchResult reports what happened to the transaction at Index of a batch.
+type BatchResult struct {
+	Index       int                 `json:"index"`
+	Status      int                 `json:"status"`
+	Transaction *Transactions       `json:"transaction,omitempty"`
+	Error       *errs.ErrorResponse `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Created int           `json:"created"`
+	Failed  int           `json:"failed"`
+	Results []BatchResult `json:"results"`
+}
+
+func (r *BatchResponse) fail(i, status int, err error) {
+	resp := errs.ParseError(err)
+	r.Results[i] = BatchResult{Index: i, Status: status, Error: &resp}
+	r.Failed++
+}
+
+// CreateBatch creates every transaction in the request body. By default the
+// batch is atomic: one invalid or failing item leaves nothing created. With
+// ?atomic=false the valid items are created and the rest reported, each
+// insert guarded by a savepoint so a failure does not abort the others.
+func (h handler) CreateBatch(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	atomic := true
+	if v := c.QueryParam("atomic"); v != "" {
+		var err error
+		if atomic, err = strconv.ParseBool(v); err != nil {
+			logger.Error("atomic parameter is invalid", zap.Error(err))
+			return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+		}
+	}
+
+	var txs []Transactions
+	if err := c.Bind(&txs); err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+	if len(txs) == 0 {
+		return c.JSON(http.StatusBadRequest, errs.ParseError(ErrEmptyBatch))
+	}
+	if len(txs) > MaxBatchSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, errs.ParseError(ErrBatchTooBig))
+	}
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+	}
+
+	resp := BatchResponse{Results: make([]BatchResult, len(txs))}
+	valid := make([]bool, len(txs))
+	for i := range txs {
+		if err := prepare(c, p, &txs[i]); err != nil {
+			resp.fail(i, http.StatusBadRequest, err)
+			continue
+		}
+		valid[i] = true
+	}
+
+	if atomic && resp.Failed > 0 {
+		logger.Warn("batch rejected", zap.Int("invalid", resp.Failed))
+		abort(&resp, valid)
+		return c.JSON(http.StatusBadRequest, resp)
+	}
+
+	dbtx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		logger.Error("begin transaction error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	defer dbtx.Rollback()
+
+	for i := range txs {
+		if !valid[i] {
+			continue
+		}
+
+		created, err := insertBatchItem(ctx, dbtx, txs[i], !atomic)
+		if err != nil {
+			logger.Error("insert batch item error", zap.Int("index", i), zap.Error(err))
+			status := http.StatusInternalServerError
+			if IsDuplicateRef(err) {
+				status, err = http.StatusConflict, ErrDuplicateRef
+			}
+			resp.fail(i, status, err)
+			if atomic {
+				valid[i] = false
+				abort(&resp, valid)
+				return c.JSON(status, resp)
+			}
+			continue
+		}
+
+		resp.Results[i] = BatchResult{Index: i, Status: http.StatusCreated, Transaction: &created}
+		resp.Created++
+	}
+
+	if err := dbtx.Commit(); err != nil {
+		logger.Error("commit transaction error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	logger.Info("create batch successfully", zap.Int("created", resp.Created), zap.Int("failed", resp.Failed))
+	if resp.Failed > 0 {
+		return c.JSON(http.StatusMultiStatus, resp)
+	}
+	return c.JSON(http.StatusCreated, resp)
+}
+
+// prepare fills in the owner and currency of tx and validates it the same way
+// a single create would.
+func prepare(c echo.Context, p auth.Principal, tx *Transactions) error {
+	tx.SpenderID = p.OwnerFor(tx.SpenderID)
+	if tx.SpenderID == 0 {
+		return ErrSpenderRequired
+	}
+
+	if err := c.Validate(*tx); err != nil {
+		return err
+	}
+
+	var err error
+	tx.Currency, err = exchange.NormalizeCurrency(tx.Currency)
+	return err
+}
+
+// abort marks the valid items of an atomic batch as not created.
+func abort(resp *BatchResponse, valid []bool) {
+	for i, ok := range valid {
+		if !ok {
+			continue
+		}
+		if resp.Results[i].Transaction != nil {
+			resp.Created--
+		}
+		resp.fail(i, http.StatusFailedDependency, ErrBatchAborted)
+	}
+}
+
+func insertBatchItem(ctx context.Context, dbtx *sql.Tx, tx Transactions, savepoint bool) (Transactions, error) {
+	if savepoint {
+		if _, err := dbtx.ExecContext(ctx, savepointStmt); err != nil {
+			return Transactions{}, err
+		}
+	}
+
+	created, err := Insert(ctx, dbtx, Transaction(tx))
+	if err != nil {
+		if savepoint {
+			if _, rerr := dbtx.ExecContext(ctx, rollbackSavepointStmt); rerr != nil {
+				return Transactions{}, errors.Join(err, rerr)
+			}
+		}
+		return Transactions{}, err
+	}
+
+	if savepoint {
+		if _, err := dbtx.ExecContext(ctx, releaseSavepointStmt); err != nil {
+			return Transactions{}, err
+		}
+	}
+
+	return Transactions(created), nil
+}
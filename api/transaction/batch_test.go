@@ -0,0 +1,156 @@
+package transaction
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateBatch(t *testing.T) {
+	cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+
+	newContext := func(target, body string) (echo.Context, *httptest.ResponseRecorder) {
+		e := echo.New()
+		e.Validator = cv.New()
+
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		return c, rec
+	}
+
+	t.Run("given valid transactions should create all of them", func(t *testing.T) {
+		c, rec := newContext("/", `[
+			{"date": "2024-05-11 15:04:05", "category": "food", "amount": 30, "transaction_type": "expense"},
+			{"date": "2024-05-12 09:00:00", "category": "salary", "amount": 1000, "transaction_type": "income", "currency": "usd"}
+		]`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(insertTxStmt).WithArgs("2024-05-11 15:04:05", money.MustParse("30"), "food", "expense", "", "", 1, "THB", "").
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 1, "THB", 30, "THB", 1, ""))
+		mock.ExpectQuery(insertTxStmt).WithArgs("2024-05-12 09:00:00", money.MustParse("1000"), "salary", "income", "", "", 1, "USD", "").
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(2, "2024-05-12 09:00:00", 1000, "salary", "income", "", "", 1, "USD", nil, "THB", 1, ""))
+		mock.ExpectCommit()
+
+		h := New(db)
+		err := h.CreateBatch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"created": 2, "failed": 0, "results": [
+			{"index": 0, "status": 201, "transaction": {"id": 1, "date": "2024-05-11 15:04:05", "amount": 30, "category": "food", "transaction_type": "expense", "note": "", "image_url": "", "spender_id": 1, "currency": "THB", "converted_amount": 30, "converted_currency": "THB"}},
+			{"index": 1, "status": 201, "transaction": {"id": 2, "date": "2024-05-12 09:00:00", "amount": 1000, "category": "salary", "transaction_type": "income", "note": "", "image_url": "", "spender_id": 1, "currency": "USD"}}
+		]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given invalid item in atomic batch should create nothing", func(t *testing.T) {
+		c, rec := newContext("/", `[
+			{"date": "2024-05-11 15:04:05", "category": "food", "amount": 30, "transaction_type": "expense"},
+			{"date": "2024-05-11 15:04:05", "amount": -5, "transaction_type": "expense"}
+		]`)
+
+		h := New(nil)
+		err := h.CreateBatch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"created": 0, "failed": 2, "results": [
+			{"index": 0, "status": 424, "error": {"messages": ["not created because another transaction in the batch failed"]}},
+			{"index": 1, "status": 400, "error": {"messages": ["the value of Amount must be greater than 0", "field Category is required"]}}
+		]}`, rec.Body.String())
+	})
+
+	t.Run("given insert failure in atomic batch should roll back", func(t *testing.T) {
+		c, rec := newContext("/", `[
+			{"date": "2024-05-11 15:04:05", "category": "food", "amount": 30, "transaction_type": "expense"},
+			{"date": "2024-05-11 15:04:05", "category": "taxi", "amount": 10, "transaction_type": "expense"}
+		]`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(insertTxStmt).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 1, "THB", 30, "THB", 1, ""))
+		mock.ExpectQuery(insertTxStmt).WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		h := New(db)
+		err := h.CreateBatch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.JSONEq(t, `{"created": 0, "failed": 2, "results": [
+			{"index": 0, "status": 424, "error": {"messages": ["not created because another transaction in the batch failed"]}},
+			{"index": 1, "status": 500, "error": {"messages": ["`+assert.AnError.Error()+`"]}}
+		]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given best effort batch should create valid items and report the rest", func(t *testing.T) {
+		c, rec := newContext("/?atomic=false", `[
+			{"date": "2024-05-11 15:04:05", "category": "food", "amount": 30, "transaction_type": "expense"},
+			{"date": "2024-05-11 15:04:05", "category": "food", "amount": 30, "transaction_type": "gift"},
+			{"date": "2024-05-11 15:04:05", "category": "taxi", "amount": 10, "transaction_type": "expense"}
+		]`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(savepointStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(insertTxStmt).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 1, "THB", 30, "THB", 1, ""))
+		mock.ExpectExec(releaseSavepointStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(savepointStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(insertTxStmt).WillReturnError(assert.AnError)
+		mock.ExpectExec(rollbackSavepointStmt).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		h := New(db)
+		err := h.CreateBatch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusMultiStatus, rec.Code)
+		assert.JSONEq(t, `{"created": 1, "failed": 2, "results": [
+			{"index": 0, "status": 201, "transaction": {"id": 1, "date": "2024-05-11 15:04:05", "amount": 30, "category": "food", "transaction_type": "expense", "note": "", "image_url": "", "spender_id": 1, "currency": "THB", "converted_amount": 30, "converted_currency": "THB"}},
+			{"index": 1, "status": 400, "error": {"messages": ["the value of TransactionType must be one of income expense"]}},
+			{"index": 2, "status": 500, "error": {"messages": ["`+assert.AnError.Error()+`"]}}
+		]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given empty batch should return error", func(t *testing.T) {
+		c, rec := newContext("/", `[]`)
+
+		h := New(nil)
+		err := h.CreateBatch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("given invalid atomic flag should return error", func(t *testing.T) {
+		c, rec := newContext("/?atomic=maybe", `[{}]`)
+
+		h := New(nil)
+		err := h.CreateBatch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,200 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	ErrInvalidDate   = errors.New("date must be formatted as YYYY-MM-DD or RFC3339")
+	ErrInvalidAmount = errors.New("amount must be a number with at most 2 decimal places")
+	ErrInvalidType   = errors.New("the value of type must be one of income expense")
+	ErrInvalidSort   = errors.New("the value of sort must be one of date amount category id")
+	ErrInvalidOrder  = errors.New("the value of order must be one of asc desc")
+)
+
+// sortColumns whitelists the columns a listing can be sorted by so that the
+// sort query parameter never reaches SQL verbatim.
+var sortColumns = map[string]string{
+	"date":     "date",
+	"amount":   "amount",
+	"category": "category",
+	"id":       "id",
+}
+
+// Filter narrows a transaction listing. Zero values mean "no constraint".
+type Filter struct {
+	DateFrom   *time.Time
+	DateTo     *time.Time
+	AmountMin  *money.Money
+	AmountMax  *money.Money
+	Categories []string
+	Type       string
+	SpenderID  int
+	Note       string
+	Sort       string
+	Order      string
+}
+
+// ParseFilter reads a Filter from the query string. Supported parameters are
+// date_from, date_to, amount_min, amount_max, category (repeated or comma
+// separated), type, spender_id, note, sort and order.
+func ParseFilter(c echo.Context) (Filter, error) {
+	f := Filter{Sort: "date", Order: "desc"}
+
+	var err error
+	if f.DateFrom, err = parseDate(c.QueryParam("date_from"), false); err != nil {
+		return Filter{}, err
+	}
+	if f.DateTo, err = parseDate(c.QueryParam("date_to"), true); err != nil {
+		return Filter{}, err
+	}
+	if f.AmountMin, err = parseAmount(c.QueryParam("amount_min")); err != nil {
+		return Filter{}, err
+	}
+	if f.AmountMax, err = parseAmount(c.QueryParam("amount_max")); err != nil {
+		return Filter{}, err
+	}
+
+	for _, v := range c.QueryParams()["category"] {
+		for _, category := range strings.Split(v, ",") {
+			if category = strings.TrimSpace(category); category != "" {
+				f.Categories = append(f.Categories, category)
+			}
+		}
+	}
+
+	f.Type = c.QueryParam("type")
+	if f.Type != "" && f.Type != "income" && f.Type != "expense" {
+		return Filter{}, ErrInvalidType
+	}
+
+	if v := c.QueryParam("spender_id"); v != "" {
+		if f.SpenderID, err = strconv.Atoi(v); err != nil {
+			return Filter{}, err
+		}
+	}
+
+	f.Note = c.QueryParam("note")
+
+	if v := c.QueryParam("sort"); v != "" {
+		if _, ok := sortColumns[v]; !ok {
+			return Filter{}, ErrInvalidSort
+		}
+		f.Sort = v
+	}
+
+	if v := strings.ToLower(c.QueryParam("order")); v != "" {
+		if v != "asc" && v != "desc" {
+			return Filter{}, ErrInvalidOrder
+		}
+		f.Order = v
+	}
+
+	return f, nil
+}
+
+// parseDate accepts a calendar date or an RFC3339 timestamp. A calendar date
+// used as an upper bound covers the whole day.
+func parseDate(v string, upper bool) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+
+	t, err := time.Parse(dateLayout, v)
+	if err != nil {
+		return nil, ErrInvalidDate
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return &t, nil
+}
+
+func parseAmount(v string) (*money.Money, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	amount, err := money.Parse(v)
+	if err != nil {
+		return nil, ErrInvalidAmount
+	}
+
+	return &amount, nil
+}
+
+// Where renders the filter as a WHERE clause. Soft-deleted rows are always
+// excluded. Placeholders are numbered after the arguments already in args so
+// callers can prepend their own conditions.
+func (f Filter) Where(args []any) (string, []any) {
+	conds := []string{"deleted_at IS NULL"}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.DateFrom != nil {
+		add("date >= $%d", *f.DateFrom)
+	}
+	if f.DateTo != nil {
+		add("date <= $%d", *f.DateTo)
+	}
+	if f.AmountMin != nil {
+		add("amount >= $%d", *f.AmountMin)
+	}
+	if f.AmountMax != nil {
+		add("amount <= $%d", *f.AmountMax)
+	}
+	if len(f.Categories) > 0 {
+		add("category = ANY($%d)", pq.Array(f.Categories))
+	}
+	if f.Type != "" {
+		add("transaction_type = $%d", f.Type)
+	}
+	if f.SpenderID != 0 {
+		add("spender_id = $%d", f.SpenderID)
+	}
+	if f.Note != "" {
+		add(`note ILIKE '%%' || $%d || '%%'`, escapeLike(f.Note))
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// OrderBy renders the sort as an ORDER BY clause with id as a tie-breaker so
+// pages stay stable when sort values repeat.
+func (f Filter) OrderBy() string {
+	dir := "DESC"
+	if f.Order == "asc" {
+		dir = "ASC"
+	}
+
+	col := sortColumns[f.Sort]
+	if col == "" {
+		col = "date"
+	}
+	if col == "id" {
+		return " ORDER BY id " + dir
+	}
+
+	return " ORDER BY " + col + " " + dir + ", id " + dir
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,97 @@
+package transaction
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFilterContext(query string) echo.Context {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	return e.NewContext(req, httptest.NewRecorder())
+}
+
+func TestParseFilter(t *testing.T) {
+	t.Run("given no query should sort by latest date", func(t *testing.T) {
+		f, err := ParseFilter(newFilterContext(""))
+
+		assert.NoError(t, err)
+		assert.Equal(t, Filter{Sort: "date", Order: "desc"}, f)
+	})
+
+	t.Run("given date range should cover the whole last day", func(t *testing.T) {
+		f, err := ParseFilter(newFilterContext("date_from=2024-05-01&date_to=2024-05-31"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), *f.DateFrom)
+		assert.Equal(t, time.Date(2024, 5, 31, 23, 59, 59, 999999999, time.UTC), *f.DateTo)
+	})
+
+	t.Run("given repeated and comma separated categories should collect all", func(t *testing.T) {
+		f, err := ParseFilter(newFilterContext("category=food,%20travel&category=rent"))
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"food", "travel", "rent"}, f.Categories)
+	})
+
+	t.Run("given invalid values should return error", func(t *testing.T) {
+		tests := []struct {
+			query    string
+			expected error
+		}{
+			{"date_from=yesterday", ErrInvalidDate},
+			{"amount_min=ten", ErrInvalidAmount},
+			{"type=transfer", ErrInvalidType},
+			{"sort=note", ErrInvalidSort},
+			{"order=up", ErrInvalidOrder},
+		}
+
+		for _, tt := range tests {
+			_, err := ParseFilter(newFilterContext(tt.query))
+			assert.ErrorIs(t, err, tt.expected, tt.query)
+		}
+	})
+}
+
+func TestFilterWhere(t *testing.T) {
+	t.Run("given no constraint should only exclude deleted rows", func(t *testing.T) {
+		where, args := Filter{}.Where(nil)
+
+		assert.Equal(t, " WHERE deleted_at IS NULL", where)
+		assert.Empty(t, args)
+	})
+
+	t.Run("given every constraint should number placeholders after existing args", func(t *testing.T) {
+		from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+		lo, hi := money.MustParse("10"), money.MustParse("99.5")
+		f := Filter{
+			DateFrom:   &from,
+			DateTo:     &to,
+			AmountMin:  &lo,
+			AmountMax:  &hi,
+			Categories: []string{"food"},
+			Type:       "expense",
+			SpenderID:  3,
+			Note:       "50%_off",
+		}
+
+		where, args := f.Where([]any{"existing"})
+
+		assert.Equal(t, ` WHERE deleted_at IS NULL AND date >= $2 AND date <= $3 AND amount >= $4 AND amount <= $5 AND category = ANY($6) AND transaction_type = $7 AND spender_id = $8 AND note ILIKE '%' || $9 || '%'`, where)
+		assert.Equal(t, []any{"existing", from, to, lo, hi, pq.Array([]string{"food"}), "expense", 3, `50\%\_off`}, args)
+	})
+}
+
+func TestFilterOrderBy(t *testing.T) {
+	assert.Equal(t, " ORDER BY date DESC, id DESC", Filter{}.OrderBy())
+	assert.Equal(t, " ORDER BY amount ASC, id ASC", Filter{Sort: "amount", Order: "asc"}.OrderBy())
+	assert.Equal(t, " ORDER BY id DESC", Filter{Sort: "id", Order: "desc"}.OrderBy())
+}
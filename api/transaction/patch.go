@@ -0,0 +1,211 @@
+package transaction
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/exchange"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
+	"github.com/kkgo-software-engineering/workshop/mlog"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// MIMEMergePatch is the media type of RFC 7396 JSON Merge Patch documents.
+const MIMEMergePatch = "application/merge-patch+json"
+
+var (
+	ErrUnsupportedPatch = errors.New("content type must be " + MIMEMergePatch)
+	ErrInvalidPatch     = errors.New("patch must be a JSON object")
+)
+
+// patchFields whitelists the members a merge patch may carry, in the order
+// their columns are written, along with the Transaction field that validates
+// them.
+var patchFields = []struct {
+	member string
+	field  string
+}{
+	{"date", "Date"},
+	{"amount", "Amount"},
+	{"category", "Category"},
+	{"transaction_type", "TransactionType"},
+	{"note", "Note"},
+	{"image_url", "ImageURL"},
+	{"currency", "Currency"},
+}
+
+type partialValidator interface {
+	ValidatePartial(i any, fields ...string) error
+}
+
+// Patch applies a JSON Merge Patch to a transaction. Only the members present
+// are validated and written; null resets a member to its default, which
+// fails validation for required ones.
+func (h handler) Patch(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != MIMEMergePatch {
+		logger.Error("unsupported content type", zap.String("content_type", mediaType))
+		return c.JSON(http.StatusUnsupportedMediaType, errs.ParseError(ErrUnsupportedPatch))
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		logger.Error("read request body error", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	var tx Transactions
+	fields, values, err := decodePatch(body, &tx)
+	if err != nil {
+		logger.Error("bad request body", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	if len(fields) > 0 {
+		v, ok := c.Echo().Validator.(partialValidator)
+		if !ok {
+			logger.Error("validator does not support partial validation")
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(errors.New("partial validation is not supported")))
+		}
+		if err := v.ValidatePartial(tx, fields...); err != nil {
+			logger.Error("validate request body failed", zap.Error(err))
+			return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+		}
+	}
+
+	if _, ok := values["currency"]; ok {
+		if values["currency"], err = exchange.NormalizeCurrency(tx.Currency); err != nil {
+			logger.Error("currency is invalid", zap.Error(err))
+			return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+		}
+	}
+
+	expected, err := utils.IfMatchVersions(c)
+	if err != nil {
+		logger.Warn("If-Match header cannot match", zap.Error(err))
+		return c.JSON(http.StatusPreconditionFailed, errs.ParseError(err))
+	}
+
+	id, status, err := h.authorize(c, ownerTxStmt)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	query, args := patchQuery(id, values, expected)
+	var patched Transactions
+	err = Scan(h.db.QueryRowContext(ctx, query, args...), (*Transaction)(&patched))
+	if errors.Is(err, sql.ErrNoRows) {
+		return writeConflict(c, id, expected)
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+	if len(values) == 0 && expected != nil && !slices.Contains(expected, patched.Version) {
+		return writeConflict(c, id, expected)
+	}
+
+	logger.Info("patch successfully", zap.Int("id", id), zap.Strings("fields", fields))
+	c.Response().Header().Set(utils.HeaderETag, utils.ETag(patched.Version))
+	return c.JSON(http.StatusOK, patched)
+}
+
+// decodePatch reads the whitelisted members of a merge patch into tx. It
+// returns the Transaction fields to validate and the column values to write.
+func decodePatch(body []byte, tx *Transactions) ([]string, map[string]any, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return nil, nil, ErrInvalidPatch
+	}
+
+	present := map[string]json.RawMessage{}
+	var fields, names []string
+	for _, pf := range patchFields {
+		raw, ok := members[pf.member]
+		if !ok {
+			continue
+		}
+		delete(members, pf.member)
+
+		fields = append(fields, pf.field)
+		names = append(names, pf.member)
+		if !bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			present[pf.member] = raw
+		}
+	}
+
+	if len(members) > 0 {
+		unknown := make([]string, 0, len(members))
+		for member := range members {
+			unknown = append(unknown, member)
+		}
+		sort.Strings(unknown)
+		return nil, nil, fmt.Errorf("field %s cannot be patched", strings.Join(unknown, ", "))
+	}
+
+	b, _ := json.Marshal(present)
+	if err := json.Unmarshal(b, tx); err != nil {
+		return nil, nil, err
+	}
+
+	all := map[string]any{
+		"date":             tx.Date,
+		"amount":           tx.Amount,
+		"category":         tx.Category,
+		"transaction_type": tx.TransactionType,
+		"note":             tx.Note,
+		"image_url":        tx.ImageURL,
+		"currency":         tx.Currency,
+	}
+	values := map[string]any{}
+	for _, name := range names {
+		values[name] = all[name]
+	}
+
+	return fields, values, nil
+}
+
+// patchQuery builds the statement writing values to transaction id and
+// returning the merged record. Unless expected is nil, one of its versions
+// must still be current for the write to apply. An empty patch only reads the
+// record back.
+func patchQuery(id int, values map[string]any, expected []int) (string, []any) {
+	var sets []string
+	var args []any
+	for _, pf := range patchFields {
+		v, ok := values[pf.member]
+		if !ok {
+			continue
+		}
+		args = append(args, v)
+		sets = append(sets, fmt.Sprintf("%s = $%d", pf.member, len(args)))
+	}
+
+	if len(sets) == 0 {
+		return getTxStmt, []any{id}
+	}
+
+	args = append(args, id)
+	where := fmt.Sprintf("id = $%d AND deleted_at IS NULL", len(args))
+	if expected != nil {
+		args = append(args, pq.Array(expected))
+		where += fmt.Sprintf(" AND version = ANY($%d)", len(args))
+	}
+
+	return fmt.Sprintf("WITH t AS (UPDATE transaction SET %s, version = version + 1 WHERE %s RETURNING *) SELECT %s FROM t%s", strings.Join(sets, ", "), where, Columns, Join), args
+}
@@ -0,0 +1,193 @@
+package transaction
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
+	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchQuery(t *testing.T) {
+	t.Run("given present members should only set their columns", func(t *testing.T) {
+		query, args := patchQuery(7, map[string]any{"note": "", "category": "travel"}, nil)
+
+		assert.Equal(t, "WITH t AS (UPDATE transaction SET category = $1, note = $2, version = version + 1 WHERE id = $3 AND deleted_at IS NULL RETURNING *) SELECT "+Columns+" FROM t"+Join, query)
+		assert.Equal(t, []any{"travel", "", 7}, args)
+	})
+
+	t.Run("given expected versions should only write when one of them is current", func(t *testing.T) {
+		query, args := patchQuery(7, map[string]any{"amount": money.MustParse("5")}, []int{2, 3})
+
+		assert.Equal(t, "WITH t AS (UPDATE transaction SET amount = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL AND version = ANY($3) RETURNING *) SELECT "+Columns+" FROM t"+Join, query)
+		assert.Equal(t, []any{money.MustParse("5"), 7, pq.Array([]int{2, 3})}, args)
+	})
+
+	t.Run("given empty patch should read the record back", func(t *testing.T) {
+		query, args := patchQuery(7, map[string]any{}, []int{3})
+
+		assert.Equal(t, getTxStmt, query)
+		assert.Equal(t, []any{7}, args)
+	})
+}
+
+func TestDecodePatch(t *testing.T) {
+	t.Run("given null member should reset it to its zero value", func(t *testing.T) {
+		var tx Transactions
+		fields, values, err := decodePatch([]byte(`{"amount": 12.5, "note": null}`), &tx)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Amount", "Note"}, fields)
+		assert.Equal(t, map[string]any{"amount": money.MustParse("12.5"), "note": ""}, values)
+	})
+
+	t.Run("given member outside whitelist should return error", func(t *testing.T) {
+		var tx Transactions
+		_, _, err := decodePatch([]byte(`{"spender_id": 2, "id": 3, "note": "x"}`), &tx)
+
+		assert.EqualError(t, err, "field id, spender_id cannot be patched")
+	})
+
+	t.Run("given non-object document should return error", func(t *testing.T) {
+		var tx Transactions
+		_, _, err := decodePatch([]byte(`["category"]`), &tx)
+
+		assert.Equal(t, ErrInvalidPatch, err)
+	})
+}
+
+func TestPatchTransaction(t *testing.T) {
+	cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+
+	newContext := func(e *echo.Echo, body, contentType string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPatch, "/transactions/1", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+		return c, rec
+	}
+
+	t.Run("given category only should update it and return merged record", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, `{"category": "travel"}`, MIMEMergePatch)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		query, _ := patchQuery(1, map[string]any{"category": "travel"}, nil)
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectQuery(query).WithArgs("travel", 1).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "travel", "expense", "taxi", "https://slip/1.png", 1, "THB", 30, "THB", 1, ""))
+
+		h := New(db)
+		err := h.Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 1, "date": "2024-05-11 15:04:05", "amount": 30, "category": "travel", "transaction_type": "expense", "note": "taxi", "image_url": "https://slip/1.png", "spender_id": 1, "currency": "THB", "converted_amount": 30, "converted_currency": "THB"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given invalid present member should return error without touching database", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, `{"transaction_type": "refund"}`, MIMEMergePatch)
+
+		h := New(nil)
+		err := h.Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["the value of TransactionType must be one of income expense"]}`, rec.Body.String())
+	})
+
+	t.Run("given null required member should return error", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, `{"category": null}`, MIMEMergePatch)
+
+		h := New(nil)
+		err := h.Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["field Category is required"]}`, rec.Body.String())
+	})
+
+	t.Run("given plain json content type should return unsupported media type", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, `{"category": "travel"}`, echo.MIMEApplicationJSON)
+
+		h := New(nil)
+		err := h.Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+		assert.JSONEq(t, `{"messages":["content type must be application/merge-patch+json"]}`, rec.Body.String())
+	})
+
+	t.Run("given deleted transaction should return not found", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, `{"note": "lunch"}`, MIMEMergePatch+"; charset=utf-8")
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnError(sql.ErrNoRows)
+
+		h := New(db)
+		err := h.Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given stale If-Match should return precondition failed", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		c, rec := newContext(e, `{"category": "travel"}`, MIMEMergePatch)
+		c.Request().Header.Set(utils.HeaderIfMatch, `"5"`)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		query, _ := patchQuery(1, map[string]any{"category": "travel"}, []int{5})
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectQuery(query).WithArgs("travel", 1, pq.Array([]int{5})).WillReturnError(sql.ErrNoRows)
+
+		h := New(db)
+		err := h.Patch(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -1,25 +1,56 @@
 package transaction
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/exchange"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
 	"github.com/kkgo-software-engineering/workshop/mlog"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
 type Transaction struct {
-	ID              uint    `db:"id" json:"id,omitempty"`
-	Date            string  `db:"date" json:"date" validate:"required"`
-	Amount          float64 `db:"amount" json:"amount" validate:"required,gt=0"`
-	Category        string  `db:"category" json:"category" validate:"required"`
-	TransactionType string  `db:"transaction_type" json:"transaction_type" validate:"required,oneof=income expense"`
-	Note            string  `db:"note" json:"note"`
-	ImageURL        string  `db:"image_url" json:"image_url"`
-	SpenderID       int     `db:"spender_id" json:"spender_id"`
+	ID              uint        `db:"id" json:"id,omitempty"`
+	Date            string      `db:"date" json:"date" validate:"required"`
+	Amount          money.Money `db:"amount" json:"amount" validate:"required,money_gt=0"`
+	Category        string      `db:"category" json:"category" validate:"required"`
+	TransactionType string      `db:"transaction_type" json:"transaction_type" validate:"required,oneof=income expense"`
+	Note            string      `db:"note" json:"note"`
+	ImageURL        string      `db:"image_url" json:"image_url"`
+	SpenderID       int         `db:"spender_id" json:"spender_id"`
+	Currency        string      `db:"currency" json:"currency"`
+
+	// ExternalRef identifies the transaction in the bank statement it was
+	// imported from, such as an OFX FITID. A spender has at most one
+	// transaction per reference.
+	ExternalRef string `db:"external_ref" json:"external_ref,omitempty"`
+
+	// ConvertedAmount is Amount in the owning spender's home currency, as of
+	// the rate effective on Date. Both are omitted when no rate is loaded.
+	ConvertedAmount   *money.Money `json:"converted_amount,omitempty"`
+	ConvertedCurrency string       `json:"converted_currency,omitempty"`
+
+	// Attachments are the slips attached to the transaction. Reads list
+	// them; they are omitted when there are none and from write responses.
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// ThumbnailURL is the JPEG thumbnail of the first attachment that has
+	// one, for lists that show a single small preview per transaction.
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+
+	// Version increases on every write and is exposed as the ETag header.
+	Version int `json:"-"`
 }
 
 type Transactions Transaction
@@ -29,9 +60,74 @@ type handler struct {
 }
 
 var (
-	updateTxStmt = "UPDATE transaction SET date = $1, amount = $2, category = $3, transaction_type = $4, note = $5, image_url = $6 WHERE ID = $7 RETURNING id, date, amount, category, transaction_type, note, image_url, spender_id;"
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrSpenderRequired     = errors.New("field spender_id is required")
+	ErrDuplicateRef        = errors.New("a transaction with this external_ref already exists")
 )
 
+const (
+	// Columns selects a transaction aliased t along with its amount converted
+	// into the home currency of the spender that Join brings in as s. Rows
+	// selected this way are read with Scan.
+	Columns = "t.id, t.date, t.amount, t.category, t.transaction_type, t.note, t.image_url, t.spender_id, t.currency, ROUND(t.amount * " + exchange.RateSQL + ", 2), s.home_currency, t.version, COALESCE(t.external_ref, '')"
+
+	// Join attaches the owning spender to t. The spender id is renamed so
+	// unqualified transaction columns in filters stay unambiguous.
+	Join = " LEFT JOIN (SELECT id AS owner_id, home_currency FROM spender) s ON s.owner_id = t.spender_id"
+
+	// uniqueViolation is the Postgres error code for a broken unique index.
+	uniqueViolation = "23505"
+)
+
+var (
+	ownerTxStmt   = "SELECT spender_id FROM transaction WHERE id = $1 AND deleted_at IS NULL;"
+	deletedTxStmt = "SELECT spender_id FROM transaction WHERE id = $1 AND deleted_at IS NOT NULL;"
+	getTxStmt     = "SELECT " + Columns + " FROM transaction t" + Join + " WHERE t.id = $1 AND t.deleted_at IS NULL;"
+	listTxStmt    = "SELECT " + Columns + " FROM transaction t" + Join
+	countTxStmt   = "SELECT COUNT(*) FROM transaction"
+	insertTxStmt  = "WITH t AS (INSERT INTO transaction (date, amount, category, transaction_type, note, image_url, spender_id, currency, external_ref) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, '')) RETURNING *) SELECT " + Columns + " FROM t" + Join
+	updateTxStmt  = "WITH t AS (UPDATE transaction SET date = $1, amount = $2, category = $3, transaction_type = $4, note = $5, image_url = $6, currency = $7, version = version + 1 WHERE id = $8 AND deleted_at IS NULL AND ($9::int[] IS NULL OR version = ANY($9)) RETURNING *) SELECT " + Columns + " FROM t" + Join
+	deleteTxStmt  = "UPDATE transaction SET deleted_at = now(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL;"
+	restoreTxStmt = "WITH t AS (UPDATE transaction SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL RETURNING *) SELECT " + Columns + " FROM t" + Join
+	purgeTxStmt   = "DELETE FROM transaction WHERE deleted_at < $1;"
+)
+
+// Scan reads a row selected with Columns into tx.
+func Scan(row interface{ Scan(dest ...any) error }, tx *Transaction) error {
+	var home sql.NullString
+	err := row.Scan(&tx.ID, &tx.Date, &tx.Amount, &tx.Category, &tx.TransactionType, &tx.Note, &tx.ImageURL, &tx.SpenderID, &tx.Currency, &tx.ConvertedAmount, &home, &tx.Version, &tx.ExternalRef)
+	if err != nil {
+		return err
+	}
+
+	if tx.ConvertedAmount != nil {
+		tx.ConvertedCurrency = home.String
+	}
+
+	return nil
+}
+
+// Querier runs a single-row query; *sql.DB and *sql.Tx both satisfy it.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Insert creates tx through q and returns the stored row. Every path that
+// creates transactions goes through here so they are written the same way.
+func Insert(ctx context.Context, q Querier, tx Transaction) (Transaction, error) {
+	var created Transaction
+	row := q.QueryRowContext(ctx, insertTxStmt, tx.Date, tx.Amount, tx.Category, tx.TransactionType, tx.Note, tx.ImageURL, tx.SpenderID, tx.Currency, tx.ExternalRef)
+	err := Scan(row, &created)
+	return created, err
+}
+
+// IsDuplicateRef reports whether err is Insert refusing a second transaction
+// with the same spender and external_ref.
+func IsDuplicateRef(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
 func New(db *sql.DB) *handler {
 	return &handler{
 		db: db,
@@ -61,11 +157,46 @@ func (h handler) Update(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
 	}
 
+	if tx.Currency, err = exchange.NormalizeCurrency(tx.Currency); err != nil {
+		logger.Error("currency is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	expected, err := utils.IfMatchVersions(c)
+	if err != nil {
+		logger.Warn("If-Match header cannot match", zap.Error(err))
+		return c.JSON(http.StatusPreconditionFailed, errs.ParseError(err))
+	}
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+	}
+
+	var ownerID sql.NullInt64
+	err = h.db.QueryRowContext(ctx, ownerTxStmt, id).Scan(&ownerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("transaction not found", zap.Int("id", id))
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrTransactionNotFound))
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	if !p.CanAccess(int(ownerID.Int64)) {
+		logger.Warn("transaction belongs to another spender", zap.Int("id", id), zap.Int("spender_id", p.SpenderID))
+		return c.JSON(http.StatusForbidden, errs.ParseError(errs.ErrForbidden))
+	}
+
 	var updatedTx Transactions
 
-	row := h.db.QueryRowContext(ctx, updateTxStmt, tx.Date, tx.Amount, tx.Category, tx.TransactionType, tx.Note, tx.ImageURL, id)
-	err = row.Scan(&updatedTx.ID, &updatedTx.Date, &updatedTx.Amount, &updatedTx.Category, &updatedTx.TransactionType, &updatedTx.Note, &updatedTx.ImageURL, &updatedTx.SpenderID)
+	row := h.db.QueryRowContext(ctx, updateTxStmt, tx.Date, tx.Amount, tx.Category, tx.TransactionType, tx.Note, tx.ImageURL, tx.Currency, id, pq.Array(expected))
+	err = Scan(row, (*Transaction)(&updatedTx))
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return writeConflict(c, id, expected)
+	}
 	if err != nil {
 		logger.Error("query row error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
@@ -73,33 +204,234 @@ func (h handler) Update(c echo.Context) error {
 
 	logger.Info("update successfully", zap.Any("updatedTx", updatedTx))
 
+	c.Response().Header().Set(utils.HeaderETag, utils.ETag(updatedTx.Version))
 	return c.JSON(http.StatusOK, updatedTx)
 
 }
 
+// Get returns a single transaction, with its attachments, and its version as
+// the ETag. A matching If-None-Match answers 304 Not Modified; attaching or
+// detaching a slip moves the version on.
+func (h handler) Get(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, status, err := h.authorize(c, ownerTxStmt)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	var tx Transactions
+	err = Scan(h.db.QueryRowContext(ctx, getTxStmt, id), (*Transaction)(&tx))
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("transaction not found", zap.Int("id", id))
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrTransactionNotFound))
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	etag := utils.ETag(tx.Version)
+	c.Response().Header().Set(utils.HeaderETag, etag)
+	if utils.IfNoneMatch(c, etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	if err := LoadAttachments(c, h.db, (*Transaction)(&tx)); err != nil {
+		logger.Error("query attachments error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	return c.JSON(http.StatusOK, tx)
+}
+
+// writeConflict answers a conditional write on an existing transaction that
+// matched no row: its version moved on, or it was deleted meanwhile.
+func writeConflict(c echo.Context, id int, expected []int) error {
+	logger := mlog.L(c)
+	if expected != nil {
+		logger.Warn("transaction version does not match", zap.Int("id", id), zap.Ints("expected", expected))
+		return c.JSON(http.StatusPreconditionFailed, errs.ParseError(utils.ErrPreconditionFailed))
+	}
+
+	logger.Warn("transaction not found", zap.Int("id", id))
+	return c.JSON(http.StatusNotFound, errs.ParseError(ErrTransactionNotFound))
+}
+
+// Delete soft-deletes a transaction. It disappears from listings and
+// summaries until restored or purged.
+func (h handler) Delete(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, status, err := h.authorize(c, ownerTxStmt)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	if _, err := h.db.ExecContext(ctx, deleteTxStmt, id); err != nil {
+		logger.Error("delete transaction error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	logger.Info("delete successfully", zap.Int("id", id))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Restore brings back a soft-deleted transaction that has not been purged.
+func (h handler) Restore(c echo.Context) error {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, status, err := h.authorize(c, deletedTxStmt)
+	if err != nil {
+		return c.JSON(status, errs.ParseError(err))
+	}
+
+	var restored Transactions
+	err = Scan(h.db.QueryRowContext(ctx, restoreTxStmt, id), (*Transaction)(&restored))
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("deleted transaction not found", zap.Int("id", id))
+		return c.JSON(http.StatusNotFound, errs.ParseError(ErrTransactionNotFound))
+	}
+	if err != nil {
+		logger.Error("restore transaction error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	logger.Info("restore successfully", zap.Int("id", id))
+	c.Response().Header().Set(utils.HeaderETag, utils.ETag(restored.Version))
+	return c.JSON(http.StatusOK, restored)
+}
+
+// authorize reads the :id path parameter and checks the principal may act on
+// the transaction ownerStmt finds for it.
+func (h handler) authorize(c echo.Context, ownerStmt string) (int, int, error) {
+	logger := mlog.L(c)
+	ctx := c.Request().Context()
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Error("ID parameter is invalid", zap.Error(err))
+		return 0, http.StatusBadRequest, err
+	}
+
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return 0, http.StatusUnauthorized, errs.ErrUnauthorized
+	}
+
+	var ownerID sql.NullInt64
+	err = h.db.QueryRowContext(ctx, ownerStmt, id).Scan(&ownerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.Warn("transaction not found", zap.Int("id", id))
+		return 0, http.StatusNotFound, ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.Error("query row error", zap.Error(err))
+		return 0, http.StatusInternalServerError, err
+	}
+
+	if !p.CanAccess(int(ownerID.Int64)) {
+		logger.Warn("transaction belongs to another spender", zap.Int("id", id), zap.Int("spender_id", p.SpenderID))
+		return 0, http.StatusForbidden, errs.ErrForbidden
+	}
+
+	return id, http.StatusOK, nil
+}
+
+type PurgeResponse struct {
+	Purged int64 `json:"purged"`
+}
+
+// Purge hard-deletes transactions that were soft-deleted longer than
+// retention ago.
+func (h handler) Purge(retention time.Duration) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		logger := mlog.L(c)
+		ctx := c.Request().Context()
+
+		res, err := h.db.ExecContext(ctx, purgeTxStmt, time.Now().Add(-retention))
+		if err != nil {
+			logger.Error("purge transactions error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+
+		purged, err := res.RowsAffected()
+		if err != nil {
+			logger.Error("purge transactions error", zap.Error(err))
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+		}
+
+		logger.Info("purge successfully", zap.Int64("purged", purged), zap.Duration("retention", retention))
+		return c.JSON(http.StatusOK, PurgeResponse{Purged: purged})
+	}
+}
+
+type ListResponse struct {
+	Transactions []Transactions   `json:"transactions"`
+	Pagination   utils.Pagination `json:"pagination"`
+}
+
+// GetAll lists transactions across spenders narrowed by the query filters
+// described on ParseFilter, one page at a time.
 func (h handler) GetAll(c echo.Context) error {
 	logger := mlog.L(c)
 	ctx := c.Request().Context()
 
-	rows, err := h.db.QueryContext(ctx, `SELECT * FROM transaction`)
+	page, perPage, err := utils.ParsePage(c)
+	if err != nil {
+		logger.Error("page query is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	f, err := ParseFilter(c)
+	if err != nil {
+		logger.Error("filter query is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	where, args := f.Where(nil)
+	query := listTxStmt + where + f.OrderBy() + fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+
+	rows, err := h.db.QueryContext(ctx, query, append(args, perPage, (page-1)*perPage)...)
 	if err != nil {
 		logger.Error("query error", zap.Error(err))
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
 	}
 	defer rows.Close()
 
-	var txs []Transactions
+	txs := make([]Transactions, 0)
 	for rows.Next() {
 		var tx Transactions
-		err := rows.Scan(&tx.ID, &tx.Date, &tx.Amount, &tx.Category, &tx.TransactionType, &tx.Note, &tx.ImageURL, &tx.SpenderID)
+		err := Scan(rows, (*Transaction)(&tx))
 		if err != nil {
 			logger.Error("scan error", zap.Error(err))
-			return c.JSON(http.StatusInternalServerError, err.Error())
+			return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
 		}
 		txs = append(txs, tx)
 	}
 
-	return c.JSON(http.StatusOK, txs)
+	loaded := make([]*Transaction, len(txs))
+	for i := range txs {
+		loaded[i] = (*Transaction)(&txs[i])
+	}
+	if err := LoadAttachments(c, h.db, loaded...); err != nil {
+		logger.Error("query attachments error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	var total int64
+	if err := h.db.QueryRowContext(ctx, countTxStmt+where, args...).Scan(&total); err != nil {
+		logger.Error("count total rows error", zap.Error(err))
+		return c.JSON(http.StatusInternalServerError, errs.ParseError(err))
+	}
+
+	return c.JSON(http.StatusOK, ListResponse{
+		Transactions: txs,
+		Pagination:   utils.NewPagination(page, perPage, total),
+	})
 }
 
 func (h handler) Create(c echo.Context) error {
@@ -113,15 +445,32 @@ func (h handler) Create(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
 
-	var id int
-	cstm := `INSERT INTO transaction ( date, amount, category, transaction_type, note, image_url, spender_id) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;`
-	err = h.db.QueryRowContext(ctx, cstm, tx.Date, tx.Amount, tx.Category, tx.TransactionType, tx.Note, tx.ImageURL, tx.SpenderID).Scan(&id)
+	p, ok := auth.PrincipalFrom(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, errs.ParseError(errs.ErrUnauthorized))
+	}
+	tx.SpenderID = p.OwnerFor(tx.SpenderID)
+	if tx.SpenderID == 0 {
+		logger.Error("spender_id is required")
+		return c.JSON(http.StatusBadRequest, errs.ParseError(ErrSpenderRequired))
+	}
+
+	if tx.Currency, err = exchange.NormalizeCurrency(tx.Currency); err != nil {
+		logger.Error("currency is invalid", zap.Error(err))
+		return c.JSON(http.StatusBadRequest, errs.ParseError(err))
+	}
+
+	created, err := Insert(ctx, h.db, Transaction(tx))
+	if IsDuplicateRef(err) {
+		logger.Warn("external_ref already imported", zap.String("external_ref", tx.ExternalRef))
+		return c.JSON(http.StatusConflict, errs.ParseError(ErrDuplicateRef))
+	}
 	if err != nil {
 		logger.Error("query row error", zap.Error(err))
 		return c.JSON(http.StatusInternalServerError, err.Error())
 	}
 
-	logger.Info("create successfully", zap.Int("id", id))
-	tx.ID = uint(id)
-	return c.JSON(http.StatusCreated, tx)
+	logger.Info("create successfully", zap.Uint("id", created.ID))
+	c.Response().Header().Set(utils.HeaderETag, utils.ETag(created.Version))
+	return c.JSON(http.StatusCreated, created)
 }
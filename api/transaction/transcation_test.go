@@ -1,24 +1,28 @@
 package transaction
 
 import (
+	"database/sql"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/auth"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/errs"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/utils"
 	cv "github.com/KKGo-Software-engineering/workshop-summer/api/validator"
-	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestUpdateTransactionByID(t *testing.T) {
 	t.Run("given transaction information should update transaction", func(t *testing.T) {
 		e := echo.New()
-		e.Validator = &cv.CustomValidator{Validator: validator.New()}
+		e.Validator = cv.New()
 		defer e.Close()
 
 		type Mock struct {
@@ -32,15 +36,15 @@ func TestUpdateTransactionByID(t *testing.T) {
 			Mock     Mock
 		}
 
-		cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}
+		cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
 		tcs := []TestCase{
 			{
 				Request:  `{"date": "2024-05-11 15:04:05","amount": 25.5,"category": "food","transaction_type": "income","note": "","image_url": "", "spender_id": 1}`,
-				Expected: `{"id": 1, "date": "2024-05-11 15:04:05","amount": 25.5,"category": "food","transaction_type": "income","note": "","image_url": "", "spender_id": 1}`,
+				Expected: `{"id": 1, "date": "2024-05-11 15:04:05","amount": 25.5,"category": "food","transaction_type": "income","note": "","image_url": "", "spender_id": 1, "currency": "THB", "converted_amount": 25.5, "converted_currency": "THB"}`,
 				Mock: Mock{
 					Arg: Transactions{
 						Date:            "2024-05-11 15:04:05",
-						Amount:          25.5,
+						Amount:          money.MustParse("25.5"),
 						Category:        "food",
 						TransactionType: "income",
 						Note:            "",
@@ -49,7 +53,7 @@ func TestUpdateTransactionByID(t *testing.T) {
 					ReturningRow: Transactions{
 						ID:              1,
 						Date:            "2024-05-11 15:04:05",
-						Amount:          25.5,
+						Amount:          money.MustParse("25.5"),
 						Category:        "food",
 						TransactionType: "income",
 						Note:            "",
@@ -60,11 +64,11 @@ func TestUpdateTransactionByID(t *testing.T) {
 			},
 			{
 				Request:  `{"date": "2024-05-11 15:04:05","amount": 30,"category": "food","transaction_type": "income","note": "","image_url": "", "spender_id": 1}`,
-				Expected: `{"id": 1, "date": "2024-05-11 15:04:05","amount": 30,"category": "food","transaction_type": "income","note": "","image_url": "", "spender_id": 1}`,
+				Expected: `{"id": 1, "date": "2024-05-11 15:04:05","amount": 30,"category": "food","transaction_type": "income","note": "","image_url": "", "spender_id": 1, "currency": "THB", "converted_amount": 30, "converted_currency": "THB"}`,
 				Mock: Mock{
 					Arg: Transactions{
 						Date:            "2024-05-11 15:04:05",
-						Amount:          30,
+						Amount:          money.MustParse("30"),
 						Category:        "food",
 						TransactionType: "income",
 						Note:            "",
@@ -73,7 +77,7 @@ func TestUpdateTransactionByID(t *testing.T) {
 					ReturningRow: Transactions{
 						ID:              1,
 						Date:            "2024-05-11 15:04:05",
-						Amount:          30,
+						Amount:          money.MustParse("30"),
 						Category:        "food",
 						TransactionType: "income",
 						Note:            "",
@@ -92,6 +96,7 @@ func TestUpdateTransactionByID(t *testing.T) {
 			c.SetPath("/transactions/:id")
 			params := utils.KeyValuePairs{"id": "1"}
 			utils.SetParams(c, params)
+			auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 			db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 			defer db.Close()
@@ -99,8 +104,9 @@ func TestUpdateTransactionByID(t *testing.T) {
 
 			returningRow := tc.Mock.ReturningRow
 			arg := tc.Mock.Arg
-			row := sqlmock.NewRows(cols).AddRow(returningRow.ID, returningRow.Date, returningRow.Amount, returningRow.Category, returningRow.TransactionType, returningRow.Note, returningRow.ImageURL, returningRow.SpenderID)
-			mock.ExpectQuery(updateTxStmt).WithArgs(arg.Date, arg.Amount, arg.Category, arg.TransactionType, arg.Note, arg.ImageURL, 1).WillReturnRows(row)
+			mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+			row := sqlmock.NewRows(cols).AddRow(returningRow.ID, returningRow.Date, returningRow.Amount, returningRow.Category, returningRow.TransactionType, returningRow.Note, returningRow.ImageURL, returningRow.SpenderID, "THB", returningRow.Amount, "THB", 1, "")
+			mock.ExpectQuery(updateTxStmt).WithArgs(arg.Date, arg.Amount, arg.Category, arg.TransactionType, arg.Note, arg.ImageURL, "THB", 1, pq.Array([]int(nil))).WillReturnRows(row)
 
 			err := h.Update(c)
 
@@ -112,12 +118,12 @@ func TestUpdateTransactionByID(t *testing.T) {
 
 	t.Run("given valid information should return error when database failed", func(t *testing.T) {
 		e := echo.New()
-		e.Validator = &cv.CustomValidator{Validator: validator.New()}
+		e.Validator = cv.New()
 		defer e.Close()
 
 		arg := Transactions{
 			Date:            "2024-05-11 15:04:05",
-			Amount:          30,
+			Amount:          money.MustParse("30"),
 			Category:        "food",
 			TransactionType: "income",
 			Note:            "",
@@ -131,6 +137,7 @@ func TestUpdateTransactionByID(t *testing.T) {
 		c.SetPath("/transactions/:id")
 		params := utils.KeyValuePairs{"id": "1"}
 		utils.SetParams(c, params)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
@@ -138,7 +145,8 @@ func TestUpdateTransactionByID(t *testing.T) {
 		h := New(db)
 
 		mockErr := errs.ErrInternalDatabaseError
-		mock.ExpectQuery(updateTxStmt).WithArgs(arg.Date, arg.Amount, arg.Category, arg.TransactionType, arg.Note, arg.ImageURL, 1).WillReturnError(mockErr)
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectQuery(updateTxStmt).WithArgs(arg.Date, arg.Amount, arg.Category, arg.TransactionType, arg.Note, arg.ImageURL, "THB", 1, pq.Array([]int(nil))).WillReturnError(mockErr)
 
 		err := h.Update(c)
 
@@ -151,7 +159,7 @@ func TestUpdateTransactionByID(t *testing.T) {
 
 	t.Run("given invalid request body should return error", func(t *testing.T) {
 		e := echo.New()
-		e.Validator = &cv.CustomValidator{Validator: validator.New()}
+		e.Validator = cv.New()
 		defer e.Close()
 
 		type TestCase struct {
@@ -200,6 +208,7 @@ func TestUpdateTransactionByID(t *testing.T) {
 			c.SetPath("/transactions/:id")
 			params := utils.KeyValuePairs{"id": "1"}
 			utils.SetParams(c, params)
+			auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 			db, _, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 			defer db.Close()
@@ -214,9 +223,94 @@ func TestUpdateTransactionByID(t *testing.T) {
 		}
 	})
 
+	t.Run("given transaction of another spender should return forbidden", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPut, "/transactions/1", strings.NewReader(`{"date": "2024-05-11 15:04:05","amount": 30,"category": "food","transaction_type": "income","note": "","image_url": ""}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 2, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+
+		h := New(db)
+
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.JSONEq(t, `{"messages":["forbidden"]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given admin should update transaction of another spender", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPut, "/transactions/1", strings.NewReader(`{"date": "2024-05-11 15:04:05","amount": 30,"category": "food","transaction_type": "income","note": "","image_url": ""}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 2, Role: auth.RoleAdmin})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectQuery(updateTxStmt).WithArgs("2024-05-11 15:04:05", money.MustParse("30"), "food", "income", "", "", "THB", 1, pq.Array([]int(nil))).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "income", "", "", 1, "THB", 30, "THB", 1, ""))
+
+		h := New(db)
+
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given unknown transaction should return not found", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPut, "/transactions/1", strings.NewReader(`{"date": "2024-05-11 15:04:05","amount": 30,"category": "food","transaction_type": "income","note": "","image_url": ""}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnError(sql.ErrNoRows)
+
+		h := New(db)
+
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"messages":["transaction not found"]}`, rec.Body.String())
+	})
+
 	t.Run("given invalid ID should return error", func(t *testing.T) {
 		e := echo.New()
-		e.Validator = &cv.CustomValidator{Validator: validator.New()}
+		e.Validator = cv.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPut, "/transactions/1", strings.NewReader(`{"date": "2024-05-11 15:04:05","amount": 30,"category": "food","transaction_type": "income","note": "","image_url": ""}`))
@@ -241,7 +335,7 @@ func TestUpdateTransactionByID(t *testing.T) {
 
 	t.Run("given invalid request body format should return error", func(t *testing.T) {
 		e := echo.New()
-		e.Validator = &cv.CustomValidator{Validator: validator.New()}
+		e.Validator = cv.New()
 		defer e.Close()
 
 		req := httptest.NewRequest(http.MethodPut, "/transactions/1", strings.NewReader(`[]`))
@@ -251,6 +345,7 @@ func TestUpdateTransactionByID(t *testing.T) {
 		c.SetPath("/transactions/:id")
 		params := utils.KeyValuePairs{"id": "1"}
 		utils.SetParams(c, params)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, _, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
@@ -266,7 +361,9 @@ func TestUpdateTransactionByID(t *testing.T) {
 }
 
 func TestGetAllTransaction(t *testing.T) {
-	t.Run("should return list of transaction when trasaction exists", func(t *testing.T) {
+	cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+
+	t.Run("should return page of transaction when trasaction exists", func(t *testing.T) {
 		e := echo.New()
 		defer e.Close()
 
@@ -277,16 +374,18 @@ func TestGetAllTransaction(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"}).
-			AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 1)
-		mock.ExpectQuery(`SELECT * FROM transaction`).WillReturnRows(rows)
+		rows := sqlmock.NewRows(cols).
+			AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 1, "USD", 1050.75, "THB", 1, "")
+		mock.ExpectQuery(listTxStmt+` WHERE deleted_at IS NULL ORDER BY date DESC, id DESC LIMIT $1 OFFSET $2`).WithArgs(10, 0).WillReturnRows(rows)
+		mock.ExpectQuery(attachmentsStmt).WithArgs(pq.Array([]int64{1})).WillReturnRows(sqlmock.NewRows(attachmentCols))
+		mock.ExpectQuery(countTxStmt + ` WHERE deleted_at IS NULL`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 
 		h := New(db)
 
 		err := h.GetAll(c)
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.JSONEq(t, `[{
+		assert.JSONEq(t, `{"transactions": [{
 			"id": 1,
 			"date": "2024-05-11 15:04:05",
 			"category": "food",
@@ -294,11 +393,14 @@ func TestGetAllTransaction(t *testing.T) {
 			"transaction_type": "expense",
 			"note": "",
 			"image_url": "",
-			"spender_id": 1
-		}]`, rec.Body.String())
+			"spender_id": 1,
+			"currency": "USD",
+			"converted_amount": 1050.75,
+			"converted_currency": "THB"
+		}], "pagination": {"current_page": 1, "total_pages": 1, "per_page": 10, "total_count": 1}}`, rec.Body.String())
 	})
 
-	t.Run("should return null of transaction when trasaction not exists", func(t *testing.T) {
+	t.Run("should return empty list when trasaction not exists", func(t *testing.T) {
 		e := echo.New()
 		defer e.Close()
 
@@ -309,15 +411,59 @@ func TestGetAllTransaction(t *testing.T) {
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id"})
-		mock.ExpectQuery(`SELECT * FROM transaction`).WillReturnRows(rows)
+		mock.ExpectQuery(listTxStmt+` WHERE deleted_at IS NULL ORDER BY date DESC, id DESC LIMIT $1 OFFSET $2`).WithArgs(10, 0).WillReturnRows(sqlmock.NewRows(cols))
+		mock.ExpectQuery(countTxStmt + ` WHERE deleted_at IS NULL`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 
 		h := New(db)
 
 		err := h.GetAll(c)
 		assert.NoError(t, err)
 		assert.Equal(t, http.StatusOK, rec.Code)
-		assert.Equal(t, "null", strings.Trim(rec.Body.String(), "\n"))
+		assert.JSONEq(t, `{"transactions": [], "pagination": {"current_page": 1, "total_pages": 0, "per_page": 10, "total_count": 0}}`, rec.Body.String())
+	})
+
+	t.Run("should apply filters, sort and paging", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/?type=expense&category=food,travel&spender_id=2&sort=amount&order=asc&page=2&per_page=5", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		where := ` WHERE deleted_at IS NULL AND category = ANY($1) AND transaction_type = $2 AND spender_id = $3`
+		mock.ExpectQuery(listTxStmt+where+` ORDER BY amount ASC, id ASC LIMIT $4 OFFSET $5`).
+			WithArgs(pq.Array([]string{"food", "travel"}), "expense", 2, 5, 5).
+			WillReturnRows(sqlmock.NewRows(cols))
+		mock.ExpectQuery(countTxStmt+where).
+			WithArgs(pq.Array([]string{"food", "travel"}), "expense", 2).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(6))
+
+		h := New(db)
+
+		err := h.GetAll(c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"transactions": [], "pagination": {"current_page": 2, "total_pages": 2, "per_page": 5, "total_count": 6}}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return error when filter is invalid", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/?sort=note", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := New(nil)
+
+		err := h.GetAll(c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["the value of sort must be one of date amount category id"]}`, rec.Body.String())
 	})
 }
 
@@ -340,14 +486,16 @@ func TestCreateTransaction(t *testing.T) {
 		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 		rec := httptest.NewRecorder()
 		c := e.NewContext(req, rec)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
 
 		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 		defer db.Close()
 
-		rows := sqlmock.NewRows([]string{"id"}).AddRow("1")
+		cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+		rows := sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 1, "THB", 30, "THB", 1, "")
 
-		expectedQuery := mock.ExpectQuery(`INSERT INTO transaction ( date, amount, category, transaction_type, note, image_url, spender_id) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;`)
-		expectedQuery.WithArgs("2024-05-11 15:04:05", 30.0, "food", "expense", "", "", 1)
+		expectedQuery := mock.ExpectQuery(insertTxStmt)
+		expectedQuery.WithArgs("2024-05-11 15:04:05", money.MustParse("30"), "food", "expense", "", "", 1, "THB", "")
 		expectedQuery.WillReturnRows(rows)
 
 		h := New(db)
@@ -357,4 +505,429 @@ func TestCreateTransaction(t *testing.T) {
 		assert.Equal(t, http.StatusCreated, rec.Code)
 
 	})
+
+	t.Run("given foreign currency should return original and converted amount", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-05-11 15:04:05", "category": "hotel", "amount": 120.5, "transaction_type": "expense", "currency": "usd"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+		mock.ExpectQuery(insertTxStmt).
+			WithArgs("2024-05-11 15:04:05", money.MustParse("120.5"), "hotel", "expense", "", "", 1, "USD", "").
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", "120.50", "hotel", "expense", "", "", 1, "USD", "4337.80", "THB", 1, ""))
+
+		h := New(db)
+
+		err := h.Create(c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"id": 1, "date": "2024-05-11 15:04:05", "amount": 120.5, "category": "hotel", "transaction_type": "expense", "note": "", "image_url": "", "spender_id": 1, "currency": "USD", "converted_amount": 4337.8, "converted_currency": "THB"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given unknown currency should return error", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-05-11 15:04:05", "category": "food", "amount": 30, "transaction_type": "expense", "currency": "ABC"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		h := New(nil)
+
+		err := h.Create(c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["the value of currency must be an ISO 4217 code"]}`, rec.Body.String())
+	})
+
+	t.Run("given external_ref already used should return conflict", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-05-11 15:04:05", "category": "food", "amount": 30, "transaction_type": "expense", "external_ref": "FIT-1"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(insertTxStmt).
+			WithArgs("2024-05-11 15:04:05", money.MustParse("30"), "food", "expense", "", "", 1, "THB", "FIT-1").
+			WillReturnError(&pq.Error{Code: "23505"})
+
+		h := New(db)
+
+		err := h.Create(c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+		assert.JSONEq(t, `{"messages":["a transaction with this external_ref already exists"]}`, rec.Body.String())
+	})
+}
+
+func TestCreateTransactionByService(t *testing.T) {
+	t.Run("given service principal should create transaction for spender in body", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-05-11 15:04:05", "category": "food", "amount": 30, "transaction_type": "expense", "spender_id": 2}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetPrincipal(c, auth.Principal{Role: auth.RoleService, Scopes: []string{auth.ScopeCreateTransactions}})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+		mock.ExpectQuery(insertTxStmt).
+			WithArgs("2024-05-11 15:04:05", money.MustParse("30"), "food", "expense", "", "", 2, "THB", "").
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 2, "THB", 30, "THB", 1, ""))
+
+		h := New(db)
+
+		err := h.Create(c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given service principal without spender_id should return error", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"date": "2024-05-11 15:04:05", "category": "food", "amount": 30, "transaction_type": "expense"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		auth.SetPrincipal(c, auth.Principal{Role: auth.RoleService, Scopes: []string{auth.ScopeCreateTransactions}})
+
+		h := New(nil)
+
+		err := h.Create(c)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.JSONEq(t, `{"messages":["field spender_id is required"]}`, rec.Body.String())
+	})
+}
+
+func TestDeleteTransaction(t *testing.T) {
+	t.Run("given own transaction should soft delete it", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodDelete, "/transactions/1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectExec(deleteTxStmt).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		h := New(db)
+		err := h.Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given transaction of another spender should return forbidden", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodDelete, "/transactions/1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 2, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+
+		h := New(db)
+		err := h.Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.JSONEq(t, `{"messages":["forbidden"]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given deleted or unknown transaction should return not found", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodDelete, "/transactions/1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnError(sql.ErrNoRows)
+
+		h := New(db)
+		err := h.Delete(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.JSONEq(t, `{"messages":["transaction not found"]}`, rec.Body.String())
+	})
+}
+
+func TestRestoreTransaction(t *testing.T) {
+	t.Run("given deleted transaction should restore it", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/transactions/1/restore", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id/restore")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 2, Role: auth.RoleAdmin})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+		mock.ExpectQuery(deletedTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectQuery(restoreTxStmt).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 1, "THB", 30, "THB", 1, ""))
+
+		h := New(db)
+		err := h.Restore(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"id": 1, "date": "2024-05-11 15:04:05", "amount": 30, "category": "food", "transaction_type": "expense", "note": "", "image_url": "", "spender_id": 1, "currency": "THB", "converted_amount": 30, "converted_currency": "THB"}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given transaction that is not deleted should return not found", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/transactions/1/restore", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id/restore")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(deletedTxStmt).WithArgs(1).WillReturnError(sql.ErrNoRows)
+
+		h := New(db)
+		err := h.Restore(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestPurgeTransaction(t *testing.T) {
+	t.Run("given retention should hard delete rows deleted before it", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/transactions/purge", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectExec(purgeTxStmt).WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 3))
+
+		h := New(db)
+		err := h.Purge(30 * 24 * time.Hour)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"purged": 3}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given database failure should return error", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/transactions/purge", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectExec(purgeTxStmt).WithArgs(sqlmock.AnyArg()).WillReturnError(errs.ErrInternalDatabaseError)
+
+		h := New(db)
+		err := h.Purge(time.Hour)(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.JSONEq(t, `{"messages":["internal database error"]}`, rec.Body.String())
+	})
+}
+
+var attachmentCols = []string{"transaction_id", "key", "content_type", "size", "thumbnail_jpeg", "thumbnail_webp", "attached_at"}
+
+func TestGetTransaction(t *testing.T) {
+	cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+
+	t.Run("given own transaction should return it with etag", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/transactions/1", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectQuery(getTxStmt).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 1, "THB", 30, "THB", 4, ""))
+		mock.ExpectQuery(attachmentsStmt).WithArgs(pq.Array([]int64{1})).
+			WillReturnRows(sqlmock.NewRows(attachmentCols).
+				AddRow(1, "k.pdf", "application/pdf", 90, nil, nil, time.Date(2024, 5, 11, 8, 0, 0, 0, time.UTC)).
+				AddRow(1, "k.png", "image/png", 70, "k.thumb.jpg", "k.thumb.webp", time.Date(2024, 5, 11, 8, 1, 0, 0, time.UTC)))
+		e.GET("/api/v1/slips/:key", nil).Name = RouteSlip
+
+		h := New(db)
+		err := h.Get(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"4"`, rec.Header().Get(utils.HeaderETag))
+		assert.JSONEq(t, `{"id": 1, "date": "2024-05-11 15:04:05", "amount": 30, "category": "food", "transaction_type": "expense", "note": "", "image_url": "", "spender_id": 1, "currency": "THB", "converted_amount": 30, "converted_currency": "THB",
+			"thumbnail_url": "/api/v1/slips/k.thumb.jpg",
+			"attachments": [
+				{"key": "k.pdf", "location": "/api/v1/slips/k.pdf", "content_type": "application/pdf", "size": 90, "attached_at": "2024-05-11T08:00:00Z"},
+				{"key": "k.png", "location": "/api/v1/slips/k.png", "content_type": "image/png", "size": 70, "attached_at": "2024-05-11T08:01:00Z",
+					"thumbnails": {"jpeg": "/api/v1/slips/k.thumb.jpg", "webp": "/api/v1/slips/k.thumb.webp"}}]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given matching If-None-Match should return not modified", func(t *testing.T) {
+		e := echo.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodGet, "/transactions/1", nil)
+		req.Header.Set(utils.HeaderIfNoneMatch, `"4"`)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectQuery(getTxStmt).WithArgs(1).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "expense", "", "", 1, "THB", 30, "THB", 4, ""))
+
+		h := New(db)
+		err := h.Get(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Equal(t, `"4"`, rec.Header().Get(utils.HeaderETag))
+		assert.Empty(t, rec.Body.String())
+	})
+}
+
+func TestUpdateTransactionWithIfMatch(t *testing.T) {
+	t.Run("given stale If-Match should return precondition failed", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPut, "/transactions/1", strings.NewReader(`{"date": "2024-05-11 15:04:05","amount": 30,"category": "food","transaction_type": "income"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(utils.HeaderIfMatch, `"2"`)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectQuery(updateTxStmt).WithArgs("2024-05-11 15:04:05", money.MustParse("30"), "food", "income", "", "", "THB", 1, pq.Array([]int{2})).WillReturnError(sql.ErrNoRows)
+
+		h := New(db)
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.JSONEq(t, `{"messages":["resource was modified, fetch it again and retry"]}`, rec.Body.String())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("given current If-Match should update and return next etag", func(t *testing.T) {
+		e := echo.New()
+		e.Validator = cv.New()
+		defer e.Close()
+
+		req := httptest.NewRequest(http.MethodPut, "/transactions/1", strings.NewReader(`{"date": "2024-05-11 15:04:05","amount": 30,"category": "food","transaction_type": "income"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(utils.HeaderIfMatch, `"2"`)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/transactions/:id")
+		utils.SetParams(c, utils.KeyValuePairs{"id": "1"})
+		auth.SetPrincipal(c, auth.Principal{SpenderID: 1, Role: auth.RoleSpender})
+
+		db, mock, _ := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		defer db.Close()
+
+		cols := []string{"id", "date", "amount", "category", "transaction_type", "note", "image_url", "spender_id", "currency", "converted_amount", "home_currency", "version", "external_ref"}
+		mock.ExpectQuery(ownerTxStmt).WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"spender_id"}).AddRow(1))
+		mock.ExpectQuery(updateTxStmt).WithArgs("2024-05-11 15:04:05", money.MustParse("30"), "food", "income", "", "", "THB", 1, pq.Array([]int{2})).
+			WillReturnRows(sqlmock.NewRows(cols).AddRow(1, "2024-05-11 15:04:05", 30, "food", "income", "", "", 1, "THB", 30, "THB", 3, ""))
+
+		h := New(db)
+		err := h.Update(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"3"`, rec.Header().Get(utils.HeaderETag))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
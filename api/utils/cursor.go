@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidCursor = errors.New("cursor is invalid")
+
+// Cursor marks a position in a listing ordered by (date, id). Clients treat
+// the encoded form as opaque.
+type Cursor struct {
+	Date     string `json:"d"`
+	ID       uint   `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// CursorPagination is the pagination block of keyset-paged listings.
+// TotalCount is only filled in when the client asks for it.
+type CursorPagination struct {
+	PerPage    uint   `json:"per_page"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	TotalCount *uint  `json:"total_count,omitempty"`
+}
+
+func EncodeCursor(cur Cursor) string {
+	b, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var cur Cursor
+	if err := json.Unmarshal(b, &cur); err != nil || cur.Date == "" || cur.ID == 0 {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return cur, nil
+}
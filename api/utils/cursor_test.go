@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor(t *testing.T) {
+	t.Run("given encoded cursor should decode to the same position", func(t *testing.T) {
+		cur := Cursor{Date: "2024-05-11T15:04:05Z", ID: 42, Backward: true}
+
+		decoded, err := DecodeCursor(EncodeCursor(cur))
+
+		assert.NoError(t, err)
+		assert.Equal(t, cur, decoded)
+	})
+
+	t.Run("given malformed cursor should return error", func(t *testing.T) {
+		for _, s := range []string{"***", "bm90LWpzb24", "e30"} {
+			_, err := DecodeCursor(s)
+			assert.ErrorIs(t, err, ErrInvalidCursor, s)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderETag        = "ETag"
+	HeaderIfMatch     = "If-Match"
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+var ErrPreconditionFailed = errors.New("resource was modified, fetch it again and retry")
+
+// ETag renders a row version as a strong entity tag.
+func ETag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// IfMatchVersions returns the versions a conditional write accepts from the
+// tags of its If-Match header; the write applies when the current version is
+// any of them. They are nil when the header is absent or "*", meaning any
+// version. Weak or malformed tags can never match, so a header with nothing
+// else fails the precondition.
+func IfMatchVersions(c echo.Context) ([]int, error) {
+	header := strings.TrimSpace(c.Request().Header.Get(HeaderIfMatch))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	var versions []int
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) || len(tag) < 3 {
+			continue
+		}
+		if version, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil && version > 0 {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, ErrPreconditionFailed
+	}
+
+	return versions, nil
+}
+
+// IfNoneMatch reports whether the If-None-Match header names etag, using the
+// weak comparison RFC 9110 prescribes for it. A GET should then answer 304.
+func IfNoneMatch(c echo.Context, etag string) bool {
+	header := strings.TrimSpace(c.Request().Header.Get(HeaderIfNoneMatch))
+	if header == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIfMatchVersions(t *testing.T) {
+	tests := []struct {
+		header   string
+		versions []int
+		err      error
+	}{
+		{"", nil, nil},
+		{"*", nil, nil},
+		{`"3"`, []int{3}, nil},
+		{`"2", "3"`, []int{2, 3}, nil},
+		{`W/"2", "3"`, []int{3}, nil},
+		{`W/"3"`, nil, ErrPreconditionFailed},
+		{`"abc"`, nil, ErrPreconditionFailed},
+		{`3`, nil, ErrPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPut, "/", nil)
+		req.Header.Set(HeaderIfMatch, tt.header)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		versions, err := IfMatchVersions(c)
+
+		assert.Equal(t, tt.versions, versions, tt.header)
+		assert.Equal(t, tt.err, err, tt.header)
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected bool
+	}{
+		{"", false},
+		{"*", true},
+		{`"2"`, true},
+		{`W/"2"`, true},
+		{`"1", "2"`, true},
+		{`"1"`, false},
+	}
+
+	for _, tt := range tests {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(HeaderIfNoneMatch, tt.header)
+		c := e.NewContext(req, httptest.NewRecorder())
+
+		assert.Equal(t, tt.expected, IfNoneMatch(c, ETag(2)), tt.header)
+	}
+}
@@ -1,7 +1,60 @@
 package utils
 
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultPerPage = 10
+	MaxPerPage     = 100
+)
+
+var ErrInvalidPage = errors.New("page and per_page must be greater than 0")
+
 type Pagination struct {
 	CurrentPage uint `json:"current_page"`
 	TotalPages  uint `json:"total_pages"`
 	PerPage     uint `json:"per_page"`
+	TotalCount  uint `json:"total_count"`
+}
+
+// ParsePage reads the page and per_page query parameters. per_page is capped
+// at MaxPerPage.
+func ParsePage(c echo.Context) (page, perPage int, err error) {
+	page, perPage = 1, DefaultPerPage
+
+	if v := c.QueryParam("page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if v := c.QueryParam("per_page"); v != "" {
+		if perPage, err = strconv.Atoi(v); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if page < 1 || perPage < 1 {
+		return 0, 0, ErrInvalidPage
+	}
+
+	if perPage > MaxPerPage {
+		perPage = MaxPerPage
+	}
+
+	return page, perPage, nil
+}
+
+func NewPagination(page, perPage int, totalCount int64) Pagination {
+	return Pagination{
+		CurrentPage: uint(page),
+		TotalPages:  uint(math.Ceil(float64(totalCount) / float64(perPage))),
+		PerPage:     uint(perPage),
+		TotalCount:  uint(totalCount),
+	}
 }
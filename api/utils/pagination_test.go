@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		query   string
+		page    int
+		perPage int
+		err     bool
+	}{
+		{"", 1, DefaultPerPage, false},
+		{"page=3&per_page=20", 3, 20, false},
+		{"per_page=1000", 1, MaxPerPage, false},
+		{"page=0", 0, 0, true},
+		{"per_page=-1", 0, 0, true},
+		{"page=abc", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		e := echo.New()
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil), httptest.NewRecorder())
+
+		page, perPage, err := ParsePage(c)
+
+		assert.Equal(t, tt.err, err != nil, tt.query)
+		assert.Equal(t, tt.page, page, tt.query)
+		assert.Equal(t, tt.perPage, perPage, tt.query)
+	}
+}
+
+func TestNewPagination(t *testing.T) {
+	assert.Equal(t, Pagination{CurrentPage: 2, TotalPages: 3, PerPage: 5, TotalCount: 11}, NewPagination(2, 5, 11))
+	assert.Equal(t, Pagination{CurrentPage: 1, TotalPages: 0, PerPage: 10, TotalCount: 0}, NewPagination(1, 10, 0))
+}
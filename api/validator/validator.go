@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -8,6 +9,15 @@ type CustomValidator struct {
 	Validator *validator.Validate
 }
 
+// New returns a CustomValidator with the repo's custom tags registered:
+//   - money_gt=N: a money.Money field must be greater than the decimal N
+func New() *CustomValidator {
+	v := validator.New()
+	_ = v.RegisterValidation("money_gt", moneyGT)
+
+	return &CustomValidator{Validator: v}
+}
+
 func (cv *CustomValidator) Validate(i any) error {
 	if err := cv.Validator.Struct(i); err != nil {
 		return err
@@ -15,3 +25,23 @@ func (cv *CustomValidator) Validate(i any) error {
 
 	return nil
 }
+
+// ValidatePartial validates only the named top-level fields of i, for
+// requests that carry a subset of a struct such as a merge patch.
+func (cv *CustomValidator) ValidatePartial(i any, fields ...string) error {
+	return cv.Validator.StructPartial(i, fields...)
+}
+
+func moneyGT(fl validator.FieldLevel) bool {
+	m, ok := fl.Field().Interface().(money.Money)
+	if !ok {
+		return false
+	}
+
+	threshold, err := money.Parse(fl.Param())
+	if err != nil {
+		return false
+	}
+
+	return m > threshold
+}
@@ -0,0 +1,42 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/KKGo-Software-engineering/workshop-summer/api/money"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoneyGT(t *testing.T) {
+	type payload struct {
+		Amount money.Money `validate:"money_gt=0.5"`
+	}
+
+	cv := New()
+
+	assert.NoError(t, cv.Validate(payload{Amount: money.MustParse("0.51")}))
+
+	err := cv.Validate(payload{Amount: money.MustParse("0.5")})
+	var ve validator.ValidationErrors
+	assert.ErrorAs(t, err, &ve)
+	assert.Equal(t, "money_gt", ve[0].Tag())
+	assert.Equal(t, "0.5", ve[0].Param())
+}
+
+func TestValidatePartial(t *testing.T) {
+	type payload struct {
+		Category string      `validate:"required"`
+		Amount   money.Money `validate:"required,money_gt=0"`
+	}
+
+	cv := New()
+
+	assert.NoError(t, cv.ValidatePartial(payload{Category: "food"}, "Category"))
+
+	err := cv.ValidatePartial(payload{Category: "food"}, "Category", "Amount")
+	var ve validator.ValidationErrors
+	assert.ErrorAs(t, err, &ve)
+	assert.Len(t, ve, 1)
+	assert.Equal(t, "Amount", ve[0].Field())
+}
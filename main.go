@@ -10,6 +10,9 @@ import (
 
 	"github.com/KKGo-Software-engineering/workshop-summer/api"
 	"github.com/KKGo-Software-engineering/workshop-summer/api/config"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/eslip"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/idempotency"
+	"github.com/KKGo-Software-engineering/workshop-summer/api/recurring"
 	"github.com/KKGo-Software-engineering/workshop-summer/migration"
 	"github.com/labstack/gommon/log"
 	_ "github.com/lib/pq"
@@ -33,7 +36,38 @@ func main() {
 		log.Fatal(err)
 	}
 
-	e := api.New(db, cfg, logger)
+	store, err := eslip.NewBlobStore(cfg.Storage)
+	if err != nil {
+		logger.Fatal("create slip storage:", zap.Error(err))
+	}
+
+	extractor, err := eslip.NewExtractor(cfg.Extractor)
+	if err != nil {
+		logger.Fatal("create slip extractor:", zap.Error(err))
+	}
+
+	e := api.New(db, cfg, logger, store)
+
+	sig, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	scheduler := recurring.NewScheduler(db, cfg.Recurring.Interval, logger)
+	schedulerDone := make(chan struct{})
+	go func() {
+		scheduler.Run(sig)
+		close(schedulerDone)
+	}()
+
+	// A sweep is a single statement, so there is nothing to wait for on
+	// shutdown.
+	go idempotency.NewSweeper(db, cfg.Idempotency.SweepInterval, logger).Run(sig)
+
+	processor := eslip.NewProcessor(db, store, extractor, cfg.SlipJobs, cfg.Thumbnails, logger)
+	processorDone := make(chan struct{})
+	go func() {
+		processor.Run(sig)
+		close(processorDone)
+	}()
 
 	go func() { // comment here to simulate slow endpoint then Ctrl+C to stop the server
 		if err := e.Start(":" + cfg.Server.Port); err != nil && err != http.ErrServerClosed {
@@ -44,9 +78,6 @@ func main() {
 	logger.Info("Server is running on :%s", zap.String("port", cfg.Server.Port))
 
 	// Wait for interrupt signal to gracefully shutdown the server with a timeout of 10 seconds.
-	sig, stop := signal.NotifyContext(context.Background(), os.Interrupt)
-	defer stop()
-
 	<-sig.Done()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
@@ -54,5 +85,16 @@ func main() {
 	if err := e.Shutdown(ctx); err != nil {
 		logger.Fatal("shutting down the server:", zap.Error(err))
 	}
+
+	select {
+	case <-schedulerDone:
+	case <-ctx.Done():
+		logger.Warn("recurring scheduler did not stop in time")
+	}
+	select {
+	case <-processorDone:
+	case <-ctx.Done():
+		logger.Warn("slip job workers did not stop in time; their jobs will be taken over once the lease runs out")
+	}
 	logger.Info("server shutdown gracefully")
 }
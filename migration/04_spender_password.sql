@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE
+    "spender"
+ADD
+    password_hash VARCHAR(255) NOT NULL DEFAULT '';
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE
+    "spender" DROP COLUMN password_hash;
+
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE
+    "spender"
+ADD
+    role VARCHAR(20) NOT NULL DEFAULT 'spender';
+
+-- +goose StatementEnd
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE
+    "spender" DROP COLUMN role;
+
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "service_key" (
+  id SERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  key_prefix VARCHAR(16) NOT NULL UNIQUE,
+  key_hash VARCHAR(64) NOT NULL,
+  scopes VARCHAR(255) NOT NULL DEFAULT '',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  rotated_at TIMESTAMP WITH TIME ZONE NULL,
+  revoked_at TIMESTAMP WITH TIME ZONE NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "service_key";
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE
+    "transaction"
+ADD
+    currency VARCHAR(3) NOT NULL DEFAULT 'THB';
+
+ALTER TABLE
+    "spender"
+ADD
+    home_currency VARCHAR(3) NOT NULL DEFAULT 'THB';
+
+CREATE TABLE IF NOT EXISTS "exchange_rates" (
+  base VARCHAR(3) NOT NULL,
+  quote VARCHAR(3) NOT NULL,
+  rate NUMERIC(18,8) NOT NULL,
+  effective_date DATE NOT NULL,
+  PRIMARY KEY (base, quote, effective_date)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "exchange_rates";
+
+ALTER TABLE
+    "spender" DROP COLUMN home_currency;
+
+ALTER TABLE
+    "transaction" DROP COLUMN currency;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE
+    "transaction"
+ADD
+    deleted_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE INDEX IF NOT EXISTS transaction_deleted_at_idx ON "transaction" (deleted_at) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS transaction_deleted_at_idx;
+
+ALTER TABLE
+    "transaction" DROP COLUMN deleted_at;
+-- +goose StatementEnd
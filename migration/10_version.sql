@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE
+    "transaction"
+ADD
+    version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE
+    "spender"
+ADD
+    version INT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE
+    "spender" DROP COLUMN version;
+
+ALTER TABLE
+    "transaction" DROP COLUMN version;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "import_profile" (
+  id SERIAL PRIMARY KEY,
+  spender_id INT NOT NULL,
+  name VARCHAR(64) NOT NULL,
+  mapping JSONB NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  UNIQUE (spender_id, name)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "import_profile";
+-- +goose StatementEnd
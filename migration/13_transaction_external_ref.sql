@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE
+    "transaction"
+ADD
+    external_ref VARCHAR(255) NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS transaction_external_ref_idx ON "transaction" (spender_id, external_ref) WHERE external_ref IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS transaction_external_ref_idx;
+
+ALTER TABLE
+    "transaction" DROP COLUMN external_ref;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS "recurring_transaction" (
+  id SERIAL PRIMARY KEY,
+  spender_id INT NOT NULL,
+  amount DECIMAL(10,2) NOT NULL,
+  currency VARCHAR(3) NOT NULL DEFAULT 'THB',
+  category VARCHAR(50) NOT NULL,
+  transaction_type VARCHAR(20) NOT NULL,
+  note VARCHAR(255) NOT NULL DEFAULT '',
+  frequency VARCHAR(10) NOT NULL,
+  "interval" INT NOT NULL DEFAULT 1,
+  starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  until TIMESTAMP WITH TIME ZONE NULL,
+  count INT NULL,
+  occurrences INT NOT NULL DEFAULT 0,
+  next_run TIMESTAMP WITH TIME ZONE NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS recurring_transaction_next_run_idx ON "recurring_transaction" (next_run) WHERE next_run IS NOT NULL;
+
+-- recurring_occurrence records each occurrence materialized into a
+-- transaction. Its key is what keeps an occurrence from being created twice.
+CREATE TABLE IF NOT EXISTS "recurring_occurrence" (
+  recurring_id INT NOT NULL REFERENCES "recurring_transaction" (id) ON DELETE CASCADE,
+  seq INT NOT NULL,
+  transaction_id INT NOT NULL,
+  PRIMARY KEY (recurring_id, seq)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "recurring_occurrence";
+DROP TABLE IF EXISTS "recurring_transaction";
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- slip records every stored slip with the hashes of its content. sha256 finds
+-- exact re-uploads; dhash, a 64-bit perceptual hash of images, finds the same
+-- picture re-encoded. Slips are attached to transactions through
+-- transaction_slip; a re-upload is reported with the oldest live transaction
+-- it is attached to.
+CREATE TABLE IF NOT EXISTS "slip" (
+  id SERIAL PRIMARY KEY,
+  key VARCHAR(255) NOT NULL UNIQUE,
+  spender_id INT NOT NULL,
+  sha256 VARCHAR(64) NOT NULL,
+  dhash BIGINT NULL,
+  content_type VARCHAR(100) NOT NULL,
+  size BIGINT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  UNIQUE (spender_id, sha256)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "slip";
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- slip_job queues the processing of an uploaded slip: hashing, duplicate
+-- detection, QR decoding and reading a draft transaction. A worker claims a
+-- job by setting it running until locked_until; a job whose worker stopped
+-- before finishing is claimed again once that has passed. Failed jobs are
+-- queued again at run_at until they run out of attempts and end up dead.
+CREATE TABLE IF NOT EXISTS "slip_job" (
+  id SERIAL PRIMARY KEY,
+  spender_id INT NOT NULL,
+  key VARCHAR(255) NOT NULL,
+  filename VARCHAR(255) NOT NULL,
+  content_type VARCHAR(100) NOT NULL,
+  size BIGINT NOT NULL,
+  status VARCHAR(10) NOT NULL DEFAULT 'queued',
+  attempts INT NOT NULL DEFAULT 0,
+  run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  locked_until TIMESTAMP WITH TIME ZONE NULL,
+  last_error TEXT NULL,
+  result JSONB NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS slip_job_pending_idx ON "slip_job" (run_at, id) WHERE status IN ('queued', 'running');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "slip_job";
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+-- uploaded_by is the spender or admin who uploaded a slip; it stays NULL for
+-- service callers and for slips uploaded before it was recorded. spender_id
+-- remains the spender the slip belongs to.
+ALTER TABLE "slip" ADD COLUMN IF NOT EXISTS uploaded_by INT NULL;
+ALTER TABLE "slip_job" ADD COLUMN IF NOT EXISTS uploaded_by INT NULL;
+
+-- transaction_slip attaches slips to transactions. A slip may back several
+-- transactions and a transaction may carry several slips. Purging a
+-- transaction detaches its slips; a slip cannot be removed while attached.
+CREATE TABLE IF NOT EXISTS "transaction_slip" (
+  transaction_id INT NOT NULL REFERENCES "transaction" (id) ON DELETE CASCADE,
+  slip_id INT NOT NULL REFERENCES "slip" (id),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  PRIMARY KEY (transaction_id, slip_id)
+);
+
+CREATE INDEX IF NOT EXISTS transaction_slip_slip_id_idx ON "transaction_slip" (slip_id);
+
+-- Slips used to belong to the transactions whose image_url pointed at them.
+INSERT INTO "transaction_slip" (transaction_id, slip_id)
+SELECT t.id, s.id FROM "transaction" t JOIN "slip" s ON s.spender_id = t.spender_id AND t.image_url LIKE '%/slips/' || s.key
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS "transaction_slip";
+ALTER TABLE "slip_job" DROP COLUMN IF EXISTS uploaded_by;
+ALTER TABLE "slip" DROP COLUMN IF EXISTS uploaded_by;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- thumbnail_jpeg and thumbnail_webp are the keys of the thumbnails stored next
+-- to a slip. They stay NULL for slips that are not images the service can
+-- decode and for slips stored before thumbnails were made.
+ALTER TABLE "slip" ADD COLUMN IF NOT EXISTS thumbnail_jpeg VARCHAR(255) NULL;
+ALTER TABLE "slip" ADD COLUMN IF NOT EXISTS thumbnail_webp VARCHAR(255) NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "slip" DROP COLUMN IF EXISTS thumbnail_webp;
+ALTER TABLE "slip" DROP COLUMN IF EXISTS thumbnail_jpeg;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- captured_at is when the picture of a slip was taken, read off its EXIF
+-- before the EXIF was dropped. It is only kept when the uploader asked for it
+-- to date the draft transaction, and is local to the camera, with no zone.
+ALTER TABLE "slip_job" ADD COLUMN IF NOT EXISTS captured_at TIMESTAMP NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "slip_job" DROP COLUMN IF EXISTS captured_at;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- service_key_id is the service key that uploaded a slip, so that key may
+-- follow the job it queued. It stays NULL for spenders and admins.
+ALTER TABLE "slip_job" ADD COLUMN IF NOT EXISTS service_key_id INT NULL REFERENCES "service_key" (id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "slip_job" DROP COLUMN IF EXISTS service_key_id;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Serving a slip looks up who it belongs to by its key or the key of one of
+-- its thumbnails, or by the key of the job still processing it.
+CREATE INDEX IF NOT EXISTS slip_thumbnail_jpeg_idx ON "slip" (thumbnail_jpeg);
+CREATE INDEX IF NOT EXISTS slip_thumbnail_webp_idx ON "slip" (thumbnail_webp);
+CREATE INDEX IF NOT EXISTS slip_job_key_idx ON "slip_job" (key);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS slip_job_key_idx;
+DROP INDEX IF EXISTS slip_thumbnail_webp_idx;
+DROP INDEX IF EXISTS slip_thumbnail_jpeg_idx;
+-- +goose StatementEnd
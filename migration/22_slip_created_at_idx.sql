@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The near-duplicate report compares each hashed slip with those uploaded
+-- shortly after it.
+CREATE INDEX IF NOT EXISTS slip_dhash_created_at_idx ON "slip" (created_at, id) WHERE dhash IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS slip_dhash_created_at_idx;
+-- +goose StatementEnd